@@ -0,0 +1,138 @@
+// Package apps registers the ABCI applications the server can run, so they
+// can be selected by name.
+package apps
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ArtosSystems/tendermint-exp/metrics"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// Application is an ABCI application the server can run. Applications that
+// hold resources also implement io.Closer
+type Application interface {
+	types.Application
+}
+
+// Config is what every application is built with
+type Config struct {
+	// DataDir is where the application keeps its state. Empty keeps the
+	// state in memory only
+	DataDir string
+	// DebugQueries enables queries not meant for production
+	DebugQueries bool
+	// RetainHeights is how many of the latest heights queries can read.
+	// Zero keeps every height
+	RetainHeights int64
+	// HashStrategy hashes the ticket tree's parent nodes. Nil is sha256
+	HashStrategy func() hash.Hash
+	// SnapshotInterval is how many heights apart snapshots are written to
+	// DataDir. Zero writes none
+	SnapshotInterval int64
+	// FlushInterval is how many commits apart the state is written to
+	// DataDir. Zero writes it only on Close
+	FlushInterval int64
+	// CheckTxCache is how many CheckTx results are cached until the next
+	// Commit. Zero caches none
+	CheckTxCache int
+	// ChainId is the EIP-155 chain id signatures may be bound to. Zero
+	// accepts only legacy signatures
+	ChainId uint64
+	// Validators maps owner addresses to the ed25519 public keys of the
+	// validators their tickets give voting power to, capped at
+	// ValidatorMaxPower when above zero. Empty leaves the validators alone
+	Validators        map[string][]byte
+	ValidatorMaxPower int64
+	// DropProofs stores each ticket's leaf in place of its ownership proof
+	DropProofs bool
+	Metrics    metrics.Recorder
+	Logger     log.Logger
+	// Audit receives rejected txs, cut to AuditMaxBytes and limited to
+	// AuditRate a second. Nil records nothing
+	Audit         io.Writer
+	AuditMaxBytes int
+	AuditRate     int
+}
+
+// Constructor builds an application from config
+type Constructor func(config Config) (Application, error)
+
+var registry = map[string]Constructor{
+	"ticketstore": newTicketStore,
+}
+
+// Register makes constructor available under name, replacing any
+// application already registered under it
+func Register(name string, constructor Constructor) {
+	registry[name] = constructor
+}
+
+// Names returns the registered application names, sorted
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New builds the application registered under name
+func New(name string, config Config) (Application, error) {
+	constructor, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown app. Expected %v, got %v", strings.Join(Names(), " or "), name)
+	}
+	if config.Metrics == nil {
+		config.Metrics = metrics.Nop()
+	}
+	if config.Logger == nil {
+		config.Logger = log.NewNopLogger()
+	}
+	return constructor(config)
+}
+
+func newTicketStore(config Config) (Application, error) {
+	opts := []ticketstore.Option{ticketstore.WithMetrics(config.Metrics), ticketstore.WithLogger(config.Logger)}
+	if config.DebugQueries {
+		opts = append(opts, ticketstore.WithDebugQueries())
+	}
+	if config.RetainHeights > 0 {
+		opts = append(opts, ticketstore.WithRetainHeights(config.RetainHeights))
+	}
+	if config.HashStrategy != nil {
+		opts = append(opts, ticketstore.WithHashStrategy(config.HashStrategy))
+	}
+	if config.CheckTxCache > 0 {
+		opts = append(opts, ticketstore.WithCheckTxCache(config.CheckTxCache))
+	}
+	if config.ChainId != 0 {
+		opts = append(opts, ticketstore.WithChainId(config.ChainId))
+	}
+	if len(config.Validators) > 0 {
+		opts = append(opts, ticketstore.WithValidatorHoldings(config.Validators, config.ValidatorMaxPower))
+	}
+	if config.DropProofs {
+		opts = append(opts, ticketstore.WithoutStoredProofs())
+	}
+	if config.Audit != nil {
+		opts = append(opts, ticketstore.WithAuditSink(config.Audit, config.AuditMaxBytes, config.AuditRate))
+	}
+	if config.DataDir == "" {
+		return ticketstore.NewTicketStoreApplication(opts...), nil
+	}
+	if config.SnapshotInterval > 0 {
+		opts = append(opts, ticketstore.WithSnapshotInterval(config.SnapshotInterval))
+	}
+	if config.FlushInterval > 0 {
+		opts = append(opts, ticketstore.WithFlushInterval(config.FlushInterval))
+	}
+	return ticketstore.OpenTicketStoreApplication(config.DataDir, opts...)
+}
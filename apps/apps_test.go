@@ -0,0 +1,368 @@
+package apps
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		app  string
+		err  string
+	}{
+		{"ticketstore", "ticketstore", ""},
+		{"unknown app", "oddeven", "Unknown app. Expected ticketstore, got oddeven"},
+		{"empty name", "", "Unknown app"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, err := New(test.app, Config{})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("New returned %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := app.(*ticketstore.TicketStoreApplication); !ok {
+				t.Errorf("New returned a %T, want a ticket store", app)
+			}
+		})
+	}
+}
+
+func TestNewWithDataDir(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	app, err := New("ticketstore", Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.(*ticketstore.TicketStoreApplication).Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewWithHashStrategy(t *testing.T) {
+	tx := []byte(`{"id":1,"nonce":1,"details":"","ownerAddr":"0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"}`)
+	tests := []struct {
+		name     string
+		strategy func() hash.Hash
+	}{
+		{"default", nil},
+		{"sha256", sha256.New},
+		{"keccak256", ticketstore.Keccak256},
+	}
+	roots := make(map[string][]byte)
+	for _, test := range tests {
+		app, err := New("ticketstore", Config{HashStrategy: test.strategy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Two tickets so the root is a parent node
+		app.DeliverTx(types.RequestDeliverTx{Tx: tx})
+		app.DeliverTx(types.RequestDeliverTx{Tx: bytes.Replace(tx, []byte(`"id":1`), []byte(`"id":2`), 1)})
+		roots[test.name] = app.Commit().Data
+	}
+	if !bytes.Equal(roots["default"], roots["sha256"]) {
+		t.Errorf("Default root %x differs from the sha256 root %x", roots["default"], roots["sha256"])
+	}
+	if bytes.Equal(roots["sha256"], roots["keccak256"]) {
+		t.Errorf("keccak256 root %x is the sha256 root", roots["keccak256"])
+	}
+}
+
+func TestNewWithSnapshotInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  int64
+		snapshots []int64
+	}{
+		{"none", 0, nil},
+		{"every height", 1, []int64{4, 5}},
+		{"every other height", 2, []int64{2, 4}},
+		{"every third height", 3, []int64{3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, err := ioutil.TempDir("", "apps")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dataDir)
+
+			app, err := New("ticketstore", Config{DataDir: dataDir, SnapshotInterval: test.interval})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for height := int64(1); height <= 5; height++ {
+				app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: height}})
+				tx := fmt.Sprintf(`{"id":%v,"nonce":1,"details":"","ownerAddr":"0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"}`, height)
+				if response := app.DeliverTx(types.RequestDeliverTx{Tx: []byte(tx)}); response.Code != 0 {
+					t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+				}
+				app.EndBlock(types.RequestEndBlock{Height: height})
+				app.Commit()
+			}
+			if err := app.(*ticketstore.TicketStoreApplication).Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			layout, err := ticketstore.ReadDataDir(dataDir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var heights []int64
+			for _, snapshot := range layout.Snapshots {
+				heights = append(heights, snapshot.Height)
+			}
+			if !reflect.DeepEqual(heights, test.snapshots) {
+				t.Errorf("Snapshots were written at heights %v, want %v", heights, test.snapshots)
+			}
+		})
+	}
+}
+
+func TestNewWithTicketStoreOptions(t *testing.T) {
+	key, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+	pubKey := bytes.Repeat([]byte{1}, 32)
+	issue := func(id uint64) ticketstore.TicketTx {
+		return ticketstore.TicketTx{Id: id, Nonce: 1, Details: "", OwnerAddr: owner}
+	}
+	// resale transfers the first ticket with a proof bound to chainId
+	resale := func(t *testing.T, chainId uint64) []byte {
+		proof, err := ticketstore.SignTicketTransferForChain(issue(1), key, chainId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, _ := json.Marshal(ticketstore.TicketTx{Id: 1, Nonce: 2, OwnerAddr: "0x90f8bf6a479f320ead074411a4b0e7944ea8c9c1", PrevOwnerProof: proof})
+		return tx
+	}
+	// storedProof commits the resale and returns the proof app stores for it
+	storedProof := func(t *testing.T, app Application) string {
+		t.Helper()
+		app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: 2}})
+		if response := app.DeliverTx(types.RequestDeliverTx{Tx: resale(t, 0)}); response.Code != 0 {
+			t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+		}
+		app.EndBlock(types.RequestEndBlock{Height: 2})
+		app.Commit()
+		var stored ticketstore.TicketResponse
+		response := app.Query(types.RequestQuery{Path: "ticket", Data: []byte("1")})
+		if err := json.Unmarshal(response.Value, &stored); err != nil {
+			t.Fatalf("ticket query returned %s: %v", response.Value, err)
+		}
+		return stored.Ticket.PrevOwnerProof
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		// check runs once two tickets have been committed to app at height 1,
+		// given the validator updates EndBlock returned
+		check func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate)
+	}{
+		{"chain id", Config{ChainId: 1337}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			if response := app.CheckTx(types.RequestCheckTx{Tx: resale(t, 1337)}); response.Code != 0 {
+				t.Errorf("Resale signed for the chain returned code %v: %v", response.Code, response.Log)
+			}
+		}},
+		{"no chain id", Config{}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			if response := app.CheckTx(types.RequestCheckTx{Tx: resale(t, 1337)}); response.Code == 0 {
+				t.Errorf("Resale signed for a chain was accepted without a chain id")
+			}
+		}},
+		{"validators", Config{Validators: map[string][]byte{owner: pubKey}}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			want := []types.ValidatorUpdate{types.Ed25519ValidatorUpdate(pubKey, 2)}
+			if !reflect.DeepEqual(updates, want) {
+				t.Errorf("EndBlock returned %v, want %v", updates, want)
+			}
+		}},
+		{"capped validators", Config{Validators: map[string][]byte{owner: pubKey}, ValidatorMaxPower: 1}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			want := []types.ValidatorUpdate{types.Ed25519ValidatorUpdate(pubKey, 1)}
+			if !reflect.DeepEqual(updates, want) {
+				t.Errorf("EndBlock returned %v, want %v", updates, want)
+			}
+		}},
+		{"no validators", Config{}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			if len(updates) != 0 {
+				t.Errorf("EndBlock returned %v, want no updates", updates)
+			}
+		}},
+		{"flush interval", Config{FlushInterval: 1}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			// The commit is durable before the app is closed
+			reopened, err := New("ticketstore", Config{DataDir: dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := reopened.Info(types.RequestInfo{}); info.LastBlockHeight != 1 {
+				t.Errorf("Node reopened without closing is at height %v, want 1", info.LastBlockHeight)
+			}
+		}},
+		{"no flush interval", Config{}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			reopened, err := New("ticketstore", Config{DataDir: dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := reopened.Info(types.RequestInfo{}); info.LastBlockHeight != 0 {
+				t.Errorf("Node reopened without closing is at height %v, want 0", info.LastBlockHeight)
+			}
+		}},
+		{"drop proofs", Config{DropProofs: true}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			if proof := storedProof(t, app); proof != "" {
+				t.Errorf("Resale was stored with proof %v, want none", proof)
+			}
+		}},
+		{"keep proofs", Config{}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			if proof := storedProof(t, app); proof == "" {
+				t.Errorf("Resale was stored without its proof")
+			}
+		}},
+		{"CheckTx cache", Config{CheckTxCache: 10}, func(t *testing.T, app Application, dataDir string, updates []types.ValidatorUpdate) {
+			tx, _ := json.Marshal(issue(3))
+			for i := 0; i < 2; i++ {
+				if response := app.CheckTx(types.RequestCheckTx{Tx: tx}); response.Code != 0 {
+					t.Errorf("CheckTx %v returned code %v: %v", i, response.Code, response.Log)
+				}
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, err := ioutil.TempDir("", "apps")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dataDir)
+
+			config := test.config
+			config.DataDir = dataDir
+			app, err := New("ticketstore", config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: 1}})
+			for id := uint64(1); id <= 2; id++ {
+				tx, _ := json.Marshal(issue(id))
+				if response := app.DeliverTx(types.RequestDeliverTx{Tx: tx}); response.Code != 0 {
+					t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+				}
+			}
+			updates := app.EndBlock(types.RequestEndBlock{Height: 1}).ValidatorUpdates
+			app.Commit()
+			test.check(t, app, dataDir, updates)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer delete(registry, "echo")
+	Register("echo", func(config Config) (Application, error) {
+		return types.NewBaseApplication(), nil
+	})
+
+	if names := Names(); !reflect.DeepEqual(names, []string{"echo", "ticketstore"}) {
+		t.Errorf("Names returned %v, want echo and ticketstore", names)
+	}
+	if _, err := New("echo", Config{}); err != nil {
+		t.Errorf("New of a registered app failed: %v", err)
+	}
+}
+
+// lifecycles give each registered application a tx it accepts and a query
+// that finds the tx's effect once committed
+var lifecycles = map[string]struct {
+	tx    []byte
+	query types.RequestQuery
+}{
+	"ticketstore": {
+		tx:    []byte(`{"id":1,"nonce":1,"details":"Seat 1","ownerAddr":"0x90f8bf6a479f320ead074411a4b0e7944ea8c9c1"}`),
+		query: types.RequestQuery{Path: "ticket", Data: []byte("1")},
+	},
+}
+
+func TestLifecycle(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			lifecycle, ok := lifecycles[name]
+			if !ok {
+				t.Fatalf("No lifecycle for %v", name)
+			}
+			dataDir, err := ioutil.TempDir("", "apps")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dataDir)
+
+			app, err := New(name, Config{DataDir: dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := app.Info(types.RequestInfo{}); info.LastBlockHeight != 0 {
+				t.Errorf("Info before the first block returned height %v, want 0", info.LastBlockHeight)
+			}
+			if response := app.Query(lifecycle.query); response.Code == 0 {
+				t.Errorf("%v query before the tx was committed succeeded: %s", lifecycle.query.Path, response.Value)
+			}
+			if response := app.CheckTx(types.RequestCheckTx{Tx: lifecycle.tx}); response.Code != 0 {
+				t.Fatalf("CheckTx returned code %v: %v", response.Code, response.Log)
+			}
+			app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: 1}})
+			if response := app.DeliverTx(types.RequestDeliverTx{Tx: lifecycle.tx}); response.Code != 0 {
+				t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+			}
+			app.EndBlock(types.RequestEndBlock{Height: 1})
+			appHash := app.Commit().Data
+			if len(appHash) == 0 {
+				t.Errorf("Commit returned an empty app hash")
+			}
+			if info := app.Info(types.RequestInfo{}); info.LastBlockHeight != 1 || !reflect.DeepEqual(info.LastBlockAppHash, appHash) {
+				t.Errorf("Info returned height %v and app hash %x, want 1 and %x", info.LastBlockHeight, info.LastBlockAppHash, appHash)
+			}
+			if response := app.Query(lifecycle.query); response.Code != 0 || len(response.Value) == 0 {
+				t.Errorf("%v query returned code %v: %v", lifecycle.query.Path, response.Code, response.Log)
+			}
+
+			// An application holding resources resumes from its data
+			// directory once closed
+			closer, ok := app.(io.Closer)
+			if !ok {
+				return
+			}
+			if err := closer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reopened, err := New(name, Config{DataDir: dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := reopened.Info(types.RequestInfo{}); info.LastBlockHeight != 1 || !reflect.DeepEqual(info.LastBlockAppHash, appHash) {
+				t.Errorf("Info after reopening returned height %v and app hash %x, want 1 and %x", info.LastBlockHeight, info.LastBlockAppHash, appHash)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// subcommands are run in place of the ABCI server when named as the first
+// argument, for working with ticket signatures and data directories offline.
+// Flags shared with the server are also set by the same environment variables
+var subcommands = map[string]func(args []string, getenv func(string) string, stdout io.Writer) error{
+	"sign":      signCommand,
+	"verify":    verifyCommand,
+	"snapshots": snapshotsCommand,
+	"restore":   restoreCommand,
+}
+
+// signCommand prints the PrevOwnerProof that transfers the ticket given in
+// -ticket, signed with the owner's hex private key for a node with -chain-id
+func signCommand(args []string, getenv func(string) string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	ticketJSON := flags.String("ticket", "", "JSON of the ticket being transferred, as currently stored")
+	key := flags.String("key", "", "Hex private key of the ticket's current owner")
+	chainId := flags.Uint64("chain-id", 0, "EIP-155 chain id to bind the signature to. Zero signs with a legacy 27/28 recovery id. Also set by ABCI_CHAIN_ID")
+	if err := parseFlags(flags, args, getenv); err != nil {
+		return err
+	}
+
+	var ticket ticketstore.TicketTx
+	if err := json.Unmarshal([]byte(*ticketJSON), &ticket); err != nil {
+		return fmt.Errorf("Invalid -ticket: %v", err)
+	}
+	privKey, err := crypto.HexToECDSA(strings.TrimPrefix(*key, "0x"))
+	if err != nil {
+		return fmt.Errorf("Invalid -key: %v", err)
+	}
+
+	proof, err := ticketstore.SignTicketTransferForChain(ticket, privKey, *chainId)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, proof)
+	return nil
+}
+
+// verifyCommand prints the address that signed the PrevOwnerProof of the
+// resale given in -ticket over the ticket given in -prev
+func verifyCommand(args []string, getenv func(string) string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	ticketJSON := flags.String("ticket", "", "JSON of the resale, including its prevOwnerProof")
+	prevJSON := flags.String("prev", "", "JSON of the ticket being transferred, as currently stored")
+	chainId := flags.Uint64("chain-id", 0, "EIP-155 chain id of the node. Legacy 27/28 recovery ids are accepted with or without one. Also set by ABCI_CHAIN_ID")
+	if err := parseFlags(flags, args, getenv); err != nil {
+		return err
+	}
+
+	var ticket, prevTicket ticketstore.TicketTx
+	if err := json.Unmarshal([]byte(*ticketJSON), &ticket); err != nil {
+		return fmt.Errorf("Invalid -ticket: %v", err)
+	}
+	if err := json.Unmarshal([]byte(*prevJSON), &prevTicket); err != nil {
+		return fmt.Errorf("Invalid -prev: %v", err)
+	}
+
+	signer, err := ticketstore.RecoverTransferSigner(ticket, prevTicket, *chainId)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, signer)
+	return nil
+}
+
+// snapshotsCommand prints the state file, write-ahead log heights and
+// snapshots found in -data-dir, with the height and root hash of each
+// computed with the node's -hash-strategy
+func snapshotsCommand(args []string, getenv func(string) string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("snapshots", flag.ContinueOnError)
+	dataDir := flags.String("data-dir", "", "Data directory of a stopped node. Also set by ABCI_DATA_DIR")
+	var hashStrategyName string
+	hashStrategyFlag(flags, &hashStrategyName)
+	if err := parseFlags(flags, args, getenv); err != nil {
+		return err
+	}
+	if *dataDir == "" {
+		return fmt.Errorf("-data-dir is required")
+	}
+
+	hashStrategy, err := ticketstore.HashStrategyNamed(hashStrategyName)
+	if err != nil {
+		return err
+	}
+
+	layout, err := ticketstore.ReadDataDir(*dataDir, hashStrategy)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(layout)
+}
+
+// restoreCommand makes the snapshot in -from the state of -data-dir once its
+// root, rebuilt with the node's -hash-strategy, matches the root it recorded,
+// and prints the restored state
+func restoreCommand(args []string, getenv func(string) string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	from := flags.String("from", "", "Snapshot or state file to restore")
+	dataDir := flags.String("data-dir", "", "Data directory of a stopped node to restore into. Also set by ABCI_DATA_DIR")
+	force := flags.Bool("force", false, "Replace the state already in -data-dir")
+	var hashStrategyName string
+	hashStrategyFlag(flags, &hashStrategyName)
+	if err := parseFlags(flags, args, getenv); err != nil {
+		return err
+	}
+	if *from == "" || *dataDir == "" {
+		return fmt.Errorf("-from and -data-dir are required")
+	}
+	hashStrategy, err := ticketstore.HashStrategyNamed(hashStrategyName)
+	if err != nil {
+		return err
+	}
+
+	restored, err := ticketstore.RestoreDataDir(*dataDir, *from, *force, hashStrategy)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(restored)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ArtosSystems/tendermint-exp/apps"
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// Hex private keys of the owners used in the subcommand tests
+const (
+	aliceHexKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	bobHexKey   = "8da4ef21b864d2cc526dbdb2a120bd2874c36c9d0a1fb7f8c63d7f7a8b41de8f"
+)
+
+// hexKeyAddress is the lower case address of hexKey, as the store keeps owners
+func hexKeyAddress(t *testing.T, hexKey string) string {
+	t.Helper()
+	key, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
+
+// runCommand runs subcommand name with args and an empty environment,
+// returning its trimmed output
+func runCommand(name string, args ...string) (string, error) {
+	return runCommandWithEnv(name, nil, args...)
+}
+
+// runCommandWithEnv runs subcommand name with args and the variables in env
+func runCommandWithEnv(name string, env map[string]string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := subcommands[name](args, func(name string) string { return env[name] }, &stdout)
+	return strings.TrimSpace(stdout.String()), err
+}
+
+func TestSignAndVerifyCommands(t *testing.T) {
+	alice, bob := hexKeyAddress(t, aliceHexKey), hexKeyAddress(t, bobHexKey)
+	issued := ticketstore.TicketTx{Id: 1, Nonce: 1, Details: "Seat 1", OwnerAddr: alice}
+
+	app := ticketstore.NewTicketStoreApplication()
+	if response := app.DeliverTx(types.RequestDeliverTx{Tx: []byte(mustJSON(t, issued))}); response.Code != codes.OK {
+		t.Fatalf("DeliverTx of the issued ticket returned code %v: %v", response.Code, response.Log)
+	}
+	app.Commit()
+
+	// nodes are keyed by the chain id they run with
+	nodes := map[string]*ticketstore.TicketStoreApplication{"0": app}
+	for _, chainId := range []uint64{5, 137} {
+		node := ticketstore.NewTicketStoreApplication(ticketstore.WithChainId(chainId))
+		node.DeliverTx(types.RequestDeliverTx{Tx: []byte(mustJSON(t, issued))})
+		node.Commit()
+		nodes[fmt.Sprint(chainId)] = node
+	}
+
+	tests := []struct {
+		name        string
+		key         string
+		chainId     string
+		nodeChainId string
+		signer      string
+		code        uint32
+	}{
+		{"signed by the owner", aliceHexKey, "0", "0", alice, codes.OK},
+		{"signed with a 0x prefix", "0x" + aliceHexKey, "0", "0", alice, codes.OK},
+		{"signed by someone else", bobHexKey, "0", "0", bob, codes.TicketError},
+		{"signed for the node's chain", aliceHexKey, "5", "5", alice, codes.OK},
+		{"signed for a chain with a two byte v", aliceHexKey, "137", "137", alice, codes.OK},
+		{"signed legacy for a node with a chain", aliceHexKey, "0", "5", alice, codes.OK},
+		{"signed for another chain", aliceHexKey, "137", "5", "", codes.TicketError},
+		{"signed for a chain the node is not on", aliceHexKey, "5", "0", "", codes.TicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof, err := runCommand("sign", "-ticket", mustJSON(t, issued), "-key", test.key, "-chain-id", test.chainId)
+			if err != nil {
+				t.Fatalf("sign failed: %v", err)
+			}
+			resale := ticketstore.TicketTx{Id: 1, Nonce: 2, Details: "Seat 1", OwnerAddr: bob, PrevOwnerProof: proof}
+
+			// verify checks the proof as the node does, so it fails when the
+			// node would not accept the recovery id
+			signer, err := runCommand("verify", "-ticket", mustJSON(t, resale), "-prev", mustJSON(t, issued), "-chain-id", test.nodeChainId)
+			if signer != test.signer || (err == nil) != (test.signer != "") {
+				t.Errorf("verify returned %v, %v, want %v", signer, err, test.signer)
+			}
+
+			// The store agrees with verify on whether the resale is the owner's
+			tx := []byte(mustJSON(t, resale))
+			if response := nodes[test.nodeChainId].CheckTx(types.RequestCheckTx{Tx: tx}); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+		})
+	}
+
+	proof, _ := runCommand("sign", "-ticket", mustJSON(t, issued), "-key", aliceHexKey)
+	resale := ticketstore.TicketTx{Id: 1, Nonce: 2, Details: "Seat 1", OwnerAddr: bob, PrevOwnerProof: proof}
+	if response := app.DeliverTx(types.RequestDeliverTx{Tx: []byte(mustJSON(t, resale))}); response.Code != codes.OK {
+		t.Fatalf("DeliverTx of the signed resale returned code %v: %v", response.Code, response.Log)
+	}
+	app.Commit()
+	var stored ticketstore.TicketResponse
+	response := app.Query(types.RequestQuery{Path: "ticket", Data: []byte("1")})
+	if err := json.Unmarshal(response.Value, &stored); err != nil || stored.Ticket.OwnerAddr != bob {
+		t.Errorf("ticket query returned %s (%v), want ticket 1 owned by %v", response.Value, response.Log, bob)
+	}
+}
+
+func TestSignAndVerifyCommandErrors(t *testing.T) {
+	issued := mustJSON(t, ticketstore.TicketTx{Id: 1, Nonce: 1, OwnerAddr: hexKeyAddress(t, aliceHexKey)})
+	unsigned := mustJSON(t, ticketstore.TicketTx{Id: 1, Nonce: 2, OwnerAddr: hexKeyAddress(t, bobHexKey)})
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{"sign without a ticket", "sign", []string{"-key", aliceHexKey}},
+		{"sign with malformed JSON", "sign", []string{"-ticket", "{", "-key", aliceHexKey}},
+		{"sign without a key", "sign", []string{"-ticket", issued}},
+		{"sign with a malformed key", "sign", []string{"-ticket", issued, "-key", "0xzz"}},
+		{"sign with an unknown flag", "sign", []string{"-owner", "alice"}},
+		{"sign for a chain id too large", "sign", []string{"-ticket", issued, "-key", aliceHexKey, "-chain-id", "9223372036854775790"}},
+		{"verify with malformed JSON", "verify", []string{"-ticket", "{", "-prev", issued}},
+		{"verify with malformed previous JSON", "verify", []string{"-ticket", unsigned, "-prev", "{"}},
+		{"verify without a proof", "verify", []string{"-ticket", unsigned, "-prev", issued}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if output, err := runCommand(test.command, test.args...); err == nil {
+				t.Errorf("%v returned %q, want an error", test.command, output)
+			}
+		})
+	}
+}
+
+// writeDataDir leaves the data directory of a stopped node hashing with
+// hashStrategy, with a snapshot at heights 1 and 2, and returns it with the
+// root at each height
+func writeDataDir(t *testing.T, hashStrategy func() hash.Hash) (string, map[int64]string, func()) {
+	t.Helper()
+	dataDir, err := ioutil.TempDir("", "tendermint-exp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := ticketstore.OpenTicketStoreApplication(dataDir, ticketstore.WithHashStrategy(hashStrategy), ticketstore.WithSnapshotInterval(1))
+	if err != nil {
+		os.RemoveAll(dataDir)
+		t.Fatal(err)
+	}
+	roots := make(map[int64]string)
+	for id := uint64(1); id <= 2; id++ {
+		ticket := ticketstore.TicketTx{Id: id, Nonce: 1, OwnerAddr: hexKeyAddress(t, aliceHexKey)}
+		if response := app.DeliverTx(types.RequestDeliverTx{Tx: []byte(mustJSON(t, ticket))}); response.Code != codes.OK {
+			t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+		}
+		roots[int64(id)] = hexutil.Encode(app.Commit().Data)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dataDir, roots, func() { os.RemoveAll(dataDir) }
+}
+
+func TestSnapshotsCommandHashStrategy(t *testing.T) {
+	dataDir, roots, cleanup := writeDataDir(t, ticketstore.Keccak256)
+	defer cleanup()
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		fails bool
+	}{
+		{"strategy flag", nil, []string{"-data-dir", dataDir, "-hash-strategy", "keccak256"}, false},
+		{"strategy and data directory from the node's env",
+			map[string]string{"ABCI_HASH_STRATEGY": "keccak256", "ABCI_DATA_DIR": dataDir}, nil, false},
+		{"default strategy differs from the node's", nil, []string{"-data-dir", dataDir}, true},
+		{"flag over the env", map[string]string{"ABCI_HASH_STRATEGY": "keccak256"}, []string{"-data-dir", dataDir, "-hash-strategy", "sha256"}, true},
+		{"unknown strategy", nil, []string{"-data-dir", dataDir, "-hash-strategy", "md5"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := runCommandWithEnv("snapshots", test.env, test.args...)
+			if (err != nil) != test.fails {
+				t.Fatalf("snapshots returned %v, want failure %v", err, test.fails)
+			}
+			if test.fails {
+				return
+			}
+			var layout ticketstore.DataDirLayout
+			if err := json.Unmarshal([]byte(output), &layout); err != nil {
+				t.Fatalf("snapshots printed %s: %v", output, err)
+			}
+			if len(layout.Snapshots) != 2 {
+				t.Fatalf("snapshots listed %+v, want heights 1 and 2", layout.Snapshots)
+			}
+			for _, snapshot := range layout.Snapshots {
+				if snapshot.RootHash != roots[snapshot.Height] {
+					t.Errorf("Snapshot at height %v has root %v, want %v", snapshot.Height, snapshot.RootHash, roots[snapshot.Height])
+				}
+			}
+			if layout.State == nil || layout.State.Height != 2 || layout.State.RootHash != roots[2] {
+				t.Errorf("snapshots listed state %+v, want height 2 with root %v", layout.State, roots[2])
+			}
+		})
+	}
+}
+
+func TestRestoreCommandHashStrategy(t *testing.T) {
+	source, roots, cleanup := writeDataDir(t, ticketstore.Keccak256)
+	defer cleanup()
+	snapshot := filepath.Join(source, "snapshots", "1.json")
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		fails bool
+	}{
+		{"strategy flag", nil, []string{"-hash-strategy", "keccak256"}, false},
+		{"strategy from the node's env", map[string]string{"ABCI_HASH_STRATEGY": "keccak256"}, nil, false},
+		{"default strategy differs from the node's", nil, nil, true},
+		{"unknown strategy", nil, []string{"-hash-strategy", "md5"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, err := ioutil.TempDir("", "tendermint-exp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dataDir)
+
+			args := append([]string{"-from", snapshot, "-data-dir", dataDir}, test.args...)
+			output, err := runCommandWithEnv("restore", test.env, args...)
+			if (err != nil) != test.fails {
+				t.Fatalf("restore returned %v, want failure %v", err, test.fails)
+			}
+			if test.fails {
+				// Nothing is written when the root does not match
+				if files, _ := ioutil.ReadDir(dataDir); len(files) != 0 {
+					t.Errorf("Failed restore left %v files in the data directory", len(files))
+				}
+				return
+			}
+			var restored ticketstore.StoredState
+			if err := json.Unmarshal([]byte(output), &restored); err != nil {
+				t.Fatalf("restore printed %s: %v", output, err)
+			}
+			if restored.Height != 1 || restored.RootHash != roots[1] {
+				t.Errorf("restore printed height %v with root %v, want 1 with %v", restored.Height, restored.RootHash, roots[1])
+			}
+
+			// A node hashing as the source did opens at the snapshot's root
+			app, err := ticketstore.OpenTicketStoreApplication(dataDir, ticketstore.WithHashStrategy(ticketstore.Keccak256))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Close()
+			if info := app.Info(types.RequestInfo{}); hexutil.Encode(info.LastBlockAppHash) != roots[1] {
+				t.Errorf("Restored node has root %x, want %v", info.LastBlockAppHash, roots[1])
+			}
+		})
+	}
+}
+
+func TestRestoreNodeSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		interval int64
+		heights  int64
+		restore  int64
+	}{
+		{"sha256 every height", "sha256", 1, 3, 3},
+		{"keccak256 every other height", "keccak256", 2, 5, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := ioutil.TempDir("", "tendermint-exp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(source)
+			target, err := ioutil.TempDir("", "tendermint-exp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(target)
+
+			// The node is configured as the server would be from its flags
+			cfg, err := loadConfig([]string{"-data-dir", source, "-hash-strategy", test.strategy,
+				"-snapshot-interval", fmt.Sprint(test.interval)}, func(string) string { return "" })
+			if err != nil {
+				t.Fatal(err)
+			}
+			appConfig, err := newAppConfig(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			node, err := apps.New(cfg.App, appConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots := make(map[int64]string)
+			for height := int64(1); height <= test.heights; height++ {
+				ticket := ticketstore.TicketTx{Id: uint64(height), Nonce: 1, OwnerAddr: hexKeyAddress(t, aliceHexKey)}
+				node.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: height}})
+				if response := node.DeliverTx(types.RequestDeliverTx{Tx: []byte(mustJSON(t, ticket))}); response.Code != codes.OK {
+					t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+				}
+				node.EndBlock(types.RequestEndBlock{Height: height})
+				roots[height] = hexutil.Encode(node.Commit().Data)
+			}
+			if err := node.(io.Closer).Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The snapshot to restore is the latest one snapshots lists
+			output, err := runCommand("snapshots", "-data-dir", source, "-hash-strategy", test.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var layout ticketstore.DataDirLayout
+			if err := json.Unmarshal([]byte(output), &layout); err != nil {
+				t.Fatalf("snapshots printed %s: %v", output, err)
+			}
+			if len(layout.Snapshots) == 0 {
+				t.Fatalf("Node wrote no snapshots")
+			}
+			snapshot := layout.Snapshots[len(layout.Snapshots)-1]
+			if snapshot.Height != test.restore {
+				t.Fatalf("Latest snapshot is at height %v, want %v", snapshot.Height, test.restore)
+			}
+
+			output, err = runCommand("restore", "-from", snapshot.Path, "-data-dir", target, "-hash-strategy", test.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var restored ticketstore.StoredState
+			if err := json.Unmarshal([]byte(output), &restored); err != nil {
+				t.Fatalf("restore printed %s: %v", output, err)
+			}
+			if restored.Height != test.restore || restored.RootHash != roots[test.restore] {
+				t.Errorf("restore printed height %v with root %v, want %v with %v", restored.Height, restored.RootHash, test.restore, roots[test.restore])
+			}
+
+			// A node opened on the restored directory resumes at the snapshot
+			appConfig.DataDir = target
+			restoredNode, err := apps.New(cfg.App, appConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer restoredNode.(io.Closer).Close()
+			info := restoredNode.Info(types.RequestInfo{})
+			if info.LastBlockHeight != test.restore || hexutil.Encode(info.LastBlockAppHash) != roots[test.restore] {
+				t.Errorf("Restored node is at height %v with root %x, want %v with %v", info.LastBlockHeight, info.LastBlockAppHash, test.restore, roots[test.restore])
+			}
+		})
+	}
+}
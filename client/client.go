@@ -0,0 +1,186 @@
+// Package client submits and queries tickets through a Tendermint node's
+// JSON-RPC endpoint.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// AppError is a non-zero response code returned by the application
+type AppError struct {
+	Code uint32
+	Log  string
+}
+
+func (err AppError) Error() string {
+	return fmt.Sprintf("Application returned code %v (%v): %v", err.Code, codes.CodeString(err.Code), err.Log)
+}
+
+// Client talks to the RPC endpoint of a node running the ticket store, for
+// example http://localhost:26657
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	// querier answers queries in process when set, in place of abci_query
+	querier Querier
+}
+
+// Querier answers ABCI queries in process, giving up once ctx is done.
+// *ticketstore.TicketStoreApplication is one
+type Querier interface {
+	QueryContext(ctx context.Context, reqQuery types.RequestQuery) types.ResponseQuery
+}
+
+func New(endpoint string) *Client {
+	return &Client{endpoint: endpoint, httpClient: http.DefaultClient}
+}
+
+// NewLocal is a client for a node whose application runs in this process.
+// Queries go straight to querier with the caller's context, so a query whose
+// caller gives up stops rather than running to completion behind an RPC
+// call. Txs are still broadcast through endpoint to reach the mempool
+func NewLocal(endpoint string, querier Querier) *Client {
+	return &Client{endpoint: endpoint, httpClient: http.DefaultClient, querier: querier}
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      string      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+func (err rpcError) Error() string {
+	return fmt.Sprintf("RPC error %v: %v %v", err.Code, err.Message, err.Data)
+}
+
+type broadcastResult struct {
+	Code uint32 `json:"code"`
+	Log  string `json:"log"`
+	Hash string `json:"hash"`
+}
+
+type queryResult struct {
+	Response struct {
+		Code  uint32 `json:"code"`
+		Log   string `json:"log"`
+		Value []byte `json:"value"`
+	} `json:"response"`
+}
+
+// SubmitTicket broadcasts ticket and waits for CheckTx, returning the hash of
+// the transaction once the mempool accepts it
+func (c *Client) SubmitTicket(ctx context.Context, ticket ticketstore.TicketTx) (string, error) {
+	tx, err := ticket.CanonicalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	var result broadcastResult
+	if err := c.call(ctx, "broadcast_tx_sync", map[string]interface{}{"tx": tx}, &result); err != nil {
+		return "", err
+	}
+	if result.Code != 0 {
+		return "", AppError{Code: result.Code, Log: result.Log}
+	}
+	return result.Hash, nil
+}
+
+// GetTicket returns the latest version of ticket id with its Merkle proof
+func (c *Client) GetTicket(ctx context.Context, id uint64) (ticketstore.TicketResponse, error) {
+	var response ticketstore.TicketResponse
+	err := c.query(ctx, "ticket", []byte(fmt.Sprint(id)), &response)
+	return response, err
+}
+
+// GetTickets returns the latest version of each of ids with its Merkle proof,
+// in the same order. Tickets that do not exist are nil
+func (c *Client) GetTickets(ctx context.Context, ids []uint64) ([]*ticketstore.TicketResponse, error) {
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	var responses []*ticketstore.TicketResponse
+	err = c.query(ctx, "tickets", data, &responses)
+	return responses, err
+}
+
+// GetByOwner returns every ticket held by addr
+func (c *Client) GetByOwner(ctx context.Context, addr string) ([]ticketstore.Ticket, error) {
+	var tickets []ticketstore.Ticket
+	err := c.query(ctx, "owner", []byte(addr), &tickets)
+	return tickets, err
+}
+
+// Syncing reports whether the application is still catching up with the chain
+func (c *Client) Syncing(ctx context.Context) (ticketstore.SyncingResponse, error) {
+	var response ticketstore.SyncingResponse
+	err := c.query(ctx, "syncing", nil, &response)
+	return response, err
+}
+
+// query runs an abci_query, or the in-process query when the client has a
+// querier, and decodes the JSON value into v
+func (c *Client) query(ctx context.Context, path string, data []byte, v interface{}) error {
+	var result queryResult
+	if c.querier != nil {
+		response := c.querier.QueryContext(ctx, types.RequestQuery{Path: path, Data: data})
+		result.Response.Code, result.Response.Log, result.Response.Value = response.Code, response.Log, response.Value
+	} else {
+		params := map[string]interface{}{"path": path, "data": hex.EncodeToString(data)}
+		if err := c.call(ctx, "abci_query", params, &result); err != nil {
+			return err
+		}
+	}
+	if result.Response.Code != 0 {
+		return AppError{Code: result.Response.Code, Log: result.Response.Log}
+	}
+	return json.Unmarshal(result.Response.Value, v)
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: "tendermint-exp", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return *response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+const (
+	alice = "0x90f8bf6a479f320ead074411a4b0e7944ea8c9c1"
+	bob   = "0xffcf8fdee72ac11b5c542428b35eef5769c409f0"
+)
+
+// newNode serves the parts of Tendermint's JSON-RPC the client uses from app.
+// A tx the mempool accepts is committed in a block of its own straight away.
+// The caller must close it
+func newNode(t *testing.T, app *ticketstore.TicketStoreApplication) *httptest.Server {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Node received %v", err)
+			return
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "broadcast_tx_sync":
+			var params struct {
+				Tx []byte `json:"tx"`
+			}
+			json.Unmarshal(request.Params, &params)
+			response := app.CheckTx(types.RequestCheckTx{Tx: params.Tx})
+			if response.Code == codes.OK {
+				app.DeliverTx(types.RequestDeliverTx{Tx: params.Tx})
+				app.Commit()
+			}
+			hash := sha256.Sum256(params.Tx)
+			result = map[string]interface{}{"code": response.Code, "log": response.Log, "hash": strings.ToUpper(hex.EncodeToString(hash[:]))}
+		case "abci_query":
+			var params struct {
+				Path string `json:"path"`
+				Data string `json:"data"`
+			}
+			json.Unmarshal(request.Params, &params)
+			data, _ := hex.DecodeString(params.Data)
+			result = map[string]interface{}{"response": app.Query(types.RequestQuery{Path: params.Path, Data: data})}
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": rpcError{Code: -32601, Message: "Method not found"}})
+			return
+		}
+		encoded, _ := json.Marshal(result)
+		json.NewEncoder(w).Encode(rpcResponse{Result: encoded})
+	}))
+	return node
+}
+
+func TestSubmitTicket(t *testing.T) {
+	tests := []struct {
+		name   string
+		ticket ticketstore.TicketTx
+		code   uint32
+	}{
+		{"new ticket", ticketstore.TicketTx{Id: 1, Nonce: 1, Details: "Seat 1", OwnerAddr: alice}, codes.OK},
+		{"zero id", ticketstore.TicketTx{Id: 0, Nonce: 1, OwnerAddr: alice}, codes.TicketError},
+		{"bad owner", ticketstore.TicketTx{Id: 1, Nonce: 1, OwnerAddr: "alice"}, codes.TicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := ticketstore.NewTicketStoreApplication()
+			node := newNode(t, app)
+			defer node.Close()
+			c := New(node.URL)
+
+			hash, err := c.SubmitTicket(context.Background(), test.ticket)
+			if test.code == codes.OK {
+				if err != nil || len(hash) != 64 {
+					t.Fatalf("SubmitTicket returned %q, %v", hash, err)
+				}
+				response, err := c.GetTicket(context.Background(), test.ticket.Id)
+				if err != nil || response.Ticket.TicketTx != test.ticket {
+					t.Errorf("GetTicket returned %+v, %v, want %+v", response.Ticket.TicketTx, err, test.ticket)
+				}
+				return
+			}
+			appErr, ok := err.(AppError)
+			if !ok || appErr.Code != test.code || appErr.Log == "" {
+				t.Errorf("SubmitTicket returned %v, want an AppError with code %v", err, test.code)
+			}
+		})
+	}
+}
+
+func TestQueries(t *testing.T) {
+	app := ticketstore.NewTicketStoreApplication()
+	node := newNode(t, app)
+	defer node.Close()
+	for id, owner := range []string{alice, bob, alice} {
+		ticket := ticketstore.TicketTx{Id: uint64(id + 1), Nonce: 1, Details: fmt.Sprintf("Seat %v", id+1), OwnerAddr: owner}
+		if _, err := New(node.URL).SubmitTicket(context.Background(), ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A local client answers queries from the app without the node's RPC
+	clients := []struct {
+		name string
+		c    *Client
+	}{
+		{"rpc", New(node.URL)},
+		{"local", NewLocal(node.URL, app)},
+	}
+	for _, test := range clients {
+		c := test.c
+		t.Run(test.name, func(t *testing.T) {
+
+			t.Run("GetTicket of a missing ticket", func(t *testing.T) {
+				_, err := c.GetTicket(context.Background(), 9)
+				if appErr, ok := err.(AppError); !ok || appErr.Code != codes.NotFound {
+					t.Errorf("GetTicket returned %v, want code %v", err, codes.NotFound)
+				}
+			})
+			t.Run("GetTickets", func(t *testing.T) {
+				responses, err := c.GetTickets(context.Background(), []uint64{3, 9, 1})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(responses) != 3 || responses[0].Ticket.Id != 3 || responses[1] != nil || responses[2].Ticket.Id != 1 {
+					t.Errorf("GetTickets returned %+v, want tickets 3, nil and 1", responses)
+				}
+			})
+			t.Run("GetByOwner", func(t *testing.T) {
+				tickets, err := c.GetByOwner(context.Background(), alice)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []uint64
+				for _, ticket := range tickets {
+					ids = append(ids, ticket.Id)
+				}
+				if !reflect.DeepEqual(ids, []uint64{1, 3}) {
+					t.Errorf("GetByOwner returned tickets %v, want [1 3]", ids)
+				}
+			})
+			t.Run("Syncing", func(t *testing.T) {
+				response, err := c.Syncing(context.Background())
+				if err != nil || response.Height != 3 {
+					t.Errorf("Syncing returned %+v, %v, want height 3", response, err)
+				}
+			})
+		})
+	}
+}
+
+func TestLocalQueryCancelled(t *testing.T) {
+	app := ticketstore.NewTicketStoreApplication()
+	for id := uint64(1); id <= 3; id++ {
+		app.DeliverTx(types.RequestDeliverTx{Tx: []byte(fmt.Sprintf(`{"id":%v,"nonce":1,"details":"","ownerAddr":"%v"}`, id, alice))})
+	}
+	app.Commit()
+	// No node is running, so only the in-process query can answer
+	c := NewLocal("http://127.0.0.1:0", app)
+
+	tests := []struct {
+		name  string
+		query func(ctx context.Context) error
+	}{
+		{"GetTickets", func(ctx context.Context) error {
+			_, err := c.GetTickets(ctx, []uint64{1, 2, 3})
+			return err
+		}},
+		{"GetByOwner", func(ctx context.Context) error {
+			_, err := c.GetByOwner(ctx, alice)
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.query(context.Background()); err != nil {
+				t.Fatalf("%v returned %v", test.name, err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if appErr, ok := test.query(ctx).(AppError); !ok || appErr.Code != codes.Cancelled {
+				t.Errorf("%v with an abandoned context returned %v, want code %v", test.name, appErr, codes.Cancelled)
+			}
+		})
+	}
+}
+
+func TestRPCError(t *testing.T) {
+	app := ticketstore.NewTicketStoreApplication()
+	node := newNode(t, app)
+	defer node.Close()
+	c := New(node.URL)
+	var result interface{}
+	err := c.call(context.Background(), "status", nil, &result)
+	if rpcErr, ok := err.(rpcError); !ok || rpcErr.Code != -32601 {
+		t.Errorf("call returned %v, want the RPC error", err)
+	}
+}
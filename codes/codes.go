@@ -0,0 +1,54 @@
+// Package codes names the response codes the ABCI applications return from
+// CheckTx, DeliverTx and Query, so clients can interpret them.
+package codes
+
+import "fmt"
+
+const (
+	OK                uint32 = 0
+	EncodingError     uint32 = 1
+	TicketError       uint32 = 2
+	NotFound          uint32 = 3
+	DetailsError      uint32 = 4
+	UnknownPath       uint32 = 5
+	HeightUnavailable uint32 = 6
+	RateLimited       uint32 = 7
+	Duplicate         uint32 = 8
+	SupplyExhausted   uint32 = 9
+	InternalError     uint32 = 10
+	Unauthorized      uint32 = 11
+	Unhealthy         uint32 = 12
+	Cancelled         uint32 = 13
+	NoTickets         uint32 = 14
+	Expired           uint32 = 15
+	SelfTransfer      uint32 = 16
+)
+
+// Descriptions describes every response code
+var Descriptions = map[uint32]string{
+	OK:                "OK",
+	EncodingError:     "Transaction or query data could not be decoded",
+	TicketError:       "Ticket failed validation",
+	NotFound:          "Ticket could not be found",
+	DetailsError:      "Ticket details are not valid UTF-8 within the maximum length",
+	UnknownPath:       "Query path is not supported",
+	HeightUnavailable: "State at the requested height is not available",
+	RateLimited:       "Ticket has reached its transfer limit for this block",
+	Duplicate:         "Ticket is identical to the stored version",
+	SupplyExhausted:   "No more tickets can be issued",
+	InternalError:     "Application failed processing the transaction",
+	Unauthorized:      "Signer is not authorized",
+	Unhealthy:         "Application state is inconsistent",
+	Cancelled:         "Query stopped before it finished",
+	NoTickets:         "No tickets have been committed at the requested height",
+	Expired:           "Ticket transfer was submitted after its deadline",
+	SelfTransfer:      "Ticket is already held by the new owner",
+}
+
+// CodeString describes code, or reports it as unknown
+func CodeString(code uint32) string {
+	if description, ok := Descriptions[code]; ok {
+		return description
+	}
+	return fmt.Sprintf("Unknown code %v", code)
+}
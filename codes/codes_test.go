@@ -0,0 +1,50 @@
+package codes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDescriptions(t *testing.T) {
+	// Codes are numbered from OK without gaps, so the highest code bounds
+	// the ones that must be described
+	highest := OK
+	for code := range Descriptions {
+		if code > highest {
+			highest = code
+		}
+	}
+	if int(highest) != len(Descriptions)-1 {
+		t.Errorf("Descriptions has %v codes up to %v, want no gaps", len(Descriptions), highest)
+	}
+
+	seen := make(map[string]uint32)
+	for code := OK; code <= highest; code++ {
+		description := CodeString(code)
+		if description == "" || strings.HasPrefix(description, "Unknown code") {
+			t.Errorf("Code %v has no description", code)
+		}
+		if other, ok := seen[description]; ok {
+			t.Errorf("Codes %v and %v are both described as %q", other, code, description)
+		}
+		seen[description] = code
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	tests := []struct {
+		code uint32
+		want string
+	}{
+		{OK, "OK"},
+		{TicketError, "Ticket failed validation"},
+		{SelfTransfer, "Ticket is already held by the new owner"},
+		{SelfTransfer + 1, "Unknown code 17"},
+		{1 << 31, "Unknown code 2147483648"},
+	}
+	for _, test := range tests {
+		if got := CodeString(test.code); got != test.want {
+			t.Errorf("CodeString(%v) returned %q, want %q", test.code, got, test.want)
+		}
+	}
+}
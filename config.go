@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ArtosSystems/tendermint-exp/apps"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// config is how the server is run. Each setting is taken from its flag when
+// given, then from its environment variable if it has one, and otherwise
+// from its default
+type config struct {
+	App               string
+	Address           string
+	Transport         string
+	DataDir           string
+	HashStrategy      string
+	SnapshotInterval  int64
+	FlushInterval     int64
+	CheckTxCache      int
+	ChainId           uint64
+	Validators        string
+	ValidatorMaxPower int64
+	DropProofs        bool
+	MetricsAddress    string
+	GatewayAddress    string
+	RPCEndpoint       string
+	DebugQueries      bool
+	RetainHeights     int64
+	TLSCert           string
+	TLSKey            string
+	StartRetries      int
+	AuditFile         string
+	AuditMaxBytes     int
+	AuditRate         int
+}
+
+// envVars names the environment variable that can set each flag
+var envVars = map[string]string{
+	"app":                 "ABCI_APP",
+	"address":             "ABCI_ADDRESS",
+	"transport":           "ABCI_TRANSPORT",
+	"data-dir":            "ABCI_DATA_DIR",
+	"hash-strategy":       "ABCI_HASH_STRATEGY",
+	"snapshot-interval":   "ABCI_SNAPSHOT_INTERVAL",
+	"flush-interval":      "ABCI_FLUSH_INTERVAL",
+	"check-tx-cache":      "ABCI_CHECK_TX_CACHE",
+	"chain-id":            "ABCI_CHAIN_ID",
+	"validators":          "ABCI_VALIDATORS",
+	"validator-max-power": "ABCI_VALIDATOR_MAX_POWER",
+	"drop-proofs":         "ABCI_DROP_PROOFS",
+}
+
+// loadConfig reads the configuration from the command line arguments in args
+// and the environment as seen through getenv, and validates it
+func loadConfig(args []string, getenv func(string) string) (config, error) {
+	var cfg config
+	flags := flag.NewFlagSet("tendermint-exp", flag.ContinueOnError)
+	flags.StringVar(&cfg.App, "app", "ticketstore", fmt.Sprintf("Application to serve, one of %v. Also set by ABCI_APP", strings.Join(apps.Names(), ", ")))
+	flags.StringVar(&cfg.Address, "address", "tcp://0.0.0.0:26658", "Address the ABCI server listens on. Also set by ABCI_ADDRESS")
+	flags.StringVar(&cfg.Transport, "transport", "socket", "ABCI transport, either socket or grpc. Also set by ABCI_TRANSPORT")
+	flags.StringVar(&cfg.DataDir, "data-dir", "", "Directory the application keeps its state in. State is kept in memory only when empty. Also set by ABCI_DATA_DIR")
+	hashStrategyFlag(flags, &cfg.HashStrategy)
+	flags.Int64Var(&cfg.SnapshotInterval, "snapshot-interval", 0, "Heights between the snapshots written to -data-dir, of which the latest two are kept. Zero writes none. Also set by ABCI_SNAPSHOT_INTERVAL")
+	flags.Int64Var(&cfg.FlushInterval, "flush-interval", 0, "Commits between writes of the state file in -data-dir, logging each commit in between. Zero writes it only on shutdown. Also set by ABCI_FLUSH_INTERVAL")
+	flags.IntVar(&cfg.CheckTxCache, "check-tx-cache", 0, "CheckTx results to cache until the next commit. Zero caches none. Also set by ABCI_CHECK_TX_CACHE")
+	flags.Uint64Var(&cfg.ChainId, "chain-id", 0, "EIP-155 chain id signatures may be bound to, alongside legacy 27/28 recovery ids. Zero accepts only legacy ones. Also set by ABCI_CHAIN_ID")
+	flags.StringVar(&cfg.Validators, "validators", "", "Comma separated address=pubkey pairs of the owners whose tickets give voting power to the hex ed25519 validator key. Also set by ABCI_VALIDATORS")
+	flags.Int64Var(&cfg.ValidatorMaxPower, "validator-max-power", 0, "Voting power a -validators entry may have at most. Zero means no cap. Also set by ABCI_VALIDATOR_MAX_POWER")
+	flags.BoolVar(&cfg.DropProofs, "drop-proofs", false, "Store each ticket's leaf in place of its ownership proof to shrink the state. Resales under the eip712 scheme are then rejected. Also set by ABCI_DROP_PROOFS")
+	flags.StringVar(&cfg.MetricsAddress, "metrics-address", "", "Address to serve Prometheus metrics on, for example :26660. Disabled when empty")
+	flags.StringVar(&cfg.GatewayAddress, "gateway-address", "", "Address to serve the REST gateway on, for example :8080. Disabled when empty")
+	flags.StringVar(&cfg.RPCEndpoint, "rpc-endpoint", "http://localhost:26657", "Tendermint RPC endpoint the REST gateway forwards to")
+	flags.BoolVar(&cfg.DebugQueries, "debug-queries", false, "Answer the tree query, which returns the whole Merkle tree. Not for production")
+	flags.Int64Var(&cfg.RetainHeights, "retain-heights", 0, "Latest heights whose state queries can read, older ones are pruned. Zero keeps every height")
+	flags.StringVar(&cfg.TLSCert, "tls-cert", "", "Certificate file to serve ABCI over TLS with. Plain TCP is used when empty")
+	flags.StringVar(&cfg.TLSKey, "tls-key", "", "Private key file for -tls-cert")
+	flags.StringVar(&cfg.AuditFile, "audit-file", "", "File to append rejected txs and their codes to. Disabled when empty")
+	flags.IntVar(&cfg.AuditMaxBytes, "audit-max-bytes", 1024, "Bytes of each rejected tx to keep in -audit-file. Zero keeps them all")
+	flags.IntVar(&cfg.AuditRate, "audit-rate", 10, "Rejected txs to write to -audit-file a second at most. Zero means no limit")
+	flags.IntVar(&cfg.StartRetries, "start-retries", 0, "Times to retry starting the ABCI server, waiting twice as long each time from one second")
+
+	if err := parseFlags(flags, args, getenv); err != nil {
+		return config{}, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+// hashStrategyFlag defines the -hash-strategy flag, which the server and the
+// subcommands reading its data directory must agree on
+func hashStrategyFlag(flags *flag.FlagSet, strategy *string) {
+	flags.StringVar(strategy, "hash-strategy", "sha256", fmt.Sprintf("Hash of the ticket tree's parent nodes, one of %v. Every node on a chain must use the same. Also set by ABCI_HASH_STRATEGY", strings.Join(ticketstore.HashStrategyNames(), ", ")))
+}
+
+// parseFlags parses args into flags after setting each flag that has an
+// environment variable from getenv. The environment replaces the defaults
+// before the arguments are parsed, so a flag on the command line still takes
+// precedence
+func parseFlags(flags *flag.FlagSet, args []string, getenv func(string) string) error {
+	for name, envVar := range envVars {
+		if flags.Lookup(name) == nil {
+			continue
+		}
+		if value := getenv(envVar); value != "" {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("Invalid %v: %v", envVar, err)
+			}
+		}
+	}
+	return flags.Parse(args)
+}
+
+func (cfg config) validate() error {
+	if err := validateTransport(cfg.Transport); err != nil {
+		return err
+	}
+	if _, err := ticketstore.HashStrategyNamed(cfg.HashStrategy); err != nil {
+		return err
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return fmt.Errorf("Both -tls-cert and -tls-key must be given to enable TLS")
+	}
+	if cfg.StartRetries < 0 {
+		return fmt.Errorf("Invalid start retries. Expected zero or more, got %v", cfg.StartRetries)
+	}
+	if cfg.SnapshotInterval < 0 {
+		return fmt.Errorf("Invalid snapshot interval. Expected zero or more, got %v", cfg.SnapshotInterval)
+	}
+	if cfg.FlushInterval < 0 || cfg.CheckTxCache < 0 {
+		return fmt.Errorf("Invalid flush interval or CheckTx cache. Expected zero or more, got %v and %v", cfg.FlushInterval, cfg.CheckTxCache)
+	}
+	if cfg.ChainId > ticketstore.MaxChainId {
+		return fmt.Errorf("Invalid chain id. Expected at most %v, got %v", uint64(ticketstore.MaxChainId), cfg.ChainId)
+	}
+	if _, err := parseValidators(cfg.Validators); err != nil {
+		return err
+	}
+	if cfg.ValidatorMaxPower < 0 {
+		return fmt.Errorf("Invalid validator max power. Expected zero or more, got %v", cfg.ValidatorMaxPower)
+	}
+	if cfg.RetainHeights < 0 {
+		return fmt.Errorf("Invalid retain heights. Expected zero or more, got %v", cfg.RetainHeights)
+	}
+	if cfg.AuditMaxBytes < 0 || cfg.AuditRate < 0 {
+		return fmt.Errorf("Invalid audit limits. Expected zero or more, got %v bytes and %v a second", cfg.AuditMaxBytes, cfg.AuditRate)
+	}
+	return nil
+}
+
+// parseValidators reads -validators, a comma separated list of
+// address=pubkey pairs, into the map of owner address to hex ed25519 public
+// key that WithValidatorHoldings takes. An empty list has no validators
+func parseValidators(list string) (map[string][]byte, error) {
+	validators := make(map[string][]byte)
+	if list == "" {
+		return validators, nil
+	}
+	for _, pair := range strings.Split(list, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "0x") || !common.IsHexAddress(parts[0]) {
+			return nil, fmt.Errorf("Invalid validator. Expected address=pubkey, got %v", pair)
+		}
+		pubKey, err := hexutil.Decode(parts[1])
+		if err != nil || len(pubKey) != ed25519PubKeySize {
+			return nil, fmt.Errorf("Invalid validator public key. Expected %v hex bytes, got %v", ed25519PubKeySize, parts[1])
+		}
+		addr := strings.ToLower(parts[0])
+		if _, ok := validators[addr]; ok {
+			return nil, fmt.Errorf("Validator %v is given more than once", parts[0])
+		}
+		validators[addr] = pubKey
+	}
+	return validators, nil
+}
+
+// ed25519PubKeySize is the length of the validator keys Tendermint accepts
+const ed25519PubKeySize = 32
+
+func validateTransport(transport string) error {
+	switch transport {
+	case "socket", "grpc":
+		return nil
+	default:
+		return fmt.Errorf("Invalid transport. Expected socket or grpc, got %v", transport)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigRetainHeights(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		want  int64
+		fails bool
+	}{
+		{"default keeps every height", nil, 0, false},
+		{"flag", []string{"-retain-heights", "100"}, 100, false},
+		{"negative", []string{"-retain-heights", "-1"}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(string) string { return "" })
+			if (err != nil) != test.fails {
+				t.Fatalf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+			if cfg.RetainHeights != test.want {
+				t.Errorf("RetainHeights is %v, want %v", cfg.RetainHeights, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigStartRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		want  int
+		fails bool
+	}{
+		{"default fails on the first attempt", nil, 0, false},
+		{"flag", []string{"-start-retries", "3"}, 3, false},
+		{"negative", []string{"-start-retries", "-1"}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(string) string { return "" })
+			if (err != nil) != test.fails {
+				t.Fatalf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+			if cfg.StartRetries != test.want {
+				t.Errorf("StartRetries is %v, want %v", cfg.StartRetries, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHashStrategy(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		want  string
+		fails bool
+	}{
+		{"default", nil, nil, "sha256", false},
+		{"flag", nil, []string{"-hash-strategy", "keccak256"}, "keccak256", false},
+		{"env", map[string]string{"ABCI_HASH_STRATEGY": "keccak256"}, nil, "keccak256", false},
+		{"flag over env", map[string]string{"ABCI_HASH_STRATEGY": "keccak256"}, []string{"-hash-strategy", "sha256"}, "sha256", false},
+		{"unknown flag", nil, []string{"-hash-strategy", "md5"}, "", true},
+		{"unknown env", map[string]string{"ABCI_HASH_STRATEGY": "md5"}, nil, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(name string) string { return test.env[name] })
+			if (err != nil) != test.fails {
+				t.Fatalf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+			if cfg.HashStrategy != test.want {
+				t.Errorf("HashStrategy is %q, want %q", cfg.HashStrategy, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSnapshotInterval(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		want  int64
+		fails bool
+	}{
+		{"default writes none", nil, nil, 0, false},
+		{"flag", nil, []string{"-snapshot-interval", "100"}, 100, false},
+		{"env", map[string]string{"ABCI_SNAPSHOT_INTERVAL": "50"}, nil, 50, false},
+		{"flag over env", map[string]string{"ABCI_SNAPSHOT_INTERVAL": "50"}, []string{"-snapshot-interval", "100"}, 100, false},
+		{"negative", nil, []string{"-snapshot-interval", "-1"}, 0, true},
+		{"malformed env", map[string]string{"ABCI_SNAPSHOT_INTERVAL": "often"}, nil, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(name string) string { return test.env[name] })
+			if (err != nil) != test.fails {
+				t.Fatalf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+			if cfg.SnapshotInterval != test.want {
+				t.Errorf("SnapshotInterval is %v, want %v", cfg.SnapshotInterval, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAppOptions(t *testing.T) {
+	const validator = "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23=0x" + "0101010101010101010101010101010101010101010101010101010101010101"
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		want  config
+		fails bool
+	}{
+		{"defaults", nil, nil, config{}, false},
+		{"flags",
+			nil,
+			[]string{"-flush-interval", "10", "-check-tx-cache", "1000", "-chain-id", "1337", "-validators", validator, "-validator-max-power", "5", "-drop-proofs"},
+			config{FlushInterval: 10, CheckTxCache: 1000, ChainId: 1337, Validators: validator, ValidatorMaxPower: 5, DropProofs: true}, false},
+		{"env",
+			map[string]string{"ABCI_FLUSH_INTERVAL": "10", "ABCI_CHECK_TX_CACHE": "1000", "ABCI_CHAIN_ID": "137", "ABCI_VALIDATORS": validator, "ABCI_VALIDATOR_MAX_POWER": "5", "ABCI_DROP_PROOFS": "true"},
+			nil,
+			config{FlushInterval: 10, CheckTxCache: 1000, ChainId: 137, Validators: validator, ValidatorMaxPower: 5, DropProofs: true}, false},
+		{"flags over env",
+			map[string]string{"ABCI_FLUSH_INTERVAL": "10", "ABCI_CHAIN_ID": "137", "ABCI_DROP_PROOFS": "true"},
+			[]string{"-flush-interval", "1", "-chain-id", "1337", "-drop-proofs=false"},
+			config{FlushInterval: 1, ChainId: 1337}, false},
+		{"negative flush interval", nil, []string{"-flush-interval", "-1"}, config{}, true},
+		{"negative CheckTx cache", map[string]string{"ABCI_CHECK_TX_CACHE": "-1"}, nil, config{}, true},
+		{"chain id too large", nil, []string{"-chain-id", "18446744073709551615"}, config{}, true},
+		{"malformed validators", nil, []string{"-validators", "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"}, config{}, true},
+		{"negative validator max power", nil, []string{"-validator-max-power", "-1"}, config{}, true},
+		{"malformed drop proofs", map[string]string{"ABCI_DROP_PROOFS": "sometimes"}, nil, config{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(name string) string { return test.env[name] })
+			if (err != nil) != test.fails {
+				t.Fatalf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+			got := config{FlushInterval: cfg.FlushInterval, CheckTxCache: cfg.CheckTxCache, ChainId: cfg.ChainId,
+				Validators: cfg.Validators, ValidatorMaxPower: cfg.ValidatorMaxPower, DropProofs: cfg.DropProofs}
+			if got != test.want {
+				t.Errorf("loadConfig returned %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseValidators(t *testing.T) {
+	const (
+		alice = "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"
+		bob   = "0x90F8bf6A479f320ead074411a4B0e7944Ea8c9C1"
+	)
+	pubKey := func(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+	hexPubKey := func(b byte) string { return "0x" + strings.Repeat(fmt.Sprintf("%02x", b), 32) }
+	tests := []struct {
+		name string
+		list string
+		want map[string][]byte
+		err  string
+	}{
+		{"empty", "", map[string][]byte{}, ""},
+		{"one", alice + "=" + hexPubKey(1), map[string][]byte{alice: pubKey(1)}, ""},
+		{"checksummed address and spaces", alice + "=" + hexPubKey(1) + ", " + bob + "=" + hexPubKey(2),
+			map[string][]byte{alice: pubKey(1), strings.ToLower(bob): pubKey(2)}, ""},
+		{"no public key", alice, nil, "Invalid validator"},
+		{"address without 0x", alice[2:] + "=" + hexPubKey(1), nil, "Invalid validator"},
+		{"malformed address", "0x1234=" + hexPubKey(1), nil, "Invalid validator"},
+		{"short public key", alice + "=0x0101", nil, "Invalid validator public key"},
+		{"public key without 0x", alice + "=" + hexPubKey(1)[2:], nil, "Invalid validator public key"},
+		{"repeated address", alice + "=" + hexPubKey(1) + "," + "0x" + strings.ToUpper(alice[2:]) + "=" + hexPubKey(2), nil, "more than once"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validators, err := parseValidators(test.list)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("parseValidators returned %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(validators, test.want) {
+				t.Errorf("parseValidators returned %x, %v, want %x", validators, err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTLS(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		fails bool
+	}{
+		{"plain TCP", nil, false},
+		{"certificate and key", []string{"-tls-cert", "cert.pem", "-tls-key", "key.pem"}, false},
+		{"certificate without key", []string{"-tls-cert", "cert.pem"}, true},
+		{"key without certificate", []string{"-tls-key", "key.pem"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := loadConfig(test.args, func(string) string { return "" }); (err != nil) != test.fails {
+				t.Errorf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	defaults := config{App: "ticketstore", Address: "tcp://0.0.0.0:26658", Transport: "socket"}
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		want  config
+		fails bool
+	}{
+		{"defaults", nil, nil, defaults, false},
+		{"env only",
+			map[string]string{"ABCI_APP": "echo", "ABCI_ADDRESS": "tcp://127.0.0.1:1", "ABCI_TRANSPORT": "grpc", "ABCI_DATA_DIR": "/env"}, nil,
+			config{App: "echo", Address: "tcp://127.0.0.1:1", Transport: "grpc", DataDir: "/env"}, false},
+		{"flags only", nil,
+			[]string{"-app", "echo", "-address", "tcp://127.0.0.1:2", "-transport", "grpc", "-data-dir", "/flag"},
+			config{App: "echo", Address: "tcp://127.0.0.1:2", Transport: "grpc", DataDir: "/flag"}, false},
+		{"flags over env",
+			map[string]string{"ABCI_ADDRESS": "tcp://127.0.0.1:1", "ABCI_TRANSPORT": "grpc", "ABCI_DATA_DIR": "/env"},
+			[]string{"-address", "tcp://127.0.0.1:2", "-data-dir", "/flag"},
+			config{App: "ticketstore", Address: "tcp://127.0.0.1:2", Transport: "grpc", DataDir: "/flag"}, false},
+		{"empty env keeps the default", map[string]string{"ABCI_TRANSPORT": ""}, nil, defaults, false},
+		{"invalid env", map[string]string{"ABCI_TRANSPORT": "http"}, nil, config{}, true},
+		{"flag fixes an invalid env", map[string]string{"ABCI_TRANSPORT": "http"}, []string{"-transport", "socket"}, defaults, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(name string) string { return test.env[name] })
+			if (err != nil) != test.fails {
+				t.Fatalf("loadConfig returned %v, want failure %v", err, test.fails)
+			}
+			got := config{App: cfg.App, Address: cfg.Address, Transport: cfg.Transport, DataDir: cfg.DataDir}
+			if got != test.want {
+				t.Errorf("loadConfig returned %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Package gateway serves a small REST API over a node's JSON-RPC endpoint for
+// integrators that do not want to speak Tendermint RPC.
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ArtosSystems/tendermint-exp/client"
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+)
+
+// statusClientClosedRequest is nginx's status for a request the client gave
+// up on before it was answered. net/http has no constant for it
+const statusClientClosedRequest = 499
+
+// statusCodes maps ticket store response codes to HTTP statuses. Codes not
+// listed here are reported as 500
+var statusCodes = map[uint32]int{
+	codes.EncodingError:     http.StatusBadRequest,
+	codes.TicketError:       http.StatusUnprocessableEntity,
+	codes.NotFound:          http.StatusNotFound,
+	codes.DetailsError:      http.StatusUnprocessableEntity,
+	codes.UnknownPath:       http.StatusNotFound,
+	codes.HeightUnavailable: http.StatusGone,
+	codes.RateLimited:       http.StatusTooManyRequests,
+	codes.Duplicate:         http.StatusConflict,
+	codes.SupplyExhausted:   http.StatusUnprocessableEntity,
+	codes.Unauthorized:      http.StatusForbidden,
+	codes.NoTickets:         http.StatusNotFound,
+	codes.Expired:           http.StatusUnprocessableEntity,
+	codes.SelfTransfer:      http.StatusUnprocessableEntity,
+	codes.InternalError:     http.StatusInternalServerError,
+	codes.Unhealthy:         http.StatusServiceUnavailable,
+	codes.Cancelled:         statusClientClosedRequest,
+}
+
+type errorResponse struct {
+	Code  uint32 `json:"code,omitempty"`
+	Error string `json:"error"`
+}
+
+type submitResponse struct {
+	Hash string `json:"hash"`
+}
+
+// Gateway handles GET /ticket/{id}, GET /owner/{addr}, GET /ready and POST /ticket
+type Gateway struct {
+	client *client.Client
+	mux    *http.ServeMux
+}
+
+func New(c *client.Client) *Gateway {
+	gateway := &Gateway{client: c, mux: http.NewServeMux()}
+	gateway.mux.HandleFunc("/ticket", gateway.submitTicket)
+	gateway.mux.HandleFunc("/ticket/", gateway.getTicket)
+	gateway.mux.HandleFunc("/owner/", gateway.getByOwner)
+	gateway.mux.HandleFunc("/ready", gateway.getReady)
+	return gateway
+}
+
+func (gateway *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gateway.mux.ServeHTTP(w, r)
+}
+
+func (gateway *Gateway) submitTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, 0, "Expected POST")
+		return
+	}
+
+	var ticket ticketstore.TicketTx
+	if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
+		writeError(w, http.StatusBadRequest, 0, err.Error())
+		return
+	}
+	hash, err := gateway.client.SubmitTicket(r.Context(), ticket)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, submitResponse{Hash: hash})
+}
+
+func (gateway *Gateway) getTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, 0, "Expected GET")
+		return
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/ticket/"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 0, "Ticket id must be an unsigned integer")
+		return
+	}
+	response, err := gateway.client.GetTicket(r.Context(), id)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (gateway *Gateway) getByOwner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, 0, "Expected GET")
+		return
+	}
+
+	tickets, err := gateway.client.GetByOwner(r.Context(), strings.TrimPrefix(r.URL.Path, "/owner/"))
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tickets)
+}
+
+// getReady answers 503 while the application is catching up with the chain,
+// so its query results should not be trusted yet
+func (gateway *Gateway) getReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, 0, "Expected GET")
+		return
+	}
+
+	response, err := gateway.client.Syncing(r.Context())
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if response.Syncing {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
+
+// writeClientError reports application errors with their mapped status and
+// anything else, such as the node being unreachable, as a bad gateway
+func writeClientError(w http.ResponseWriter, err error) {
+	appErr, ok := err.(client.AppError)
+	if !ok {
+		writeError(w, http.StatusBadGateway, 0, err.Error())
+		return
+	}
+	status, ok := statusCodes[appErr.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeError(w, status, appErr.Code, appErr.Log)
+}
+
+func writeError(w http.ResponseWriter, status int, code uint32, msg string) {
+	writeJSON(w, status, errorResponse{Code: code, Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
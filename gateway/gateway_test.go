@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtosSystems/tendermint-exp/client"
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+const alice = "0x90f8bf6a479f320ead074411a4b0e7944ea8c9c1"
+
+// newNode serves the parts of Tendermint's JSON-RPC the client uses from app.
+// A tx the mempool accepts is committed in a block of its own, timed now, so
+// the application catches up with the first one. The caller must close it
+func newNode(t *testing.T, app *ticketstore.TicketStoreApplication) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Node received %v", err)
+			return
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "broadcast_tx_sync":
+			var params struct {
+				Tx []byte `json:"tx"`
+			}
+			json.Unmarshal(request.Params, &params)
+			response := app.CheckTx(types.RequestCheckTx{Tx: params.Tx})
+			if response.Code == codes.OK {
+				app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Time: time.Now()}})
+				app.DeliverTx(types.RequestDeliverTx{Tx: params.Tx})
+				app.Commit()
+			}
+			result = map[string]interface{}{"code": response.Code, "log": response.Log, "hash": "AB12"}
+		case "abci_query":
+			var params struct {
+				Path string `json:"path"`
+				Data string `json:"data"`
+			}
+			json.Unmarshal(request.Params, &params)
+			data, _ := hex.DecodeString(params.Data)
+			result = map[string]interface{}{"response": app.Query(types.RequestQuery{Path: params.Path, Data: data})}
+		}
+		encoded, _ := json.Marshal(result)
+		json.NewEncoder(w).Encode(map[string]json.RawMessage{"result": encoded})
+	}))
+}
+
+func serve(gateway *Gateway, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestGateway(t *testing.T) {
+	app := ticketstore.NewTicketStoreApplication()
+	node := newNode(t, app)
+	defer node.Close()
+	gateway := New(client.New(node.URL))
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   uint32
+	}{
+		{"not ready before the first block", "GET", "/ready", "", http.StatusServiceUnavailable, 0},
+		{"submit", "POST", "/ticket", `{"id":1,"nonce":1,"details":"Seat 1","ownerAddr":"` + alice + `"}`, http.StatusAccepted, 0},
+		{"ready", "GET", "/ready", "", http.StatusOK, 0},
+		{"resubmit", "POST", "/ticket", `{"id":1,"nonce":1,"details":"Seat 1","ownerAddr":"` + alice + `"}`, http.StatusConflict, codes.Duplicate},
+		{"submit invalid ticket", "POST", "/ticket", `{"id":0,"nonce":1,"ownerAddr":"` + alice + `"}`, http.StatusUnprocessableEntity, codes.TicketError},
+		{"submit malformed JSON", "POST", "/ticket", `{"id":`, http.StatusBadRequest, 0},
+		{"submit with GET", "GET", "/ticket", "", http.StatusMethodNotAllowed, 0},
+		{"get ticket", "GET", "/ticket/1", "", http.StatusOK, 0},
+		{"get missing ticket", "GET", "/ticket/2", "", http.StatusNotFound, codes.NotFound},
+		{"get malformed id", "GET", "/ticket/one", "", http.StatusBadRequest, 0},
+		{"get ticket with POST", "POST", "/ticket/1", "", http.StatusMethodNotAllowed, 0},
+		{"get by owner", "GET", "/owner/" + alice, "", http.StatusOK, 0},
+	}
+	for _, step := range steps {
+		response := serve(gateway, step.method, step.path, step.body)
+		if response.Code != step.status {
+			t.Fatalf("%v: %v %v returned %v: %v, want %v", step.name, step.method, step.path, response.Code, response.Body, step.status)
+		}
+		if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%v: Content-Type is %q", step.name, contentType)
+		}
+		// A node that is not ready still reports how far it has synced
+		if step.status >= 400 && step.status != http.StatusServiceUnavailable {
+			var failure errorResponse
+			if err := json.Unmarshal(response.Body.Bytes(), &failure); err != nil || failure.Code != step.code || failure.Error == "" {
+				t.Errorf("%v: error body is %v, want code %v with a message", step.name, response.Body, step.code)
+			}
+		}
+	}
+
+	var ticket ticketstore.TicketResponse
+	json.Unmarshal(serve(gateway, "GET", "/ticket/1", "").Body.Bytes(), &ticket)
+	if ticket.Ticket.Details != "Seat 1" || len(ticket.MerkleProof) == 0 {
+		t.Errorf("GET /ticket/1 returned %+v", ticket)
+	}
+}
+
+func TestGatewayNodeUnreachable(t *testing.T) {
+	node := httptest.NewServer(http.NotFoundHandler())
+	node.Close()
+	gateway := New(client.New(node.URL))
+	if response := serve(gateway, "GET", "/ticket/1", ""); response.Code != http.StatusBadGateway {
+		t.Errorf("GET /ticket/1 returned %v, want %v", response.Code, http.StatusBadGateway)
+	}
+}
+
+// recordingQuerier passes queries to the app, recording whether each query's
+// context was done by the time it was answered
+type recordingQuerier struct {
+	app       *ticketstore.TicketStoreApplication
+	abandoned []bool
+}
+
+func (querier *recordingQuerier) QueryContext(ctx context.Context, reqQuery types.RequestQuery) types.ResponseQuery {
+	response := querier.app.QueryContext(ctx, reqQuery)
+	querier.abandoned = append(querier.abandoned, ctx.Err() != nil)
+	return response
+}
+
+func TestGatewayLocalQueries(t *testing.T) {
+	app := ticketstore.NewTicketStoreApplication()
+	for id := 1; id <= 100; id++ {
+		app.DeliverTx(types.RequestDeliverTx{Tx: []byte(fmt.Sprintf(`{"id":%v,"nonce":1,"details":"","ownerAddr":"%v"}`, id, alice))})
+	}
+	app.Commit()
+
+	tests := []struct {
+		name      string
+		path      string
+		abandoned bool
+		status    int
+		code      uint32
+	}{
+		{"ticket", "/ticket/1", false, http.StatusOK, codes.OK},
+		{"owner", "/owner/" + alice, false, http.StatusOK, codes.OK},
+		{"owner abandoned by the client", "/owner/" + alice, true, statusClientClosedRequest, codes.Cancelled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Nothing listens on the endpoint, so queries can only be answered
+			// in process
+			querier := &recordingQuerier{app: app}
+			gateway := New(client.NewLocal("http://127.0.0.1:0", querier))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.abandoned {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			recorder := httptest.NewRecorder()
+			gateway.ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil).WithContext(ctx))
+
+			if len(querier.abandoned) != 1 || querier.abandoned[0] != test.abandoned {
+				t.Fatalf("App answered queries with abandoned contexts %v, want [%v]", querier.abandoned, test.abandoned)
+			}
+			if recorder.Code != test.status {
+				t.Errorf("GET %v returned %v: %v, want %v", test.path, recorder.Code, recorder.Body, test.status)
+			}
+			if test.code == codes.OK {
+				return
+			}
+			var failure errorResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &failure); err != nil || failure.Code != test.code {
+				t.Errorf("GET %v returned %v, want code %v", test.path, recorder.Body, test.code)
+			}
+		})
+	}
+}
+
+// fixedQuerier answers every query with code
+type fixedQuerier uint32
+
+func (code fixedQuerier) QueryContext(ctx context.Context, reqQuery types.RequestQuery) types.ResponseQuery {
+	return types.ResponseQuery{Code: uint32(code), Log: codes.CodeString(uint32(code))}
+}
+
+func TestGatewayStatusCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   uint32
+		status int
+	}{
+		{"not found", codes.NotFound, http.StatusNotFound},
+		{"height unavailable", codes.HeightUnavailable, http.StatusGone},
+		{"internal error", codes.InternalError, http.StatusInternalServerError},
+		{"unhealthy", codes.Unhealthy, http.StatusServiceUnavailable},
+		{"cancelled", codes.Cancelled, statusClientClosedRequest},
+		{"unlisted code", 99, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gateway := New(client.NewLocal("http://127.0.0.1:0", fixedQuerier(test.code)))
+			response := serve(gateway, "GET", "/ticket/1", "")
+			if response.Code != test.status {
+				t.Errorf("Code %v returned %v, want %v", test.code, response.Code, test.status)
+			}
+			var failure errorResponse
+			if err := json.Unmarshal(response.Body.Bytes(), &failure); err != nil || failure.Code != test.code {
+				t.Errorf("Code %v returned %v, want it in the body", test.code, response.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const projectRoot = "github.com/ArtosSystems/tendermint-exp"
+
+// TestGopkgLockInputImports checks the lock lists exactly the packages the
+// project imports from outside itself, as dep ensure would write them
+func TestGopkgLockInputImports(t *testing.T) {
+	imported := make(map[string]bool)
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || strings.HasPrefix(info.Name(), ".")) && path != "." {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, spec := range file.Imports {
+			pkg, _ := strconv.Unquote(spec.Path.Value)
+			if strings.Contains(strings.Split(pkg, "/")[0], ".") && !strings.HasPrefix(pkg, projectRoot) {
+				imported[pkg] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]string, 0, len(imported))
+	for pkg := range imported {
+		want = append(want, pkg)
+	}
+	sort.Strings(want)
+
+	lock, err := ioutil.ReadFile("Gopkg.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := regexp.MustCompile(`(?s)input-imports = \[(.*?)\]`).FindSubmatch(lock)
+	if section == nil {
+		t.Fatal("Gopkg.lock has no input-imports")
+	}
+	var locked []string
+	for _, quoted := range regexp.MustCompile(`"[^"]+"`).FindAll(section[1], -1) {
+		pkg, _ := strconv.Unquote(string(quoted))
+		locked = append(locked, pkg)
+	}
+	if !reflect.DeepEqual(locked, want) {
+		t.Errorf("Gopkg.lock input-imports are %v, want %v", locked, want)
+	}
+}
@@ -1,32 +1,195 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ArtosSystems/tendermint-exp/apps"
+	"github.com/ArtosSystems/tendermint-exp/client"
+	"github.com/ArtosSystems/tendermint-exp/gateway"
+	"github.com/ArtosSystems/tendermint-exp/metrics"
 	"github.com/ArtosSystems/tendermint-exp/ticketstore"
 	"github.com/tendermint/tendermint/abci/server"
+	"github.com/tendermint/tendermint/abci/types"
 	cmn "github.com/tendermint/tendermint/libs/common"
 	"github.com/tendermint/tendermint/libs/log"
-	"os"
 )
 
 func main() {
-	app := ticketstore.NewTicketStoreApplication()
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			if err := command(os.Args[2:], os.Getenv, os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			return
+		}
+	}
+
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	recorder := metrics.Nop()
+	var prometheus *metrics.Prometheus
+	if cfg.MetricsAddress != "" {
+		prometheus = metrics.NewPrometheus()
+		recorder = prometheus
+	}
+
+	var audit *os.File
+	if cfg.AuditFile != "" {
+		audit, err = os.OpenFile(cfg.AuditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	appConfig, err := newAppConfig(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	logger := log.NewTMLogger(log.NewSyncWriter(os.Stdout))
+	appConfig.Metrics = recorder
+	appConfig.Logger = logger.With("module", "app")
+	// A nil *os.File in the interface would not read as nil
+	if audit != nil {
+		appConfig.Audit = audit
+	}
+	app, err := apps.New(cfg.App, appConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if prometheus != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", prometheus)
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddress, mux); err != nil {
+				logger.Error("Metrics server stopped", "err", err)
+			}
+		}()
+	}
+
+	if cfg.GatewayAddress != "" {
+		// Queries from the gateway go to the application in process, so they
+		// stop when the HTTP client gives up
+		gatewayClient := client.New(cfg.RPCEndpoint)
+		if querier, ok := app.(client.Querier); ok {
+			gatewayClient = client.NewLocal(cfg.RPCEndpoint, querier)
+		}
+		handler := gateway.New(gatewayClient)
+		go func() {
+			if err := http.ListenAndServe(cfg.GatewayAddress, handler); err != nil {
+				logger.Error("Gateway stopped", "err", err)
+			}
+		}()
+	}
+
+	// With TLS the server listens privately behind a proxy holding the address
+	listenAddress := cfg.Address
+	var proxy *tlsProxy
+	if cfg.TLSCert != "" {
+		proxy, err = newTLSProxy(cfg.Address, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		listenAddress = proxy.backendAddress()
+	}
 
 	// Start the listener
-	srv, err := server.NewServer("tcp://0.0.0.0:26658", "socket", app)
+	srv, err := startServer(listenAddress, cfg.Transport, app, cfg.StartRetries, logger.With("module", "abci-server"))
 	if err != nil {
-		panic(err)
+		logger.Error("Failed to start ABCI server", "err", err)
+		if proxy != nil {
+			_ = proxy.Close()
+		}
+		os.Exit(1)
 	}
-	srv.SetLogger(logger.With("module", "abci-server"))
-	if err := srv.Start(); err != nil {
-		panic(err)
+	if proxy != nil {
+		go proxy.serve(logger.With("module", "tls"))
 	}
 	// Stop upon receiving SIGTERM or CTRL-C.
 	cmn.TrapSignal(logger, func() {
 		// Cleanup
+		if proxy != nil {
+			_ = proxy.Close()
+		}
 		_ = srv.Stop()
+		if closer, ok := app.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Error("Failed to flush application state", "err", err)
+			}
+		}
+		if audit != nil {
+			_ = audit.Close()
+		}
 	})
 
 	// Run forever.
 	select {}
 }
+
+// newAppConfig is the application configuration cfg describes, leaving the
+// metrics, logger and audit sink for main to set up
+func newAppConfig(cfg config) (apps.Config, error) {
+	hashStrategy, err := ticketstore.HashStrategyNamed(cfg.HashStrategy)
+	if err != nil {
+		return apps.Config{}, err
+	}
+	validators, err := parseValidators(cfg.Validators)
+	if err != nil {
+		return apps.Config{}, err
+	}
+	return apps.Config{
+		DataDir:           cfg.DataDir,
+		HashStrategy:      hashStrategy,
+		SnapshotInterval:  cfg.SnapshotInterval,
+		FlushInterval:     cfg.FlushInterval,
+		CheckTxCache:      cfg.CheckTxCache,
+		ChainId:           cfg.ChainId,
+		Validators:        validators,
+		ValidatorMaxPower: cfg.ValidatorMaxPower,
+		DropProofs:        cfg.DropProofs,
+		DebugQueries:      cfg.DebugQueries,
+		RetainHeights:     cfg.RetainHeights,
+		AuditMaxBytes:     cfg.AuditMaxBytes,
+		AuditRate:         cfg.AuditRate}, nil
+}
+
+// startRetryDelay is how long startServer waits before its first retry
+var startRetryDelay = time.Second
+
+// startServer starts the ABCI server, trying up to retries more times with a
+// doubling delay since the address may still be held by a server that is
+// shutting down
+func startServer(address string, transport string, app types.Application, retries int, logger log.Logger) (cmn.Service, error) {
+	delay := startRetryDelay
+	for attempt := 0; ; attempt++ {
+		srv, err := server.NewServer(address, transport, app)
+		if err != nil {
+			return nil, err
+		}
+		srv.SetLogger(logger)
+		err = srv.Start()
+		if err == nil {
+			return srv, nil
+		}
+		if attempt >= retries {
+			return nil, err
+		}
+		logger.Error("Failed to start ABCI server, retrying", "err", err, "delay", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtosSystems/tendermint-exp/apps"
+	"github.com/ArtosSystems/tendermint-exp/ticketstore"
+	"github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// retryLogger counts startServer's retries, calling onRetry before each
+type retryLogger struct {
+	log.Logger
+	retries int
+	onRetry func()
+}
+
+func (logger *retryLogger) Error(msg string, keyvals ...interface{}) {
+	if msg == "Failed to start ABCI server, retrying" {
+		logger.retries++
+		if logger.onRetry != nil {
+			logger.onRetry()
+		}
+	}
+}
+
+func TestStartServerRetries(t *testing.T) {
+	defer func(delay time.Duration) { startRetryDelay = delay }(startRetryDelay)
+	startRetryDelay = time.Millisecond
+
+	tests := []struct {
+		name        string
+		retries     int
+		freeOnRetry int
+		wantRetries int
+		started     bool
+	}{
+		{"address in use without retries", 0, 0, 0, false},
+		{"address in use throughout the retries", 3, 0, 3, false},
+		{"address freed before the first retry", 3, 1, 1, true},
+		{"address freed before the last retry", 3, 3, 3, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The port is held as a server that is shutting down would
+			held, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer held.Close()
+
+			logger := &retryLogger{Logger: log.NewNopLogger()}
+			logger.onRetry = func() {
+				if logger.retries == test.freeOnRetry {
+					held.Close()
+				}
+			}
+			srv, err := startServer("tcp://"+held.Addr().String(), "socket", types.NewBaseApplication(), test.retries, logger)
+			if started := err == nil; started != test.started {
+				t.Fatalf("startServer returned %v, want started %v", err, test.started)
+			}
+			if srv != nil {
+				srv.Stop()
+			}
+			if logger.retries != test.wantRetries {
+				t.Errorf("startServer retried %v times, want %v", logger.retries, test.wantRetries)
+			}
+		})
+	}
+}
+
+func TestNewAppConfig(t *testing.T) {
+	const validatorAddr = "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"
+	pubKey := bytes.Repeat([]byte{1}, 32)
+	tests := []struct {
+		name         string
+		args         []string
+		want         apps.Config
+		hashStrategy string
+	}{
+		{"defaults", nil,
+			apps.Config{Validators: map[string][]byte{}, AuditMaxBytes: 1024, AuditRate: 10}, "sha256"},
+		{"every option",
+			[]string{"-data-dir", "/data", "-hash-strategy", "keccak256", "-snapshot-interval", "100", "-flush-interval", "10",
+				"-check-tx-cache", "1000", "-chain-id", "1337", "-validators", validatorAddr + "=0x" + strings.Repeat("01", 32),
+				"-validator-max-power", "5", "-drop-proofs", "-debug-queries", "-retain-heights", "50", "-audit-max-bytes", "0", "-audit-rate", "0"},
+			apps.Config{DataDir: "/data", SnapshotInterval: 100, FlushInterval: 10, CheckTxCache: 1000, ChainId: 1337,
+				Validators: map[string][]byte{validatorAddr: pubKey}, ValidatorMaxPower: 5, DropProofs: true, DebugQueries: true, RetainHeights: 50},
+			"keccak256"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := loadConfig(test.args, func(string) string { return "" })
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := newAppConfig(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Strategies are functions, so they are compared by what they hash
+			want, _ := ticketstore.HashStrategyNamed(test.hashStrategy)
+			if got.HashStrategy == nil || !bytes.Equal(got.HashStrategy().Sum(nil), want().Sum(nil)) {
+				t.Errorf("Hash strategy is not %v", test.hashStrategy)
+			}
+			got.HashStrategy = nil
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("newAppConfig returned %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
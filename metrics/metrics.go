@@ -0,0 +1,93 @@
+// Package metrics lets the ABCI applications report what they process and
+// exposes those figures to Prometheus.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recorder receives the events an application reports. Implementations must
+// be safe for concurrent use
+type Recorder interface {
+	TxDelivered()
+	TxRejected(code uint32)
+	Committed(height int64, duration time.Duration)
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) TxDelivered()                   {}
+func (nopRecorder) TxRejected(uint32)              {}
+func (nopRecorder) Committed(int64, time.Duration) {}
+
+// Nop returns a Recorder that discards everything
+func Nop() Recorder { return nopRecorder{} }
+
+// Prometheus is a Recorder that serves what it records in the Prometheus
+// text exposition format
+type Prometheus struct {
+	mtx           sync.Mutex
+	delivered     uint64
+	rejected      map[uint32]uint64
+	commitCount   uint64
+	commitSeconds float64
+	height        int64
+}
+
+func NewPrometheus() *Prometheus {
+	return &Prometheus{rejected: make(map[uint32]uint64)}
+}
+
+func (p *Prometheus) TxDelivered() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.delivered++
+}
+
+func (p *Prometheus) TxRejected(code uint32) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.rejected[code]++
+}
+
+func (p *Prometheus) Committed(height int64, duration time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.commitCount++
+	p.commitSeconds += duration.Seconds()
+	p.height = height
+}
+
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP abci_app_txs_delivered_total Transactions accepted by DeliverTx.")
+	fmt.Fprintln(w, "# TYPE abci_app_txs_delivered_total counter")
+	fmt.Fprintf(w, "abci_app_txs_delivered_total %v\n", p.delivered)
+
+	fmt.Fprintln(w, "# HELP abci_app_txs_rejected_total Transactions rejected by DeliverTx, by response code.")
+	fmt.Fprintln(w, "# TYPE abci_app_txs_rejected_total counter")
+	codes := make([]uint32, 0, len(p.rejected))
+	for code := range p.rejected {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		fmt.Fprintf(w, "abci_app_txs_rejected_total{code=\"%v\"} %v\n", code, p.rejected[code])
+	}
+
+	fmt.Fprintln(w, "# HELP abci_app_commit_duration_seconds Time spent in Commit.")
+	fmt.Fprintln(w, "# TYPE abci_app_commit_duration_seconds summary")
+	fmt.Fprintf(w, "abci_app_commit_duration_seconds_sum %v\n", p.commitSeconds)
+	fmt.Fprintf(w, "abci_app_commit_duration_seconds_count %v\n", p.commitCount)
+
+	fmt.Fprintln(w, "# HELP abci_app_height Last committed height.")
+	fmt.Fprintln(w, "# TYPE abci_app_height gauge")
+	fmt.Fprintf(w, "abci_app_height %v\n", p.height)
+}
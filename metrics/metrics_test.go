@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheus(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(p *Prometheus)
+		want   []string
+	}{
+		{"nothing recorded", func(*Prometheus) {}, []string{
+			"abci_app_txs_delivered_total 0\n",
+			"abci_app_commit_duration_seconds_count 0\n",
+			"abci_app_height 0\n",
+		}},
+		{"delivered and committed", func(p *Prometheus) {
+			p.TxDelivered()
+			p.TxDelivered()
+			p.Committed(1, time.Second)
+			p.Committed(2, 500*time.Millisecond)
+		}, []string{
+			"abci_app_txs_delivered_total 2\n",
+			"abci_app_commit_duration_seconds_sum 1.5\n",
+			"abci_app_commit_duration_seconds_count 2\n",
+			"abci_app_height 2\n",
+		}},
+		{"rejections by code", func(p *Prometheus) {
+			p.TxRejected(3)
+			p.TxRejected(1)
+			p.TxRejected(3)
+		}, []string{
+			"abci_app_txs_rejected_total{code=\"1\"} 1\nabci_app_txs_rejected_total{code=\"3\"} 2\n",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPrometheus()
+			test.record(p)
+			recorder := httptest.NewRecorder()
+			p.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4" {
+				t.Errorf("Content-Type is %q", contentType)
+			}
+			body := recorder.Body.String()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("Metrics do not contain %q:\n%v", want, body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package ticketstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestOwnerAddressFormat(t *testing.T) {
+	checksummed := crypto.PubkeyToAddress(aliceKey.PublicKey).Hex()
+	lower := address(aliceKey)
+	// Flipping the case of the first letter breaks the checksum
+	letter := strings.IndexAny(checksummed[2:], "abcdefABCDEF") + 2
+	flipped := checksummed[:letter] + strings.ToUpper(checksummed[letter:letter+1])
+	if flipped[letter] == checksummed[letter] {
+		flipped = checksummed[:letter] + strings.ToLower(checksummed[letter:letter+1])
+	}
+	badChecksum := flipped + checksummed[letter+1:]
+
+	tests := []struct {
+		name       string
+		owner      string
+		code       uint32
+		strictCode uint32
+	}{
+		{"checksummed", checksummed, codeTypeOK, codeTypeOK},
+		{"lower case", lower, codeTypeOK, codeTypeTicketError},
+		{"upper case", "0x" + strings.ToUpper(lower[2:]), codeTypeOK, codeTypeTicketError},
+		{"wrong checksum", badChecksum, codeTypeTicketError, codeTypeTicketError},
+		{"without 0x", lower[2:], codeTypeTicketError, codeTypeTicketError},
+		{"upper case 0X", "0X" + lower[2:], codeTypeTicketError, codeTypeTicketError},
+		{"too short", lower[:40], codeTypeTicketError, codeTypeTicketError},
+		{"too long", lower + "00", codeTypeTicketError, codeTypeTicketError},
+		{"not hex", "0x" + strings.Repeat("zz", 20), codeTypeTicketError, codeTypeTicketError},
+		{"empty", "", codeTypeTicketError, codeTypeTicketError},
+	}
+	for _, test := range tests {
+		for _, strict := range []bool{false, true} {
+			name, code, opts := test.name, test.code, []Option(nil)
+			if strict {
+				name, code, opts = test.name+" with checksums required", test.strictCode, []Option{WithChecksummedAddresses()}
+			}
+			t.Run(name, func(t *testing.T) {
+				app := NewTicketStoreApplication(opts...)
+				ticket := newTicket(1, aliceKey)
+				ticket.OwnerAddr = test.owner
+				if response := checkTx(t, app, ticket); response.Code != code {
+					t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, code)
+				}
+				response := deliver(t, app, ticket)
+				if response.Code != code {
+					t.Fatalf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, code)
+				}
+				if code != codeTypeOK {
+					if !strings.Contains(response.Log, ErrBadAddress.Error()) {
+						t.Errorf("DeliverTx log is %q, want %q", response.Log, ErrBadAddress)
+					}
+					return
+				}
+				app.Commit()
+
+				// The owner is stored in lower case and found by any casing
+				var stored TicketResponse
+				queryJSON(t, app, "ticket", "1", 0, &stored)
+				if stored.Ticket.OwnerAddr != lower {
+					t.Errorf("Ticket stored with owner %v, want %v", stored.Ticket.OwnerAddr, lower)
+				}
+				for _, owner := range []string{lower, checksummed} {
+					var owned []Ticket
+					queryJSON(t, app, "owner", owner, 0, &owned)
+					if len(owned) != 1 || !reflect.DeepEqual(owned[0], stored.Ticket) {
+						t.Errorf("owner query for %v returned %+v, want ticket 1", owner, owned)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ticketstore
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// auditSink writes rejected txs out for later analysis. Payloads are cut to
+// maxBytes and at most perSecond records are written each second, so a flood
+// of bad txs cannot flood the sink too
+type auditSink struct {
+	mtx       sync.Mutex
+	w         io.Writer
+	maxBytes  int
+	perSecond int
+
+	// window is the second being counted, written how many records were
+	// written in it and dropped how many were not since the last record
+	window  int64
+	written int
+	dropped int64
+
+	now func() time.Time
+}
+
+// auditRecord is one line of the audit sink
+type auditRecord struct {
+	Time  time.Time `json:"time"`
+	Stage string    `json:"stage"`
+	Code  uint32    `json:"code"`
+	Log   string    `json:"log"`
+	Tx    string    `json:"tx"`
+	Size  int       `json:"size"`
+	// Truncated is set when Tx holds only the first maxBytes of the tx
+	Truncated bool `json:"truncated,omitempty"`
+	// Dropped counts the records skipped by the rate limit since the last one
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+// WithAuditSink writes every tx rejected by CheckTx or DeliverTx to w as a
+// line of JSON holding its hex encoded bytes and the rejection code. Each
+// payload is cut to maxBytes, and no more than perSecond records are written
+// a second, when they are above zero. Payloads may hold personal details, so
+// nothing is written by default
+func WithAuditSink(w io.Writer, maxBytes int, perSecond int) Option {
+	return func(app *TicketStoreApplication) {
+		app.audit = &auditSink{w: w, maxBytes: maxBytes, perSecond: perSecond, now: time.Now}
+	}
+}
+
+// record writes tx rejected at stage with code, unless the rate limit has been
+// reached. A nil sink records nothing. Write errors are returned for logging
+// but never affect the tx
+func (sink *auditSink) record(stage string, tx []byte, code uint32, reason string) error {
+	if sink == nil {
+		return nil
+	}
+	sink.mtx.Lock()
+	defer sink.mtx.Unlock()
+
+	now := sink.now()
+	if second := now.Unix(); second != sink.window {
+		sink.window = second
+		sink.written = 0
+	}
+	if sink.perSecond > 0 && sink.written >= sink.perSecond {
+		sink.dropped++
+		return nil
+	}
+
+	record := auditRecord{
+		Time:    now.UTC(),
+		Stage:   stage,
+		Code:    code,
+		Log:     reason,
+		Size:    len(tx),
+		Dropped: sink.dropped}
+	if sink.maxBytes > 0 && len(tx) > sink.maxBytes {
+		tx = tx[:sink.maxBytes]
+		record.Truncated = true
+	}
+	record.Tx = hexutil.Encode(tx)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := sink.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	sink.written++
+	sink.dropped = 0
+	return nil
+}
+
+// auditRejection writes tx to the audit sink, if there is one
+func (app *TicketStoreApplication) auditRejection(stage string, tx []byte, code uint32, reason string) {
+	if err := app.audit.record(stage, tx, code, reason); err != nil {
+		app.logger.Error("Failed to write audit record", "err", err)
+	}
+}
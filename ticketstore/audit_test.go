@@ -0,0 +1,88 @@
+package ticketstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestAuditSink(t *testing.T) {
+	valid := string(encodeTx(t, newTicket(1, aliceKey)))
+	tests := []struct {
+		name      string
+		maxBytes  int
+		perSecond int
+		checkTxs  []string
+		deliver   []string
+		want      []auditRecord
+	}{
+		{"accepted txs are not recorded", 0, 0, []string{valid}, []string{valid}, nil},
+		{"rejected by CheckTx and DeliverTx", 0, 0, []string{"not json"}, []string{valid, "{}"}, []auditRecord{
+			{Stage: "CheckTx", Code: codeTypeEncodingError, Tx: hexutil.Encode([]byte("not json")), Size: 8},
+			{Stage: "DeliverTx", Code: codeTypeEncodingError, Tx: hexutil.Encode([]byte("{}")), Size: 2}}},
+		{"replay rejected after delivery", 0, 0, nil, []string{valid, valid}, []auditRecord{
+			{Stage: "DeliverTx", Code: codeTypeDuplicate, Tx: hexutil.Encode([]byte(valid)), Size: len(valid)}}},
+		{"payload truncated", 4, 0, []string{"not json"}, nil, []auditRecord{
+			{Stage: "CheckTx", Code: codeTypeEncodingError, Tx: hexutil.Encode([]byte("not ")), Size: 8, Truncated: true}}},
+		{"rate limited", 0, 2, []string{"a", "b", "c", "d"}, []string{"e"}, []auditRecord{
+			{Stage: "CheckTx", Code: codeTypeEncodingError, Tx: hexutil.Encode([]byte("a")), Size: 1},
+			{Stage: "CheckTx", Code: codeTypeEncodingError, Tx: hexutil.Encode([]byte("b")), Size: 1},
+			{Stage: "DeliverTx", Code: codeTypeEncodingError, Tx: hexutil.Encode([]byte("e")), Size: 1, Dropped: 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sink bytes.Buffer
+			app := NewTicketStoreApplication(WithAuditSink(&sink, test.maxBytes, test.perSecond))
+			// Every tx lands in the same second until DeliverTx, which is a
+			// second later so the rate limit has reset
+			now := time.Unix(1000, 0)
+			app.audit.now = func() time.Time { return now }
+			for _, tx := range test.checkTxs {
+				app.CheckTx(types.RequestCheckTx{Tx: []byte(tx)})
+			}
+			now = now.Add(time.Second)
+			for _, tx := range test.deliver {
+				app.DeliverTx(types.RequestDeliverTx{Tx: []byte(tx)})
+			}
+			app.Commit()
+
+			var records []auditRecord
+			scanner := bufio.NewScanner(&sink)
+			for scanner.Scan() {
+				var record auditRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Fatalf("Audit line %s: %v", scanner.Bytes(), err)
+				}
+				if record.Log == "" {
+					t.Errorf("Audit record %+v has no log", record)
+				}
+				record.Time, record.Log = time.Time{}, ""
+				records = append(records, record)
+			}
+			if len(records) != len(test.want) {
+				t.Fatalf("Audit sink recorded %+v, want %+v", records, test.want)
+			}
+			for i := range records {
+				if records[i] != test.want[i] {
+					t.Errorf("Audit record %v is %+v, want %+v", i, records[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuditSinkOffByDefault(t *testing.T) {
+	app := NewTicketStoreApplication()
+	if app.audit != nil {
+		t.Fatalf("App built without WithAuditSink has sink %+v", app.audit)
+	}
+	// A rejected tx without a sink is only answered
+	if response := app.CheckTx(types.RequestCheckTx{Tx: []byte("not json")}); response.Code != codeTypeEncodingError {
+		t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, codeTypeEncodingError)
+	}
+}
@@ -0,0 +1,36 @@
+package ticketstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestBlockQuery(t *testing.T) {
+	start := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header types.Header
+		want   blockInfo
+	}{
+		{"first block", types.Header{Height: 1, Time: start, ProposerAddress: []byte{0xab, 0xcd}}, blockInfo{1, start, "0xabcd"}},
+		{"later block", types.Header{Height: 2, Time: start.Add(time.Second), ProposerAddress: []byte{0x01}}, blockInfo{2, start.Add(time.Second), "0x01"}},
+	}
+	app := NewTicketStoreApplication()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app.BeginBlock(types.RequestBeginBlock{Header: test.header})
+			if response := app.EndBlock(types.RequestEndBlock{Height: test.header.Height}); len(response.ValidatorUpdates) > 0 {
+				t.Errorf("EndBlock returned validator updates %v", response.ValidatorUpdates)
+			}
+			app.Commit()
+
+			var block blockInfo
+			queryJSON(t, app, "block", "", 0, &block)
+			if !block.Time.Equal(test.want.Time) || block.Height != test.want.Height || block.Proposer != test.want.Proposer {
+				t.Errorf("Block query returned %+v, want %+v", block, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package ticketstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// requiredTicketFields must be present in every ticket in a tx, even where
+// their zero value is allowed
+var requiredTicketFields = []string{"id", "nonce", "ownerAddr"}
+
+// decodeTicketTxs decodes a tx holding either a single ticket or a JSON array
+// of tickets to be applied as a unit
+func decodeTicketTxs(tx []byte) ([]TicketTx, error) {
+	trimmed := bytes.TrimSpace(tx)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		ticketTx, err := decodeTicketTx(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		return []TicketTx{ticketTx}, nil
+	}
+
+	var encoded []json.RawMessage
+	if err := json.Unmarshal(trimmed, &encoded); err != nil {
+		return nil, err
+	}
+	if len(encoded) == 0 {
+		return nil, fmt.Errorf("Ticket bundle must not be empty")
+	}
+	ticketTxs := make([]TicketTx, len(encoded))
+	for i, data := range encoded {
+		ticketTx, err := decodeTicketTx(data)
+		if err != nil {
+			return nil, fmt.Errorf("Ticket at index %v in bundle: %v", i, err)
+		}
+		ticketTxs[i] = ticketTx
+	}
+	return ticketTxs, nil
+}
+
+// decodeTicketTx decodes a single ticket, naming the field at fault when the
+// ticket has a field TicketTx does not or lacks a required one
+func decodeTicketTx(data []byte) (TicketTx, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var ticketTx TicketTx
+	if err := decoder.Decode(&ticketTx); err != nil {
+		return TicketTx{}, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return TicketTx{}, fmt.Errorf("Ticket must be a single JSON object")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return TicketTx{}, err
+	}
+	for _, field := range requiredTicketFields {
+		if _, ok := fields[field]; !ok {
+			return TicketTx{}, fmt.Errorf("Ticket is missing required field %v", field)
+		}
+	}
+	return ticketTx, nil
+}
+
+// storedTickets are the tickets a tx is validated against: the committed
+// tickets in CheckTx and the current ones in DeliverTx
+type storedTickets interface {
+	get(id uint64) (Ticket, bool)
+	len() int
+}
+
+// ticketsById is the state's current tickets as storedTickets
+type ticketsById map[uint64]Ticket
+
+func (tickets ticketsById) get(id uint64) (Ticket, bool) {
+	ticket, exists := tickets[id]
+	return ticket, exists
+}
+
+func (tickets ticketsById) len() int {
+	return len(tickets)
+}
+
+// validateTicketTxs validates each ticket under rules against stored, as
+// changed by the tickets before it in the same tx, and returns the index of
+// the first one to fail. The per block transfer limit is only applied when
+// limitTransfers is set and the supply cap counts the new ids in ticketTxs
+// against those in stored. Deadlines are checked against the time of the
+// block being delivered or, in CheckTx, the last one
+func (app *TicketStoreApplication) validateTicketTxs(ticketTxs []TicketTx, stored storedTickets, rules validationRules, limitTransfers bool) (int, error) {
+	pending := make(map[uint64]TicketTx)
+	transfers := make(map[uint64]int)
+	created := 0
+	for i, ticketTx := range ticketTxs {
+		prevTicket, ok := pending[ticketTx.Id]
+		storedTicket, exists := stored.get(ticketTx.Id)
+		if !ok {
+			prevTicket = storedTicket.TicketTx
+		}
+		if err := ticketTx.validate(prevTicket, rules); err != nil {
+			return i, err
+		}
+		if ticketTx.expired(app.state.block.Time) {
+			return i, ErrExpired
+		}
+
+		if !exists && !ok {
+			created++
+			if app.maxTickets > 0 && stored.len()+created > app.maxTickets {
+				return i, ErrSupplyExhausted
+			}
+		}
+
+		transfers[ticketTx.Id]++
+		if limitTransfers && app.maxTransfersPerBlock > 0 &&
+			app.state.blockTransfers[ticketTx.Id]+transfers[ticketTx.Id] > app.maxTransfersPerBlock {
+			return i, ErrRateLimited
+		}
+		pending[ticketTx.Id] = ticketTx
+	}
+	return 0, nil
+}
+
+// rejectionLog describes why a tx was rejected, naming the failing ticket
+// when the tx is a bundle
+func rejectionLog(ticketTxs []TicketTx, index int, err error) string {
+	if len(ticketTxs) == 1 {
+		return fmt.Sprint(err)
+	}
+	return fmt.Sprintf("Ticket %v at index %v in bundle: %v", ticketTxs[index].Id, index, err)
+}
@@ -0,0 +1,80 @@
+package ticketstore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestBundles(t *testing.T) {
+	issued := []TicketTx{newTicket(1, aliceKey), newTicket(2, aliceKey), newTicket(3, aliceKey)}
+	buyer := address(bobKey)
+	toBuyer := func(i int) TicketTx { return resell(t, issued[i], aliceKey, buyer) }
+	forged := resell(t, issued[2], carolKey, buyer)
+	onward := resell(t, toBuyer(0), bobKey, address(carolKey))
+
+	tests := []struct {
+		name  string
+		tx    []byte
+		code  uint32
+		log   string
+		owner map[uint64]string
+	}{
+		{"valid bundle", encodeTx(t, toBuyer(0), toBuyer(1), toBuyer(2)), codeTypeOK, "",
+			map[uint64]string{1: buyer, 2: buyer, 3: buyer}},
+		{"third ticket forged", encodeTx(t, toBuyer(0), toBuyer(1), forged), codeTypeTicketError, "Ticket 3 at index 2 in bundle",
+			nil},
+		{"resale and onward resale", encodeTx(t, toBuyer(0), onward), codeTypeOK, "",
+			map[uint64]string{1: address(carolKey), 2: address(aliceKey), 3: address(aliceKey)}},
+		{"onward resale before the resale", encodeTx(t, onward, toBuyer(0)), codeTypeTicketError, "Ticket 1 at index 0 in bundle",
+			nil},
+		{"same change twice", encodeTx(t, toBuyer(0), toBuyer(0)), codeTypeDuplicate, "index 1",
+			nil},
+		{"new ticket and its resale", encodeTx(t, newTicket(4, carolKey), resell(t, newTicket(4, carolKey), carolKey, buyer)), codeTypeOK, "",
+			map[uint64]string{1: address(aliceKey), 4: buyer}},
+		{"empty bundle", []byte("[]"), codeTypeEncodingError, "must not be empty", nil},
+		{"malformed ticket", []byte(`[` + string(encodeTx(t, toBuyer(0))) + `,{"id":2}]`), codeTypeEncodingError, "index 1", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			root := commitBlock(t, app, issued...)
+
+			if response := app.CheckTx(types.RequestCheckTx{Tx: test.tx}); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			response := app.DeliverTx(types.RequestDeliverTx{Tx: test.tx})
+			if response.Code != test.code || !strings.Contains(response.Log, test.log) {
+				t.Fatalf("DeliverTx returned code %v (%v), want %v containing %q", response.Code, response.Log, test.code, test.log)
+			}
+			committed := app.Commit().Data
+
+			if test.code != codeTypeOK {
+				// Nothing in a rejected bundle is applied
+				if !bytes.Equal(committed, root) {
+					t.Errorf("Rejected bundle changed the root")
+				}
+				for _, ticket := range issued {
+					if app.state.tickets[ticket.Id].TicketTx != ticket {
+						t.Errorf("Rejected bundle changed ticket %v to %+v", ticket.Id, app.state.tickets[ticket.Id])
+					}
+				}
+				return
+			}
+			for id, owner := range test.owner {
+				if stored := app.state.tickets[id].OwnerAddr; stored != owner {
+					t.Errorf("Ticket %v is owned by %v, want %v", id, stored, owner)
+				}
+			}
+			var live []TicketTx
+			for _, ticket := range sortTickets(app.state.tickets) {
+				live = append(live, ticket.TicketTx)
+			}
+			if want := referenceRoot(t, app.state.hashStrategy, live...); !bytes.Equal(committed, want) {
+				t.Errorf("Root is %x, want %x over every ticket in the bundle", committed, want)
+			}
+		})
+	}
+}
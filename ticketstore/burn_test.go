@@ -0,0 +1,95 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestBurn(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	burned := resell(t, issued, aliceKey, burnAddress)
+	forged := resell(t, issued, bobKey, burnAddress)
+
+	tests := []struct {
+		name   string
+		ticket TicketTx
+		code   uint32
+		log    string
+	}{
+		{"by the owner", burned, codeTypeOK, ""},
+		{"signed by someone else", forged, codeTypeTicketError, ErrBadSignature.Error()},
+		{"ticket that was never issued", TicketTx{Id: 2, Nonce: 1, OwnerAddr: burnAddress}, codeTypeTicketError, ErrTicketNotFound.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			commitBlock(t, app, issued, newTicket(3, bobKey))
+			response := deliver(t, app, test.ticket)
+			if response.Code != test.code || !strings.Contains(response.Log, test.log) {
+				t.Fatalf("DeliverTx returned code %v (%v), want %v containing %q", response.Code, response.Log, test.code, test.log)
+			}
+			app.Commit()
+
+			if test.code != codeTypeOK {
+				if app.state.tickets[1].OwnerAddr != address(aliceKey) {
+					t.Errorf("Rejected burn changed the ticket to %+v", app.state.tickets[1])
+				}
+				return
+			}
+			if !app.state.tickets[1].isBurned() {
+				t.Errorf("Ticket is %+v, want it burned", app.state.tickets[1])
+			}
+			if _, held := app.state.owners[address(aliceKey)]; held {
+				t.Errorf("Owner index still lists the burned ticket: %v", app.state.owners)
+			}
+			if want := referenceRoot(t, sha256.New, newTicket(3, bobKey)); !bytes.Equal(app.state.rootHash, want) {
+				t.Errorf("Root is %x, want %x over the live tickets only", app.state.rootHash, want)
+			}
+		})
+	}
+}
+
+func TestBurnedTicketQueries(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued, newTicket(2, bobKey))
+	burned := resell(t, issued, aliceKey, burnAddress)
+	commitBlock(t, app, burned)
+
+	tests := []struct {
+		name string
+		path string
+		data string
+		code uint32
+	}{
+		{"ticket", "ticket", "1", codeTypeNotFound},
+		{"ticket before the burn", "ticket", "1:1", codeTypeOK},
+		{"history", "history", "1", codeTypeOK},
+		{"isowner", "isowner", `{"id":1,"address":"` + burnAddress + `"}`, codeTypeOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := query(app, test.path, test.data, 0)
+			if response.Code != test.code {
+				t.Errorf("%v query returned code %v: %v", test.path, response.Code, response.Log)
+			}
+		})
+	}
+
+	var history []Transfer
+	queryJSON(t, app, "history", "1", 0, &history)
+	if len(history) != 2 || history[1].Owner != burnAddress {
+		t.Errorf("History is %+v, want the issue followed by the burn", history)
+	}
+	var owner isOwnerResponse
+	queryJSON(t, app, "isowner", `{"id":1,"address":"`+burnAddress+`"}`, 0, &owner)
+	if owner.Owner {
+		t.Error("The burn address is reported as the owner of the burned ticket")
+	}
+
+	if response := deliver(t, app, resell(t, burned, aliceKey, address(carolKey))); response.Code != codeTypeTicketError || response.Log == "" {
+		t.Errorf("Resale of a burned ticket returned code %v (%v), want %v", response.Code, response.Log, codeTypeTicketError)
+	}
+}
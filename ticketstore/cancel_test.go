@@ -0,0 +1,137 @@
+package ticketstore
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// cancelAfter is a context whose Err reports it cancelled from the checks-th
+// call on, so a query can be stopped part way through deterministically
+type cancelAfter struct {
+	context.Context
+	checks int32
+}
+
+func (ctx *cancelAfter) Err() error {
+	if atomic.AddInt32(&ctx.checks, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCancelledPartWay(t *testing.T) {
+	app := NewTicketStoreApplication()
+	var tickets []TicketTx
+	var ids []uint64
+	for id := uint64(1); id <= 50; id++ {
+		tickets = append(tickets, newTicket(id, aliceKey))
+		ids = append(ids, id)
+	}
+	commitBlock(t, app, tickets...)
+	root := app.state.appHash()
+	snapshot := app.state.history[1]
+
+	handlers := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"dump", func(ctx context.Context) error {
+			_, err := snapshot.dump(ctx, page{}, 1)
+			return err
+		}},
+		{"owner", func(ctx context.Context) error {
+			_, err := snapshot.ownerTickets(ctx, address(aliceKey))
+			return err
+		}},
+		{"tickets", func(ctx context.Context) error {
+			_, _, err := app.state.findTickets(ctx, ids, 1)
+			return err
+		}},
+	}
+	for _, handler := range handlers {
+		t.Run(handler.name, func(t *testing.T) {
+			ctx := &cancelAfter{Context: context.Background(), checks: 5}
+			if err := handler.run(ctx); err != context.Canceled {
+				t.Errorf("%v cancelled part way returned %v, want %v", handler.name, err, context.Canceled)
+			}
+			if checks := atomic.LoadInt32(&ctx.checks); checks != -1 {
+				t.Errorf("%v checked for cancellation %v more times after it was cancelled, want it to stop at once", handler.name, -1-checks)
+			}
+			if err := handler.run(context.Background()); err != nil {
+				t.Errorf("%v returned %v", handler.name, err)
+			}
+		})
+	}
+	if !bytes.Equal(app.state.appHash(), root) || len(app.state.tickets) != 50 {
+		t.Errorf("Cancelled queries changed the state")
+	}
+}
+
+func TestQueryContextCancelledByCaller(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(1, aliceKey))
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for path, data := range map[string]string{"dump": "", "owner": address(aliceKey), "tickets": "[1]"} {
+		response := app.QueryContext(cancelled, types.RequestQuery{Path: path, Data: []byte(data)})
+		if response.Code != codeTypeCancelled || len(response.Value) > 0 {
+			t.Errorf("%v query with a cancelled context returned code %v and %s, want %v and no value", path, response.Code, response.Value, codeTypeCancelled)
+		}
+
+		// Each query has a context of its own, so the next one is unaffected
+		if response := query(app, path, data, 0); response.Code != codeTypeOK {
+			t.Errorf("%v query after a cancelled one returned code %v: %v", path, response.Code, response.Log)
+		}
+	}
+}
+
+func TestQueryContext(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		app := NewTicketStoreApplication(WithQueryTimeout(time.Minute))
+		ctx, cancel := app.queryContext(context.Background())
+		defer cancel()
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("Query deadline is %v (%v), want within a minute", deadline, ok)
+		}
+	})
+	t.Run("default timeout", func(t *testing.T) {
+		ctx, cancel := NewTicketStoreApplication().queryContext(context.Background())
+		defer cancel()
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > defaultQueryTimeout {
+			t.Errorf("Query deadline is %v (%v), want within %v", deadline, ok, defaultQueryTimeout)
+		}
+	})
+	t.Run("no timeout", func(t *testing.T) {
+		ctx, cancel := NewTicketStoreApplication(WithQueryTimeout(0)).queryContext(context.Background())
+		defer cancel()
+		if _, ok := ctx.Deadline(); ok {
+			t.Errorf("Query has a deadline with the timeout disabled")
+		}
+	})
+	t.Run("caller cancels", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := NewTicketStoreApplication().queryContext(parent)
+		defer cancel()
+		cancelParent()
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Errorf("Query context not done a second after its caller's was")
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		app := NewTicketStoreApplication()
+		ctx, cancel := app.queryContext(context.Background())
+		defer cancel()
+		app.Close()
+		if ctx.Err() != context.Canceled {
+			t.Errorf("Query context returned %v after Close, want %v", ctx.Err(), context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package ticketstore
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Tickets travel as JSON, but CalculateHash is over the values of a ticket's
+// fields rather than its JSON, so key order and whitespace never change a
+// ticket's hash or whether its resale signature verifies. Where the bytes
+// themselves matter, such as a tx the mempool deduplicates by hash or a
+// snapshot every node must produce identically, the canonical encoding below
+// is used: keys sorted, no insignificant whitespace and numbers kept exactly
+
+// CanonicalJSON encodes the ticket so that equal tickets always produce the
+// same bytes
+func (ticket TicketTx) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON(ticket)
+}
+
+// CanonicalJSON encodes the stored ticket so that equal tickets always
+// produce the same bytes
+func (ticket Ticket) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON(ticket)
+}
+
+// canonicalJSON encodes v with the keys of every object sorted
+func canonicalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoding into generic values and encoding again sorts object keys, and
+	// json.Number keeps integers beyond float64 precision intact
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
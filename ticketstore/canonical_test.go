@@ -0,0 +1,103 @@
+package ticketstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestKeyOrderDoesNotMatter(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	resale := resell(t, issued, aliceKey, address(bobKey))
+
+	// Each encoding is delivered to an app of its own, which must accept the
+	// same tickets and commit the same root
+	encodings := []struct {
+		name   string
+		issue  string
+		resell string
+	}{
+		{"field order",
+			fmt.Sprintf(`{"id":1,"nonce":1,"details":%q,"ownerAddr":%q}`, issued.Details, issued.OwnerAddr),
+			fmt.Sprintf(`{"id":1,"nonce":2,"details":%q,"ownerAddr":%q,"prevOwnerProof":%q}`, resale.Details, resale.OwnerAddr, resale.PrevOwnerProof)},
+		{"reversed",
+			fmt.Sprintf(`{"ownerAddr":%q,"details":%q,"nonce":1,"id":1}`, issued.OwnerAddr, issued.Details),
+			fmt.Sprintf(`{"prevOwnerProof":%q,"ownerAddr":%q,"details":%q,"nonce":2,"id":1}`, resale.PrevOwnerProof, resale.OwnerAddr, resale.Details)},
+		{"whitespace",
+			fmt.Sprintf("{\n  \"details\" : %q,\n  \"id\" : 1,\n  \"ownerAddr\" : %q,\n  \"nonce\" : 1\n}\n", issued.Details, issued.OwnerAddr),
+			fmt.Sprintf("\t{ \"nonce\": 2, \"prevOwnerProof\": %q, \"id\": 1, \"ownerAddr\": %q, \"details\": %q }", resale.PrevOwnerProof, resale.OwnerAddr, resale.Details)},
+	}
+
+	var roots [][]byte
+	for _, encoding := range encodings {
+		app := NewTicketStoreApplication()
+		for _, tx := range []string{encoding.issue, encoding.resell} {
+			if response := app.CheckTx(types.RequestCheckTx{Tx: []byte(tx)}); response.Code != codeTypeOK {
+				t.Fatalf("%v: CheckTx of %s returned code %v: %v", encoding.name, tx, response.Code, response.Log)
+			}
+			if response := app.DeliverTx(types.RequestDeliverTx{Tx: []byte(tx)}); response.Code != codeTypeOK {
+				t.Fatalf("%v: DeliverTx of %s returned code %v: %v", encoding.name, tx, response.Code, response.Log)
+			}
+			roots = append(roots, app.Commit().Data)
+		}
+	}
+	for i := 2; i < len(roots); i++ {
+		if !bytes.Equal(roots[i], roots[i%2]) {
+			t.Errorf("%v committed root %x after tx %v, want %x", encodings[i/2].name, roots[i], i%2+1, roots[i%2])
+		}
+	}
+
+	for _, encoding := range encodings {
+		var decoded TicketTx
+		if err := json.Unmarshal([]byte(encoding.issue), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		canonical, err := decoded.CanonicalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := issued.CanonicalJSON()
+		if !bytes.Equal(canonical, want) {
+			t.Errorf("%v: CanonicalJSON returned %s, want %s", encoding.name, canonical, want)
+		}
+		leaf, _ := decoded.CalculateHash()
+		wantLeaf, _ := issued.CalculateHash()
+		if !bytes.Equal(leaf, wantLeaf) {
+			t.Errorf("%v: CalculateHash returned %x, want %x", encoding.name, leaf, wantLeaf)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	ticket := TicketTx{Id: math.MaxUint64, Nonce: 1, Details: "Row<G>&seat", OwnerAddr: address(aliceKey)}
+	canonical, err := ticket.CanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded TicketTx
+	if err := json.Unmarshal(canonical, &decoded); err != nil || decoded != ticket {
+		t.Errorf("CanonicalJSON returned %s, which decodes to %+v, want %+v", canonical, decoded, ticket)
+	}
+	var keys []string
+	decoder := json.NewDecoder(bytes.NewReader(canonical))
+	decoder.Token()
+	for decoder.More() {
+		key, _ := decoder.Token()
+		keys = append(keys, key.(string))
+		var value json.RawMessage
+		decoder.Decode(&value)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Errorf("CanonicalJSON returned %s, whose keys are not sorted", canonical)
+		}
+	}
+	if bytes.ContainsAny(canonical, " \n\t") {
+		t.Errorf("CanonicalJSON returned %s, want no whitespace", canonical)
+	}
+}
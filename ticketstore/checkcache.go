@@ -0,0 +1,70 @@
+package ticketstore
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// checkCache remembers CheckTx results by the sha256 of the tx for the
+// current committed height, so that rechecking an unchanged mempool entry
+// does not repeat signature recovery. Once full the oldest entry is evicted
+type checkCache struct {
+	mtx     sync.Mutex
+	max     int
+	results map[[sha256.Size]byte]types.ResponseCheckTx
+	order   [][sha256.Size]byte
+}
+
+// WithCheckTxCache caches up to size CheckTx results until the next Commit.
+// Nothing is cached by default
+func WithCheckTxCache(size int) Option {
+	return func(app *TicketStoreApplication) {
+		app.checkCache = &checkCache{max: size, results: make(map[[sha256.Size]byte]types.ResponseCheckTx)}
+	}
+}
+
+// get returns the cached result for tx, if any. A nil cache holds nothing
+func (cache *checkCache) get(tx []byte) (types.ResponseCheckTx, bool) {
+	if cache == nil {
+		return types.ResponseCheckTx{}, false
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	response, ok := cache.results[sha256.Sum256(tx)]
+	return response, ok
+}
+
+func (cache *checkCache) put(tx []byte, response types.ResponseCheckTx) {
+	if cache == nil || cache.max <= 0 {
+		return
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	key := sha256.Sum256(tx)
+	if _, ok := cache.results[key]; ok {
+		return
+	}
+	if len(cache.order) >= cache.max {
+		delete(cache.results, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+	cache.results[key] = response
+	cache.order = append(cache.order, key)
+}
+
+// reset empties the cache once the committed state it was filled against
+// has changed
+func (cache *checkCache) reset() {
+	if cache == nil {
+		return
+	}
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	cache.results = make(map[[sha256.Size]byte]types.ResponseCheckTx)
+	cache.order = nil
+}
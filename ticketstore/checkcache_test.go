@@ -0,0 +1,68 @@
+package ticketstore
+
+import (
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestCheckTxCache(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	resale := encodeTx(t, resell(t, issued, aliceKey, address(bobKey)))
+	other := encodeTx(t, newTicket(2, bobKey))
+	// cachedLog marks a result that came from the cache, since validation
+	// never answers with it
+	const cachedLog = "from the cache"
+
+	tests := []struct {
+		name   string
+		size   int
+		before [][]byte
+		commit bool
+		cached bool
+		code   uint32
+	}{
+		{"cache off", 0, nil, false, false, codeTypeOK},
+		{"recheck of the same tx", 2, nil, false, true, codeTypeOK},
+		{"recheck after other txs", 2, [][]byte{other}, false, true, codeTypeOK},
+		{"evicted by a newer tx", 1, [][]byte{other}, false, false, codeTypeOK},
+		{"cleared by Commit", 2, nil, true, false, codeTypeDuplicate},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opts []Option
+			if test.size > 0 {
+				opts = append(opts, WithCheckTxCache(test.size))
+			}
+			app := NewTicketStoreApplication(opts...)
+			commitBlock(t, app, issued)
+
+			if response := app.CheckTx(types.RequestCheckTx{Tx: resale}); response.Code != codeTypeOK {
+				t.Fatalf("CheckTx returned code %v: %v", response.Code, response.Log)
+			}
+			if app.checkCache != nil {
+				for key, response := range app.checkCache.results {
+					response.Log = cachedLog
+					app.checkCache.results[key] = response
+				}
+			}
+			for _, tx := range test.before {
+				app.CheckTx(types.RequestCheckTx{Tx: tx})
+			}
+			if test.commit {
+				if response := app.DeliverTx(types.RequestDeliverTx{Tx: resale}); response.Code != codeTypeOK {
+					t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+				}
+				app.Commit()
+			}
+
+			response := app.CheckTx(types.RequestCheckTx{Tx: resale})
+			if cached := response.Log == cachedLog; cached != test.cached {
+				t.Errorf("Second CheckTx returned %+v, want cached %v", response, test.cached)
+			}
+			if response.Code != test.code {
+				t.Errorf("Second CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+		})
+	}
+}
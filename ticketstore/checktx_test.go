@@ -0,0 +1,37 @@
+package ticketstore
+
+import "testing"
+
+func TestCheckTxSeesCommittedState(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	resale := resell(t, issued, aliceKey, address(bobKey))
+	nextResale := resell(t, resale, bobKey, address(carolKey))
+
+	tests := []struct {
+		name         string
+		ticket       TicketTx
+		beforeCommit uint32
+		afterCommit  uint32
+	}{
+		{"resale being delivered", resale, codeTypeOK, codeTypeDuplicate},
+		{"resale built on the uncommitted block", nextResale, codeTypeTicketError, codeTypeOK},
+		{"new ticket", newTicket(2, aliceKey), codeTypeOK, codeTypeOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			commitBlock(t, app, issued)
+			if response := deliver(t, app, resale); response.Code != codeTypeOK {
+				t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+			}
+
+			if response := checkTx(t, app, test.ticket); response.Code != test.beforeCommit {
+				t.Errorf("CheckTx before Commit returned code %v (%v), want %v", response.Code, response.Log, test.beforeCommit)
+			}
+			app.Commit()
+			if response := checkTx(t, app, test.ticket); response.Code != test.afterCommit {
+				t.Errorf("Recheck after Commit returned code %v (%v), want %v", response.Code, response.Log, test.afterCommit)
+			}
+		})
+	}
+}
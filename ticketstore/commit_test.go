@@ -0,0 +1,122 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// TestCommitMatchesRebuild delivers random blocks of new tickets, resales
+// and burns, checking each committed root against a tree built from scratch
+// and that the state kept for every earlier height is still what it was
+func TestCommitMatchesRebuild(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	keys := []*ecdsa.PrivateKey{aliceKey, bobKey, carolKey}
+	app := NewTicketStoreApplication()
+
+	// live holds the current version of each live ticket and its owner's key
+	live := make(map[uint64]TicketTx)
+	liveKeys := make(map[uint64]*ecdsa.PrivateKey)
+	burned := make(map[uint64]bool)
+	dumps := make(map[int64]dumpResponse)
+	holders := make(map[int64][]holder)
+	for height := int64(1); height <= 30; height++ {
+		var block []TicketTx
+		changed := make(map[uint64]bool)
+		for i := 0; i < 3; i++ {
+			id := uint64(1 + random.Intn(60))
+			if changed[id] || burned[id] {
+				continue
+			}
+			changed[id] = true
+			ticket, exists := live[id]
+			key := keys[random.Intn(len(keys))]
+			switch {
+			case !exists:
+				ticket = newTicket(id, key)
+			case random.Intn(3) == 0:
+				ticket = resell(t, ticket, liveKeys[id], burnAddress)
+				key = nil
+			default:
+				ticket = resell(t, ticket, liveKeys[id], address(key))
+			}
+			block = append(block, ticket)
+			if key == nil {
+				delete(live, id)
+				delete(liveKeys, id)
+				burned[id] = true
+			} else {
+				live[id], liveKeys[id] = ticket, key
+			}
+		}
+		appHash := commitBlock(t, app, block...)
+
+		byId := make(map[uint64]Ticket, len(live))
+		for id, ticket := range live {
+			byId[id] = Ticket{TicketTx: ticket}
+		}
+		var sorted []TicketTx
+		for _, ticket := range sortTickets(byId) {
+			sorted = append(sorted, ticket.TicketTx)
+		}
+		want := referenceRoot(t, sha256.New, sorted...)
+		if len(sorted) == 0 {
+			want = sha256.New().Sum(nil)
+		}
+		if !bytes.Equal(appHash, want) {
+			t.Fatalf("Commit of height %v returned %x, want %x", height, appHash, want)
+		}
+
+		var dump dumpResponse
+		queryJSON(t, app, "dump", "", 0, &dump)
+		dumps[height] = dump
+		holders[height] = app.state.owners.holders(0)
+	}
+
+	for height, want := range dumps {
+		var dump dumpResponse
+		queryJSON(t, app, "dump", "", height, &dump)
+		if !reflect.DeepEqual(dump, want) {
+			t.Errorf("Dump at height %v is %+v, want %+v as it was committed", height, dump, want)
+		}
+		var ranked []holder
+		queryJSON(t, app, "holders", "", height, &ranked)
+		if !reflect.DeepEqual(ranked, holders[height]) {
+			t.Errorf("Holders at height %v are %+v, want %+v as they were committed", height, ranked, holders[height])
+		}
+	}
+}
+
+// BenchmarkCommit commits a block creating one ticket on top of a state
+// holding many, which costs the same whatever the state holds
+func BenchmarkCommit(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			app := NewTicketStoreApplication()
+			tickets := make([]TicketTx, size)
+			for i := range tickets {
+				tickets[i] = newTicket(uint64(i+1), aliceKey)
+			}
+			commitBlock(b, app, tickets...)
+			txs := make([][]byte, b.N)
+			for i := range txs {
+				txs[i] = encodeTx(b, newTicket(uint64(size+i+1), bobKey))
+			}
+
+			b.ResetTimer()
+			for _, tx := range txs {
+				deliver := app.DeliverTx(types.RequestDeliverTx{Tx: tx})
+				if deliver.Code != codeTypeOK {
+					b.Fatalf("DeliverTx returned code %v: %v", deliver.Code, deliver.Log)
+				}
+				app.Commit()
+			}
+		})
+	}
+}
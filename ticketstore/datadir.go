@@ -0,0 +1,229 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// A data directory holds
+//
+//	state.json               the committed state as of the last flush
+//	wal.jsonl                one line per commit since the last flush
+//	snapshots/<height>.json  the most recent snapshots
+//
+// The state file and snapshots share the snapshotState encoding.
+
+const snapshotDirName = "snapshots"
+
+// StoredState describes a state file or snapshot in a data directory
+type StoredState struct {
+	Path     string `json:"path"`
+	Height   int64  `json:"height"`
+	Bytes    int64  `json:"bytes"`
+	Tickets  int    `json:"tickets"`
+	RootHash string `json:"rootHash"`
+}
+
+// DataDirLayout is what ReadDataDir found in a data directory
+type DataDirLayout struct {
+	// State is the state file, nil if none has been flushed yet
+	State *StoredState `json:"state"`
+	// WALHeights are the heights logged since State was flushed
+	WALHeights []int64 `json:"walHeights"`
+	// Snapshots are ordered by height
+	Snapshots []StoredState `json:"snapshots"`
+}
+
+// ReadDataDir lists the state file, write-ahead log and snapshots in dataDir
+// without opening it as an application, so a stopped node's data can be
+// inspected before deciding how to recover it. Root hashes are recomputed
+// with hashStrategy, which is sha256 when nil, and must match the one the
+// node runs with
+func ReadDataDir(dataDir string, hashStrategy func() hash.Hash) (DataDirLayout, error) {
+	if hashStrategy == nil {
+		hashStrategy = sha256.New
+	}
+	if _, err := os.Stat(dataDir); err != nil {
+		return DataDirLayout{}, err
+	}
+
+	layout := DataDirLayout{WALHeights: []int64{}, Snapshots: []StoredState{}}
+	stored, err := readStoredState(filepath.Join(dataDir, stateFileName), hashStrategy)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return DataDirLayout{}, err
+	default:
+		layout.State = &stored
+	}
+
+	layout.WALHeights, err = readWALHeights(dataDir)
+	if err != nil {
+		return DataDirLayout{}, err
+	}
+
+	heights, err := snapshotFileHeights(dataDir)
+	if err != nil {
+		return DataDirLayout{}, err
+	}
+	for _, height := range heights {
+		stored, err := readStoredState(snapshotFilePath(dataDir, height), hashStrategy)
+		if err != nil {
+			return DataDirLayout{}, err
+		}
+		layout.Snapshots = append(layout.Snapshots, stored)
+	}
+	return layout, nil
+}
+
+func readStoredState(path string, hashStrategy func() hash.Hash) (StoredState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return StoredState{}, err
+	}
+	restored, err := decodeSnapshotState(data, hashStrategy)
+	if err != nil {
+		return StoredState{}, fmt.Errorf("%v: %v", path, err)
+	}
+	return StoredState{
+		Path:     path,
+		Height:   restored.height,
+		Bytes:    int64(len(data)),
+		Tickets:  len(restored.tickets),
+		RootHash: hexutil.Encode(restored.appHash())}, nil
+}
+
+// readWALHeights returns the heights logged in dataDir's write-ahead log,
+// leaving out a partly written last entry
+func readWALHeights(dataDir string) ([]int64, error) {
+	heights := []int64{}
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, walFileName))
+	if os.IsNotExist(err) {
+		return heights, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var entry walEntry
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &entry) != nil {
+			continue
+		}
+		heights = append(heights, entry.Height)
+	}
+	return heights, nil
+}
+
+func snapshotFilePath(dataDir string, height int64) string {
+	return filepath.Join(dataDir, snapshotDirName, fmt.Sprintf("%d.json", height))
+}
+
+// snapshotFileHeights returns the heights of the snapshots in dataDir, lowest
+// first. Files not named after a height are ignored
+func snapshotFileHeights(dataDir string) ([]int64, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dataDir, snapshotDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var heights []int64
+	for _, file := range files {
+		height, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), ".json"), 10, 64)
+		if err != nil || file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
+
+func writeSnapshotFile(dataDir string, height int64, data []byte) error {
+	if err := os.MkdirAll(filepath.Join(dataDir, snapshotDirName), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(snapshotFilePath(dataDir, height), data)
+}
+
+// pruneSnapshotFiles removes all but the keep most recent snapshots in
+// dataDir
+func pruneSnapshotFiles(dataDir string, keep int) error {
+	heights, err := snapshotFileHeights(dataDir)
+	if err != nil {
+		return err
+	}
+	for len(heights) > keep {
+		if err := os.Remove(snapshotFilePath(dataDir, heights[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		heights = heights[1:]
+	}
+	return nil
+}
+
+// RestoreDataDir makes the snapshot at snapshotPath the state of dataDir,
+// as written by a node's snapshots or state file. The snapshot's tree is
+// rebuilt with hashStrategy, sha256 when nil, and must reproduce the root the
+// snapshot recorded before the state file is written. A data directory that
+// already holds anything is only replaced when force is set, in which case
+// its write-ahead log and snapshots are removed too
+func RestoreDataDir(dataDir string, snapshotPath string, force bool, hashStrategy func() hash.Hash) (StoredState, error) {
+	if hashStrategy == nil {
+		hashStrategy = sha256.New
+	}
+	data, err := ioutil.ReadFile(snapshotPath)
+	if err != nil {
+		return StoredState{}, err
+	}
+	stored, err := readStoredState(snapshotPath, hashStrategy)
+	if err != nil {
+		return StoredState{}, err
+	}
+	var recorded snapshotState
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return StoredState{}, err
+	}
+	if recorded.RootHash == "" {
+		return StoredState{}, fmt.Errorf("%v does not record its root hash, so the restored state cannot be checked", snapshotPath)
+	}
+
+	files, err := ioutil.ReadDir(dataDir)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return StoredState{}, err
+	case len(files) > 0 && !force:
+		return StoredState{}, fmt.Errorf("%v is not empty", dataDir)
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return StoredState{}, err
+	}
+	for _, name := range []string{walFileName, snapshotDirName} {
+		if err := os.RemoveAll(filepath.Join(dataDir, name)); err != nil {
+			return StoredState{}, err
+		}
+	}
+	// The state file is written last and atomically, so an interrupted
+	// restore never leaves a state that looks usable
+	path := filepath.Join(dataDir, stateFileName)
+	if err := writeFileAtomic(path, data); err != nil {
+		return StoredState{}, err
+	}
+	stored.Path = path
+	return stored, nil
+}
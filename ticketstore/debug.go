@@ -0,0 +1,57 @@
+package ticketstore
+
+import "github.com/ethereum/go-ethereum/common/hexutil"
+
+// treeResponse is the tree query's result: the tree's leaves in order and
+// the hashes of its nodes level by level, from the leaves up to the root. A
+// level with an odd number of nodes has its last node repeated, so the last
+// leaf can appear twice
+type treeResponse struct {
+	Leaves   []treeLeaf `json:"leaves"`
+	Levels   [][]string `json:"levels"`
+	RootHash string     `json:"rootHash"`
+	Height   int64      `json:"height"`
+}
+
+type treeLeaf struct {
+	Id   uint64 `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// WithDebugQueries answers the tree query, which exposes the whole Merkle
+// tree. It is off by default since the response grows with every ticket
+func WithDebugQueries() Option {
+	return func(app *TicketStoreApplication) {
+		app.debugQueries = true
+	}
+}
+
+// dumpTree describes the snapshot's tree. An empty tree has no leaves or levels
+func (snapshot snapshot) dumpTree(height int64) treeResponse {
+	response := treeResponse{
+		Leaves:   []treeLeaf{},
+		Levels:   [][]string{},
+		RootHash: hexutil.Encode(snapshot.rootHash()),
+		Height:   height}
+	if snapshot.tree == nil {
+		return response
+	}
+
+	levels := snapshot.tree.levels()
+	for i, level := range levels[:len(levels)-1] {
+		if len(level)%2 == 1 {
+			levels[i] = append(level, level[len(level)-1])
+		}
+	}
+	for _, leaf := range levels[0] {
+		response.Leaves = append(response.Leaves, treeLeaf{Id: leaf.ticket.Id, Hash: hexutil.Encode(leaf.hash)})
+	}
+	for _, level := range levels {
+		hashes := make([]string, len(level))
+		for i, node := range level {
+			hashes[i] = hexutil.Encode(node.hash)
+		}
+		response.Levels = append(response.Levels, hashes)
+	}
+	return response
+}
@@ -0,0 +1,49 @@
+package ticketstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestTicketTxShape(t *testing.T) {
+	alice := address(aliceKey)
+	tests := []struct {
+		name string
+		tx   string
+		code uint32
+		log  string
+	}{
+		{"correctly shaped", `{"id":1,"nonce":1,"details":"Seat 1","ownerAddr":"` + alice + `"}`, codeTypeOK, ""},
+		{"without the optional details", `{"id":1,"nonce":1,"ownerAddr":"` + alice + `"}`, codeTypeOK, ""},
+		{"owner instead of ownerAddr", `{"id":1,"nonce":1,"owner":"` + alice + `"}`, codeTypeEncodingError, `unknown field "owner"`},
+		{"unknown field besides the required ones", `{"id":1,"nonce":1,"ownerAddr":"` + alice + `","seat":"A1"}`, codeTypeEncodingError, `unknown field "seat"`},
+		{"missing id", `{"nonce":1,"ownerAddr":"` + alice + `"}`, codeTypeEncodingError, "missing required field id"},
+		{"missing nonce", `{"id":1,"ownerAddr":"` + alice + `"}`, codeTypeEncodingError, "missing required field nonce"},
+		{"missing ownerAddr", `{"id":1,"nonce":1}`, codeTypeEncodingError, "missing required field ownerAddr"},
+		{"trailing data", `{"id":1,"nonce":1,"ownerAddr":"` + alice + `"} {}`, codeTypeEncodingError, "single JSON object"},
+		{"bundle with a misshapen ticket", `[{"id":1,"nonce":1,"ownerAddr":"` + alice + `"},{"id":2,"nonce":1}]`, codeTypeEncodingError, "missing required field ownerAddr"},
+		{"empty bundle", `[]`, codeTypeEncodingError, "must not be empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			check := app.CheckTx(types.RequestCheckTx{Tx: []byte(test.tx)})
+			if check.Code != test.code || !strings.Contains(check.Log, test.log) {
+				t.Errorf("CheckTx returned code %v (%v), want %v containing %q", check.Code, check.Log, test.code, test.log)
+			}
+			deliver := app.DeliverTx(types.RequestDeliverTx{Tx: []byte(test.tx)})
+			if deliver.Code != test.code || !strings.Contains(deliver.Log, test.log) {
+				t.Errorf("DeliverTx returned code %v (%v), want %v containing %q", deliver.Code, deliver.Log, test.code, test.log)
+			}
+			app.Commit()
+
+			// Only the correctly shaped ticket is stored
+			response := query(app, "ticket", "1", 0)
+			if stored := response.Code == codeTypeOK; stored != (test.code == codeTypeOK) {
+				t.Errorf("Ticket query after Commit returned code %v (%v)", response.Code, response.Log)
+			}
+		})
+	}
+}
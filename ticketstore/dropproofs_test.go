@@ -0,0 +1,139 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestWithoutStoredProofs(t *testing.T) {
+	const size = 8
+	issued := make([]TicketTx, size)
+	resold := make([]TicketTx, size)
+	for i := range issued {
+		issued[i] = newTicket(uint64(i+1), aliceKey)
+		resold[i] = resell(t, issued[i], aliceKey, address(bobKey))
+	}
+	root := referenceRoot(t, sha256.New, resold...)
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		proofsStored bool
+		eip712Code   uint32
+		eip712Log    string
+	}{
+		{"proofs stored", nil, true, codeTypeOK, ""},
+		{"proofs dropped", []Option{WithoutStoredProofs()}, false, codeTypeTicketError, ErrProofNotStored.Error()},
+	}
+	stateSizes := make(map[bool]int64)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, cleanup := tempDir(t)
+			defer cleanup()
+			app := openApp(t, dataDir, test.opts...)
+			commitBlock(t, app, issued...)
+			if committed := commitBlock(t, app, resold...); !bytes.Equal(committed, root) {
+				t.Errorf("Committed root is %x, want %x", committed, root)
+			}
+			if err := app.Close(); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(filepath.Join(dataDir, stateFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stateSizes[test.proofsStored] = info.Size()
+
+			// The reopened state rebuilds the same root from what was kept
+			app = openApp(t, dataDir, test.opts...)
+			if reopened := app.Info(types.RequestInfo{}).LastBlockAppHash; !bytes.Equal(reopened, root) {
+				t.Errorf("Reopened root is %x, want %x", reopened, root)
+			}
+
+			for _, ticket := range resold {
+				var proof TicketResponse
+				queryJSON(t, app, "ticket", fmt.Sprint(ticket.Id), 0, &proof)
+				if stored := proof.Ticket.PrevOwnerProof == ticket.PrevOwnerProof; stored != test.proofsStored {
+					t.Errorf("Ticket %v is stored with proof %q, want it stored %v", ticket.Id, proof.Ticket.PrevOwnerProof, test.proofsStored)
+				}
+				data, _ := json.Marshal(proof)
+				var verified verifyResponse
+				queryJSON(t, app, "verify", string(data), 0, &verified)
+				if !verified.Valid {
+					t.Errorf("Proof of ticket %v does not verify: %+v", ticket.Id, verified)
+				}
+
+				var solidityProof SolidityProof
+				queryJSON(t, app, "solidityProof", fmt.Sprint(ticket.Id), 0, &solidityProof)
+				leaf, _ := ticket.CalculateHash()
+				if solidityProof.Leaf != hexutil.Encode(leaf) || !verifySolidityProof(t, sha256.New, leaf, solidityProof, root) {
+					t.Errorf("Solidity proof %+v of ticket %v does not verify leaf %x", solidityProof, ticket.Id, leaf)
+				}
+			}
+
+			// The queried ticket is all a default resale is signed over
+			var stored TicketResponse
+			queryJSON(t, app, "ticket", "1", 0, &stored)
+			if response := checkTx(t, app, resell(t, stored.Ticket.TicketTx, bobKey, address(carolKey))); response.Code != codeTypeOK {
+				t.Errorf("Resale signed over the queried ticket returned code %v: %v", response.Code, response.Log)
+			}
+
+			hash, err := ownerProofSchemes["eip712"].signedHash(resold[1], 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eip712Resale := TicketTx{Id: 2, Nonce: 3, Details: resold[1].Details, OwnerAddr: address(carolKey),
+				PrevOwnerProof: signRecoveryId(t, hash, bobKey, legacyV), ProofScheme: "eip712"}
+			response := checkTx(t, app, eip712Resale)
+			if response.Code != test.eip712Code || !strings.Contains(response.Log, test.eip712Log) {
+				t.Errorf("eip712 resale returned code %v (%v), want %v (%v)", response.Code, response.Log, test.eip712Code, test.eip712Log)
+			}
+		})
+	}
+
+	if stateSizes[false] >= stateSizes[true] {
+		t.Errorf("State without proofs is %v bytes, want less than the %v bytes with them", stateSizes[false], stateSizes[true])
+	}
+}
+
+func TestTicketLeafDecoding(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{"leaf", `{"ticketTx":{"id":1},"leaf":"0x` + strings.Repeat("ab", 32) + `"}`, ""},
+		{"no leaf", `{"ticketTx":{"id":1,"prevOwnerProof":"0x01"}}`, ""},
+		{"proof and leaf", `{"ticketTx":{"id":1,"prevOwnerProof":"0x01"},"leaf":"0x` + strings.Repeat("ab", 32) + `"}`, "has both a prevOwnerProof and a leaf"},
+		{"short leaf", `{"ticketTx":{"id":1},"leaf":"0xab"}`, "invalid leaf"},
+		{"leaf not hex", `{"ticketTx":{"id":1},"leaf":"leaf"}`, "invalid leaf"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ticket Ticket
+			err := json.Unmarshal([]byte(test.json), &ticket)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Decoding returned %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, _ := ticket.CalculateHash()
+			if ticket.Leaf != "" && hexutil.Encode(hash) != ticket.Leaf {
+				t.Errorf("Decoded ticket hashes to %x, want its leaf %v", hash, ticket.Leaf)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package ticketstore
+
+import (
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestDuplicateTickets(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	resale := resell(t, issued, aliceKey, address(bobKey))
+	conflicting := issued
+	conflicting.Details = "Another seat"
+
+	tests := []struct {
+		name      string
+		committed []TicketTx
+		pending   []TicketTx
+		ticket    TicketTx
+		code      uint32
+		want      TicketTx
+	}{
+		{"issue replayed in a later block", []TicketTx{issued}, nil, issued, codeTypeDuplicate, issued},
+		{"issue replayed in the same block", nil, []TicketTx{issued}, issued, codeTypeDuplicate, issued},
+		{"resale replayed", []TicketTx{issued, resale}, nil, resale, codeTypeDuplicate, resale},
+		{"same nonce with other details", []TicketTx{issued}, nil, conflicting, codeTypeTicketError, issued},
+		{"issue replayed after a resale", []TicketTx{issued, resale}, nil, issued, codeTypeTicketError, resale},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			for _, ticket := range test.committed {
+				commitBlock(t, app, ticket)
+			}
+			for _, ticket := range test.pending {
+				deliver(t, app, ticket)
+			}
+
+			if len(test.pending) == 0 {
+				if response := app.CheckTx(types.RequestCheckTx{Tx: encodeTx(t, test.ticket)}); response.Code != test.code {
+					t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+				}
+			}
+			// Delivering twice gives the same answer every time
+			for i := 0; i < 2; i++ {
+				if response := deliver(t, app, test.ticket); response.Code != test.code {
+					t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+				}
+			}
+			app.Commit()
+			if stored := app.state.tickets[1].TicketTx; stored != test.want {
+				t.Errorf("Stored ticket is %+v, want %+v", stored, test.want)
+			}
+		})
+	}
+}
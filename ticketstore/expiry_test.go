@@ -0,0 +1,66 @@
+package ticketstore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestValidUntil(t *testing.T) {
+	blockTime := time.Unix(1700000000, 0)
+	issued := newTicket(1, aliceKey)
+	deadline := func(ticket TicketTx, validUntil int64) TicketTx {
+		ticket.ValidUntil = validUntil
+		return ticket
+	}
+	tests := []struct {
+		name      string
+		ticket    TicketTx
+		blockTime time.Time
+		code      uint32
+	}{
+		{"issue without a deadline", newTicket(2, bobKey), blockTime, codeTypeOK},
+		{"issue before its deadline", deadline(newTicket(2, bobKey), blockTime.Unix()+60), blockTime, codeTypeOK},
+		{"issue in the deadline's second", deadline(newTicket(2, bobKey), blockTime.Unix()), blockTime, codeTypeOK},
+		{"issue after its deadline", deadline(newTicket(2, bobKey), blockTime.Unix()-1), blockTime, codeTypeExpired},
+		{"resale before its deadline", deadline(resell(t, issued, aliceKey, address(bobKey)), blockTime.Unix()+60), blockTime, codeTypeOK},
+		{"resale after its deadline", deadline(resell(t, issued, aliceKey, address(bobKey)), blockTime.Unix()-1), blockTime, codeTypeExpired},
+		{"resale in a later block past its deadline", deadline(resell(t, issued, aliceKey, address(bobKey)), blockTime.Unix()+60), blockTime.Add(time.Hour), codeTypeExpired},
+		{"block without a time", deadline(newTicket(2, bobKey), 1), time.Time{}, codeTypeOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: 1, Time: blockTime}})
+			commitBlock(t, app, issued)
+			root := app.Info(types.RequestInfo{}).LastBlockAppHash
+
+			// CheckTx compares with the last committed block's time
+			if test.blockTime.Equal(blockTime) {
+				if response := checkTx(t, app, test.ticket); response.Code != test.code {
+					t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+				}
+			}
+
+			app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: 2, Time: test.blockTime}})
+			if response := deliver(t, app, test.ticket); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			app.Commit()
+
+			var stored TicketResponse
+			queryJSON(t, app, "ticket", "1", 0, &stored)
+			resold := stored.Ticket.OwnerAddr == address(bobKey)
+			if test.ticket.Id == issued.Id && resold != (test.code == codeTypeOK) {
+				t.Errorf("Ticket 1 is owned by %v after a tx returning code %v", stored.Ticket.OwnerAddr, test.code)
+			}
+			if test.code != codeTypeOK {
+				if info := app.Info(types.RequestInfo{}); !bytes.Equal(info.LastBlockAppHash, root) {
+					t.Errorf("Root changed to %x by an expired tx", info.LastBlockAppHash)
+				}
+			}
+		})
+	}
+}
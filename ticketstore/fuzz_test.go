@@ -0,0 +1,144 @@
+//go:build go1.18
+// +build go1.18
+
+package ticketstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// fuzzTxSeeds are tricky txs for the tx fuzz targets to start from. The
+// corpus under testdata/fuzz adds more, several of them found while fuzzing
+func fuzzTxSeeds(f *testing.F) [][]byte {
+	issued := newTicket(1, aliceKey)
+	resale := resell(f, issued, aliceKey, address(bobKey))
+	return [][]byte{
+		encodeTx(f, newTicket(2, aliceKey)),
+		encodeTx(f, resale),
+		encodeTx(f, resale, resell(f, resale, bobKey, address(carolKey))),
+		encodeTx(f, resell(f, issued, aliceKey, burnAddress)),
+		[]byte(``),
+		[]byte(`null`),
+		[]byte(`[]`),
+		[]byte(`[null]`),
+		[]byte(`{}`),
+		[]byte(`{"id":1,"nonce":2,"ownerAddr":"0x0","prevOwnerProof":"0x"}`),
+		[]byte(`{"id":1,"nonce":2,"ownerAddr":"` + address(bobKey) + `","prevOwnerProof":"0xzz"}`),
+		[]byte(`{"id":18446744073709551615,"nonce":18446744073709551615,"ownerAddr":"` + address(aliceKey) + `"}`),
+		[]byte(`{"id":-1,"nonce":1.5,"ownerAddr":1}`),
+		[]byte(`{"id":2,"nonce":1,"ownerAddr":"` + address(aliceKey) + `","details":"\ud800"}`),
+		[]byte(`{"id":2,"nonce":1,"ownerAddr":"` + address(aliceKey) + `","id":3}`),
+		[]byte(`[[[[[[[[[[[[[[[[[[[[`),
+	}
+}
+
+// FuzzDeliverTxTicketStore checks that no tx, however malformed, makes
+// DeliverTx or CheckTx panic or answer with a code that is not defined, and
+// that both agree on whether a tx is valid against the same state
+func FuzzDeliverTxTicketStore(f *testing.F) {
+	for _, seed := range fuzzTxSeeds(f) {
+		f.Add(seed)
+	}
+	issued := newTicket(1, aliceKey)
+	f.Fuzz(func(t *testing.T, tx []byte) {
+		app := NewTicketStoreApplication()
+		commitBlock(t, app, issued)
+
+		check := app.CheckTx(types.RequestCheckTx{Tx: tx})
+		deliver := app.DeliverTx(types.RequestDeliverTx{Tx: tx})
+		for _, code := range []uint32{check.Code, deliver.Code} {
+			if _, defined := codes.Descriptions[code]; !defined || code == codeTypeInternalError {
+				t.Fatalf("Tx %q returned code %v: %v", tx, code, check.Log+deliver.Log)
+			}
+		}
+		if check.Code != deliver.Code {
+			t.Errorf("CheckTx returned code %v (%v) but DeliverTx %v (%v)", check.Code, check.Log, deliver.Code, deliver.Log)
+		}
+		app.Commit()
+	})
+}
+
+// FuzzDecodeTicketTxs checks that decoding never panics, that every decoded
+// ticket can be validated, and that a decoded ticket encodes back to itself
+func FuzzDecodeTicketTxs(f *testing.F) {
+	for _, seed := range fuzzTxSeeds(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, tx []byte) {
+		ticketTxs, err := decodeTicketTxs(tx)
+		if err != nil {
+			return
+		}
+		if len(ticketTxs) == 0 {
+			t.Fatalf("Tx %q decoded to no tickets", tx)
+		}
+		for _, ticketTx := range ticketTxs {
+			ticketTx.validate(TicketTx{}, validationRules{})
+			ticketTx.validate(newTicket(ticketTx.Id, aliceKey), validationRules{chainId: 5})
+
+			encoded, err := json.Marshal(ticketTx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decodeTicketTx(encoded)
+			if err != nil || !reflect.DeepEqual(decoded, ticketTx) {
+				t.Errorf("Ticket %+v encoded as %s decodes to %+v, %v", ticketTx, encoded, decoded, err)
+			}
+		}
+	})
+}
+
+// FuzzRecoverSigner checks that proof parsing never panics, that a signer is
+// only recovered with a legacy or EIP-155 v, and never from an altered
+// signature
+func FuzzRecoverSigner(f *testing.F) {
+	issued := newTicket(1, aliceKey)
+	signedHash, err := ownerProofSchemes[""].signedHash(issued, 0)
+	if err != nil {
+		f.Fatal(err)
+	}
+	canonical, err := SignTicketTransfer(issued, aliceKey)
+	if err != nil {
+		f.Fatal(err)
+	}
+	canonicalBytes := hexutil.MustDecode(canonical)
+
+	f.Add(canonical, uint8(0))
+	f.Add(canonical, uint8(5))
+	f.Add(canonical+"00", uint8(0))
+	f.Add(canonical[:len(canonical)-2]+"00", uint8(0))
+	f.Add(canonical[:len(canonical)-2]+"2d", uint8(5))
+	f.Add(canonical[:len(canonical)-2]+"0135", uint8(137))
+	f.Add("0x", uint8(0))
+	f.Add("0x0", uint8(0))
+	f.Add("", uint8(0))
+	f.Add("0X"+canonical[2:], uint8(0))
+	f.Fuzz(func(t *testing.T, proof string, chainId uint8) {
+		signer, err := recoverSigner(signedHash, proof, uint64(chainId))
+		if err != nil {
+			return
+		}
+		proofBytes, err := hexutil.Decode(proof)
+		if err != nil || len(proofBytes) < 65 || proofBytes[64] == 0 {
+			t.Fatalf("Proof %q recovered %v without being hex r, s and an unpadded v", proof, signer)
+		}
+		var v uint64
+		for _, b := range proofBytes[64:] {
+			v = v<<8 | uint64(b)
+		}
+		base := 35 + 2*uint64(chainId)
+		if v != 27 && v != 28 && (chainId == 0 || (v != base && v != base+1)) {
+			t.Errorf("Proof %q recovered %v with v %v, not legacy or EIP-155 for chain id %v", proof, signer, v, chainId)
+		}
+		if signer == address(aliceKey) && !bytes.Equal(proofBytes[:64], canonicalBytes[:64]) {
+			t.Errorf("Proof %q for chain id %v recovered the signer of %v from another signature", proof, chainId, canonical)
+		}
+	})
+}
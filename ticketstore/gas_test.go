@@ -0,0 +1,54 @@
+package ticketstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGas(t *testing.T) {
+	withDetails := func(id uint64, details string) TicketTx {
+		ticket := newTicket(id, aliceKey)
+		ticket.Details = details
+		return ticket
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		tickets []TicketTx
+		gas     int64
+	}{
+		{"no details", nil, []TicketTx{withDetails(1, "")}, defaultTxGas},
+		{"ten bytes of details", nil, []TicketTx{withDetails(1, strings.Repeat("a", 10))}, defaultTxGas + 10*defaultGasPerByte},
+		{"hundred bytes of details", nil, []TicketTx{withDetails(1, strings.Repeat("a", 100))}, defaultTxGas + 100*defaultGasPerByte},
+		{"multibyte details count bytes", nil, []TicketTx{withDetails(1, "é")}, defaultTxGas + 2*defaultGasPerByte},
+		{"configured price", []Option{WithGas(5, 3)}, []TicketTx{withDetails(1, "abcd")}, 5 + 4*3},
+		{"free", []Option{WithGas(0, 0)}, []TicketTx{withDetails(1, "abcd")}, 0},
+		{"bundle", []Option{WithGas(5, 3)}, []TicketTx{withDetails(1, "ab"), withDetails(2, "abc")}, 5 + 2*3 + 5 + 3*3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(test.opts...)
+			check := checkTx(t, app, test.tickets...)
+			if check.Code != codeTypeOK || check.GasWanted != test.gas || check.GasUsed != test.gas {
+				t.Errorf("CheckTx returned code %v with gas %v wanted and %v used, want %v", check.Code, check.GasWanted, check.GasUsed, test.gas)
+			}
+			response := deliver(t, app, test.tickets...)
+			if response.Code != codeTypeOK || response.GasWanted != test.gas || response.GasUsed != test.gas {
+				t.Errorf("DeliverTx returned code %v with gas %v wanted and %v used, want %v", response.Code, response.GasWanted, response.GasUsed, test.gas)
+			}
+		})
+	}
+}
+
+func TestRejectedTxUsesNoGas(t *testing.T) {
+	app := NewTicketStoreApplication()
+	ticket := newTicket(1, aliceKey)
+	ticket.Id = 0
+	if response := deliver(t, app, ticket); response.Code == codeTypeOK || response.GasUsed != 0 {
+		t.Errorf("DeliverTx returned code %v with %v gas used, want a rejection using none", response.Code, response.GasUsed)
+	}
+	if response := checkTx(t, app, ticket); response.Code == codeTypeOK || response.GasUsed != 0 {
+		t.Errorf("CheckTx returned code %v with %v gas used, want a rejection using none", response.Code, response.GasUsed)
+	}
+}
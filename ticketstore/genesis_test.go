@@ -0,0 +1,134 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestInitChain(t *testing.T) {
+	genesis := []TicketTx{newTicket(2, aliceKey), newTicket(1, bobKey), {Id: 3, Nonce: 0, OwnerAddr: address(carolKey)}}
+
+	tests := []struct {
+		name     string
+		appState []byte
+		opts     []Option
+		tickets  []TicketTx
+	}{
+		{"no app state", nil, nil, nil},
+		{"tickets", encodeTx(t, genesis...), nil, []TicketTx{genesis[1], genesis[0], genesis[2]}},
+		{"tickets without issuer signatures", encodeTx(t, genesis...), []Option{WithIssuers(address(carolKey))}, []TicketTx{genesis[1], genesis[0], genesis[2]}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(test.opts...)
+			app.InitChain(types.RequestInitChain{AppStateBytes: test.appState})
+
+			if len(app.state.tickets) != len(test.tickets) || app.state.height != 0 {
+				t.Fatalf("Genesis holds %v tickets at height %v, want %v at 0", len(app.state.tickets), app.state.height, len(test.tickets))
+			}
+			want := referenceRoot(t, sha256.New, test.tickets...)
+			if !bytes.Equal(app.state.appHash(), want) {
+				t.Errorf("Genesis root is %x, want %x", app.state.appHash(), want)
+			}
+			if info := app.Info(types.RequestInfo{}); !bytes.Equal(info.LastBlockAppHash, want) {
+				t.Errorf("Info returned app hash %x, want %x", info.LastBlockAppHash, want)
+			}
+			// Without tickets the first block commits the empty tree's hash
+			if root := commitBlock(t, app); len(want) > 0 && !bytes.Equal(root, want) {
+				t.Errorf("First empty block changed the root from %x to %x", want, root)
+			}
+			for _, ticket := range test.tickets {
+				var proof TicketResponse
+				queryJSON(t, app, "ticket", fmt.Sprint(ticket.Id), 0, &proof)
+				if valid, err := proof.verify(want, sha256.New); err != nil || !valid {
+					t.Errorf("Proof of genesis ticket %v does not verify: %v", ticket.Id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestInitChainRejectsInvalidGenesis(t *testing.T) {
+	tests := []struct {
+		name     string
+		appState string
+	}{
+		{"not JSON", "tickets"},
+		{"ticket issued twice", string(encodeTx(t, newTicket(1, aliceKey), newTicket(1, bobKey)))},
+		{"zero id", `[{"id":0,"nonce":1,"ownerAddr":"` + address(aliceKey) + `"}]`},
+		{"bad owner", `[{"id":1,"nonce":1,"ownerAddr":"alice"}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("InitChain accepted an invalid genesis")
+				}
+			}()
+			NewTicketStoreApplication().InitChain(types.RequestInitChain{AppStateBytes: []byte(test.appState)})
+		})
+	}
+}
+
+func TestDumpReimport(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		hashStrategy func() hash.Hash
+	}{
+		{"default", nil, sha256.New},
+		{"checksummed addresses", []Option{WithChecksummedAddresses()}, sha256.New},
+		{"strict nonces", []Option{WithStrictNonces()}, sha256.New},
+		{"issuers", []Option{WithIssuers(address(carolKey))}, sha256.New},
+		{"keccak256", nil, Keccak256},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := NewTicketStoreApplication(WithHashStrategy(test.hashStrategy))
+			issued := []TicketTx{newTicket(1, aliceKey), newTicket(2, bobKey), newTicket(3, aliceKey), newTicket(4, carolKey)}
+			commitBlock(t, source, issued...)
+			resold := resell(t, issued[0], aliceKey, address(bobKey))
+			commitBlock(t, source, resold, resell(t, issued[2], aliceKey, burnAddress))
+			root := commitBlock(t, source, resell(t, resold, bobKey, address(carolKey)))
+
+			// Dump in pages, as an operator would for a large state
+			var tickets []TicketTx
+			for offset := 0; ; offset += 2 {
+				var dumped dumpResponse
+				queryJSON(t, source, "dump", fmt.Sprintf(`{"limit":2,"offset":%v}`, offset), 0, &dumped)
+				if dumped.RootHash != hexutil.Encode(root) {
+					t.Fatalf("dump query returned root %v, want %x", dumped.RootHash, root)
+				}
+				tickets = append(tickets, dumped.Tickets...)
+				if len(tickets) >= dumped.Total {
+					break
+				}
+			}
+			if len(tickets) != 3 || tickets[0].Nonce != 3 {
+				t.Fatalf("dump returned %+v, want the three live tickets", tickets)
+			}
+
+			imported := NewTicketStoreApplication(append(test.opts, WithHashStrategy(test.hashStrategy))...)
+			imported.InitChain(types.RequestInitChain{AppStateBytes: encodeTx(t, tickets...)})
+			if info := imported.Info(types.RequestInfo{}); !bytes.Equal(info.LastBlockAppHash, root) {
+				t.Errorf("Imported genesis has root %x, want %x", info.LastBlockAppHash, root)
+			}
+			if !reflect.DeepEqual(imported.state.owners, source.state.owners) {
+				t.Errorf("Imported owners are %v, want %v", imported.state.owners, source.state.owners)
+			}
+			// Resales continue from the imported nonces
+			next := resell(t, tickets[0], carolKey, common.HexToAddress(address(aliceKey)).Hex())
+			if response := deliver(t, imported, next); response.Code != codeTypeOK {
+				t.Errorf("Resale of an imported ticket returned code %v: %v", response.Code, response.Log)
+			}
+		})
+	}
+}
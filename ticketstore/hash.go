@@ -0,0 +1,103 @@
+package ticketstore
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"golang.org/x/crypto/sha3"
+)
+
+// The tree's leaves are always TicketTx.CalculateHash, the keccak256 of the
+// ticket's packed Solidity encoding. Each parent is the hash strategy applied
+// to its left child's hash followed by its right child's, and a level with an
+// odd number of nodes repeats its last node. A contract verifying proofs
+// on chain reproduces the root with
+//
+//	node = leaf
+//	for each (sibling, index) in proof:
+//	    node = index == 1 ? H(node ++ sibling) : H(sibling ++ node)
+//
+// where H is sha256 by default or keccak256 with WithHashStrategy(Keccak256)
+
+// Keccak256 is a hash strategy matching Solidity's keccak256, so proofs can be
+// checked on chain without a sha256 precompile call per level
+func Keccak256() hash.Hash {
+	return sha3.NewLegacyKeccak256()
+}
+
+// WithHashStrategy hashes the tree's parent nodes with strategy instead of
+// sha256. Every node on a chain must use the same strategy
+func WithHashStrategy(strategy func() hash.Hash) Option {
+	return func(app *TicketStoreApplication) {
+		app.state.hashStrategy = strategy
+	}
+}
+
+// hashStrategies are the hash strategies that can be chosen by name
+var hashStrategies = map[string]func() hash.Hash{
+	"sha256":    sha256.New,
+	"keccak256": Keccak256,
+}
+
+// HashStrategyNames returns the names HashStrategyNamed accepts, sorted
+func HashStrategyNames() []string {
+	names := make([]string, 0, len(hashStrategies))
+	for name := range hashStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HashStrategyNamed returns the hash strategy called name, so a node and the
+// tools reading its data directory can be configured with the same one
+func HashStrategyNamed(name string) (func() hash.Hash, error) {
+	strategy, ok := hashStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown hash strategy. Expected %v, got %v", strings.Join(HashStrategyNames(), " or "), name)
+	}
+	return strategy, nil
+}
+
+// SolidityProof is a ticket's Merkle proof laid out for a contract taking
+// (bytes32 leaf, bytes32[] proof, uint256 path, bytes32 root). Bit i of Path
+// is set when Proof[i] is the right hand sibling, so the contract computes
+//
+//	node = leaf
+//	for i in 0..len(proof):
+//	    node = (path >> i) & 1 == 1 ? H(node ++ proof[i]) : H(proof[i] ++ node)
+//	require(node == root)
+//
+// Leaf is the ticket's CalculateHash, as described above
+type SolidityProof struct {
+	Leaf  string   `json:"leaf"`
+	Proof []string `json:"proof"`
+	Path  string   `json:"path"`
+	Root  string   `json:"root"`
+}
+
+// solidityProof lays out the proof for an on-chain verifier. root is the root
+// the proof was built against
+func (proof TicketResponse) solidityProof(root []byte) (SolidityProof, error) {
+	leaf, err := proof.Ticket.TicketTx.CalculateHash()
+	if err != nil {
+		return SolidityProof{}, err
+	}
+
+	path := new(big.Int)
+	for i, index := range proof.Index {
+		if index == 1 {
+			path.SetBit(path, i, 1)
+		}
+	}
+	return SolidityProof{
+		Leaf:  hexutil.Encode(leaf),
+		Proof: proof.MerkleProof,
+		Path:  hexutil.EncodeBig(path),
+		Root:  hexutil.Encode(root)}, nil
+}
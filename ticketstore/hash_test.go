@@ -0,0 +1,129 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// The expected hashes below were computed independently of this package from
+// keccak256(abi.encodePacked(uint256 id, uint256 nonce, string details,
+// address ownerAddr, bytes prevOwnerProof)) and the tree layout described in
+// hash.go. A change to any of them changes every root and signature
+var hashVectors = []struct {
+	ticket TicketTx
+	leaf   string
+}{
+	{TicketTx{Id: 1, Nonce: 1, Details: "Ticket 1", OwnerAddr: "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"},
+		"0xf9f4458e37fd0bdab97f02734734fa482122c790306a5170d446e9064fea548a"},
+	{TicketTx{Id: 2, Nonce: 7, Details: "Row G, seat 12", OwnerAddr: "0x90f8bf6a479f320ead074411a4b0e7944ea8c9c1"},
+		"0x499b043082253517576e1aa5bbff60a2270a1ab015a4fe1f75fa23db93bd68d3"},
+	{TicketTx{Id: 3, Nonce: 2, Details: "Ünïcödé", OwnerAddr: "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23", PrevOwnerProof: "0x" + strings.Repeat("ab", 65)},
+		"0xa7102cb75486919d29735ba262a34517419e573aa0569aff294792f28643337a"},
+	{TicketTx{Id: math.MaxUint64, Nonce: 0, Details: "", OwnerAddr: "0x90f8bf6a479f320ead074411a4b0e7944ea8c9c1"},
+		"0xa4385ffa40313e226b14a3483285bfc9bcc35a53039865cb34376523eb1d630d"},
+}
+
+func TestCalculateHashVectors(t *testing.T) {
+	for _, vector := range hashVectors {
+		t.Run(vector.ticket.Details, func(t *testing.T) {
+			leaf, err := vector.ticket.CalculateHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hexutil.Encode(leaf) != vector.leaf {
+				t.Errorf("CalculateHash returned %x, want %v", leaf, vector.leaf)
+			}
+		})
+	}
+}
+
+func TestCalculateHashIgnoresPresentation(t *testing.T) {
+	vector := hashVectors[0]
+	checksummed := vector.ticket
+	checksummed.OwnerAddr = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+	expiring := vector.ticket
+	expiring.ValidUntil = 1700000000
+
+	for name, ticket := range map[string]TicketTx{"checksummed owner": checksummed, "deadline": expiring} {
+		if leaf, _ := ticket.CalculateHash(); hexutil.Encode(leaf) != vector.leaf {
+			t.Errorf("%v changed the hash to %x, want %v", name, leaf, vector.leaf)
+		}
+	}
+}
+
+func TestTreeRootVectors(t *testing.T) {
+	tests := []struct {
+		tickets      int
+		hashStrategy func() hash.Hash
+		root         string
+	}{
+		{1, sha256.New, "0x29988af9a75ec6f28adbab477865266b3d86245cdbbcc92810972dca9d90beaa"},
+		{2, sha256.New, "0xddfb6673f7ab58193e215338be69523801c763a241f829c12d86dc415c6fa3e8"},
+		{3, sha256.New, "0xffcd92efc1e76161631f2e7a4be1ba61864d79af089b1c7935a87914c30b9046"},
+		{4, sha256.New, "0x49ffc3d159a07e07554cc2f68cbb954751278c28ca4346abb1ef42fa62698aaf"},
+		{1, Keccak256, "0x1262b8ae1c3c66d64bb3847e9b63ce56193df1e0ed7f5426a0b5d0dfc2bca60a"},
+		{2, Keccak256, "0xd6d98ada4f2744a17876c16076207fbcee3e5d935d77a59151696ee91a2613c9"},
+		{3, Keccak256, "0x8e05df9fe008aede3dd11bdbae0f9a6eb4040fc477da2e32bd0f1216b22766d1"},
+		{4, Keccak256, "0x300d9b091a57101899127229b0a6b1a43aa4e621fe8c3254a897da7395fe41ba"},
+	}
+	for _, test := range tests {
+		app := NewTicketStoreApplication(WithHashStrategy(test.hashStrategy))
+		// Deliver in reverse so the root only matches if leaves are ordered by id
+		for i := test.tickets - 1; i >= 0; i-- {
+			if response := deliver(t, app, hashVectors[i].ticket); response.Code != codeTypeOK {
+				t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+			}
+		}
+		if root := hexutil.Encode(app.Commit().Data); root != test.root {
+			t.Errorf("Root of %v tickets is %v, want %v", test.tickets, root, test.root)
+		}
+	}
+}
+
+func TestRootIndependentOfDeliveryOrder(t *testing.T) {
+	issued := []TicketTx{newTicket(1, aliceKey), newTicket(2, aliceKey), newTicket(3, bobKey), newTicket(4, bobKey)}
+	resold := []TicketTx{
+		resell(t, issued[0], aliceKey, address(bobKey)),
+		resell(t, issued[2], bobKey, address(aliceKey)),
+	}
+	fresh := []TicketTx{newTicket(5, aliceKey), newTicket(6, bobKey)}
+
+	tests := []struct {
+		name   string
+		before []TicketTx
+		first  []TicketTx
+		second []TicketTx
+	}{
+		{"issues", nil,
+			issued,
+			[]TicketTx{issued[3], issued[1], issued[0], issued[2]}},
+		{"transfers", issued,
+			resold,
+			[]TicketTx{resold[1], resold[0]}},
+		{"issues and transfers", issued,
+			[]TicketTx{resold[0], fresh[0], resold[1], fresh[1]},
+			[]TicketTx{fresh[1], resold[1], fresh[0], resold[0]}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Two nodes agree on the earlier blocks, then receive the same
+			// txs in a different order
+			first, second := NewTicketStoreApplication(), NewTicketStoreApplication()
+			if len(test.before) > 0 {
+				commitBlock(t, first, test.before...)
+				commitBlock(t, second, test.before...)
+			}
+			firstRoot := commitBlock(t, first, test.first...)
+			secondRoot := commitBlock(t, second, test.second...)
+			if !bytes.Equal(firstRoot, secondRoot) {
+				t.Errorf("Commit returned %x on one node and %x on the other", firstRoot, secondRoot)
+			}
+		})
+	}
+}
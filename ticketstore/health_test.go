@@ -0,0 +1,59 @@
+package ticketstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHealthQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		tickets []TicketTx
+		corrupt func(app *TicketStoreApplication)
+		code    uint32
+		log     string
+		health  healthResponse
+	}{
+		{"before the first block", nil, func(*TicketStoreApplication) {}, codeTypeOK, "", healthResponse{}},
+		{"after commits", []TicketTx{newTicket(1, aliceKey), newTicket(2, bobKey)}, func(*TicketStoreApplication) {}, codeTypeOK, "",
+			healthResponse{Height: 2, Tickets: 2, Txs: 2}},
+		{"tickets without a root", []TicketTx{newTicket(1, aliceKey)}, func(app *TicketStoreApplication) {
+			app.state.rootHash = nil
+		}, codeTypeUnhealthy, "1 live tickets but no root hash", healthResponse{}},
+		{"root without tickets", nil, func(app *TicketStoreApplication) {
+			app.state.rootHash = []byte{1}
+		}, codeTypeUnhealthy, "Root hash without any live tickets", healthResponse{}},
+		{"root from another tree", []TicketTx{newTicket(1, aliceKey), newTicket(2, bobKey)}, func(app *TicketStoreApplication) {
+			app.state.rootHash = referenceRoot(t, app.state.hashStrategy, newTicket(1, aliceKey))
+		}, codeTypeUnhealthy, "Root hash does not match the tree committed at height 2", healthResponse{}},
+		{"tickets without a tree", []TicketTx{newTicket(1, aliceKey)}, func(app *TicketStoreApplication) {
+			committed := app.state.history[app.state.height]
+			committed.tree = nil
+			app.state.history[app.state.height] = committed
+		}, codeTypeUnhealthy, "Root hash does not match", healthResponse{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			for _, ticket := range test.tickets {
+				commitBlock(t, app, ticket)
+			}
+			test.corrupt(app)
+
+			response := query(app, "health", "", 0)
+			if response.Code != test.code || !strings.Contains(response.Log, test.log) {
+				t.Fatalf("health query returned code %v (%v), want %v (%v)", response.Code, response.Log, test.code, test.log)
+			}
+			if response.Height != int64(len(test.tickets)) {
+				t.Errorf("health query returned height %v, want %v", response.Height, len(test.tickets))
+			}
+			if test.code == codeTypeOK {
+				var health healthResponse
+				queryJSON(t, app, "health", "", 0, &health)
+				if health != test.health {
+					t.Errorf("health query returned %+v, want %+v", health, test.health)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package ticketstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	alice, bob, carol := address(aliceKey), address(bobKey), address(carolKey)
+	issued := newTicket(1, aliceKey)
+	toBob := resell(t, issued, aliceKey, bob)
+	toCarol := resell(t, toBob, bobKey, carol)
+	toAlice := resell(t, toCarol, carolKey, alice)
+	full := []Transfer{{alice, 1, 1}, {bob, 2, 2}, {carol, 3, 3}, {alice, 4, 4}}
+
+	tests := []struct {
+		name       string
+		maxHistory int
+		height     int64
+		want       []Transfer
+	}{
+		{"whole history", 0, 0, full},
+		{"as of the second owner", 0, 2, full[:2]},
+		{"as issued", 0, 1, full[:1]},
+		{"longer limit than the history", 10, 0, full},
+		{"limit keeps the latest", 2, 0, full[2:]},
+		{"limit before it is reached", 2, 2, full[:2]},
+		{"limit of one", 1, 0, full[3:]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithMaxHistory(test.maxHistory))
+			for _, ticket := range []TicketTx{issued, toBob, toCarol, toAlice} {
+				commitBlock(t, app, ticket)
+			}
+
+			var history []Transfer
+			queryJSON(t, app, "history", "1", test.height, &history)
+			if !reflect.DeepEqual(history, test.want) {
+				t.Errorf("history query returned %+v, want %+v", history, test.want)
+			}
+		})
+	}
+}
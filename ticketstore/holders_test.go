@@ -0,0 +1,48 @@
+package ticketstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHoldersQuery(t *testing.T) {
+	alice, bob, carol := address(aliceKey), address(bobKey), address(carolKey)
+	// Owners holding as many tickets rank by address
+	tie := func(a, b holder) []holder {
+		if b.Owner < a.Owner {
+			return []holder{b, a}
+		}
+		return []holder{a, b}
+	}
+
+	issued, second := newTicket(1, aliceKey), newTicket(2, aliceKey)
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, issued, second, newTicket(3, aliceKey), newTicket(4, aliceKey))
+	commitBlock(t, app, resell(t, issued, aliceKey, bob), newTicket(5, carolKey))
+	commitBlock(t, app, newTicket(6, bobKey), resell(t, second, aliceKey, burnAddress))
+
+	latest := append(tie(holder{alice, 2}, holder{bob, 2}), holder{carol, 1})
+	tests := []struct {
+		name   string
+		data   string
+		height int64
+		want   []holder
+	}{
+		{"every holder", "", 0, latest},
+		{"top holder", "1", 0, latest[:1]},
+		{"top two", "2", 0, latest[:2]},
+		{"limit above the holders", "10", 0, latest},
+		{"zero is every holder", "0", 0, latest},
+		{"before the burn", "", 2, append([]holder{{alice, 3}}, tie(holder{bob, 1}, holder{carol, 1})...)},
+		{"a single holder", "", 1, []holder{{alice, 4}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var holders []holder
+			queryJSON(t, app, "holders", test.data, test.height, &holders)
+			if !reflect.DeepEqual(holders, test.want) {
+				t.Errorf("holders query returned %v, want %v", holders, test.want)
+			}
+		})
+	}
+}
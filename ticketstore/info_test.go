@@ -0,0 +1,98 @@
+package ticketstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestInfo(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	tests := []struct {
+		name   string
+		blocks [][]TicketTx
+		height int64
+		txs    int64
+	}{
+		{"new chain", nil, 0, 0},
+		{"one block", [][]TicketTx{{issued, newTicket(2, bobKey)}}, 1, 2},
+		{"empty block", [][]TicketTx{{issued}, {}}, 2, 1},
+		{"resale", [][]TicketTx{{issued}, {resell(t, issued, aliceKey, address(bobKey))}}, 2, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			var root []byte
+			for _, block := range test.blocks {
+				root = commitBlock(t, app, block...)
+			}
+
+			response := app.Info(types.RequestInfo{})
+			var fields map[string]interface{}
+			if err := json.Unmarshal([]byte(response.Data), &fields); err != nil {
+				t.Fatalf("Info returned Data %q: %v", response.Data, err)
+			}
+			var keys []string
+			for key := range fields {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if want := []string{"height", "rootHash", "txs", "version"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("Info Data has fields %v, want %v", keys, want)
+			}
+
+			var info infoResponse
+			json.Unmarshal([]byte(response.Data), &info)
+			want := infoResponse{Height: test.height, Txs: test.txs, RootHash: hexutil.Encode(root), Version: Version}
+			if info != want {
+				t.Errorf("Info Data is %+v, want %+v", info, want)
+			}
+			if response.Version != Version || response.LastBlockHeight != test.height || !bytes.Equal(response.LastBlockAppHash, root) {
+				t.Errorf("Info returned version %q at height %v with app hash %x, want %q at %v with %x",
+					response.Version, response.LastBlockHeight, response.LastBlockAppHash, Version, test.height, root)
+			}
+		})
+	}
+}
+
+func TestVersionQuery(t *testing.T) {
+	app := NewTicketStoreApplication()
+	tests := []struct {
+		name   string
+		blocks int
+	}{
+		{"new chain", 0},
+		{"after two blocks", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < test.blocks; i++ {
+				commitBlock(t, app)
+			}
+			var version versionResponse
+			response := queryJSON(t, app, "version", "", 0, &version)
+			want := versionResponse{Version: Version, ABCI: abciVersion, Tendermint: tendermintVersion, Height: app.state.height}
+			if version != want || response.Height != app.state.height {
+				t.Errorf("version query returned %+v at height %v, want %+v", version, response.Height, want)
+			}
+		})
+	}
+}
+
+func TestTendermintVersionMatchesGopkg(t *testing.T) {
+	manifest, err := ioutil.ReadFile("../Gopkg.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := regexp.MustCompile(`name = "github.com/tendermint/tendermint"\s+version = "([^"]+)"`).FindSubmatch(manifest)
+	if constraint == nil || string(constraint[1]) != tendermintVersion {
+		t.Errorf("Gopkg.toml constrains Tendermint to %q, want %v", constraint, tendermintVersion)
+	}
+}
@@ -0,0 +1,50 @@
+package ticketstore
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIsOwnerQuery(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	toBob := resell(t, issued, aliceKey, address(bobKey))
+	toCarol := resell(t, toBob, bobKey, address(carolKey))
+	commitBlock(t, app, issued)
+	commitBlock(t, app, toBob)
+	commitBlock(t, app, toCarol)
+
+	alice, bob, carol := address(aliceKey), address(bobKey), address(carolKey)
+	tests := []struct {
+		name    string
+		height  int64
+		address string
+		owner   bool
+		nonce   uint64
+	}{
+		{"issued to alice", 1, alice, true, 1},
+		{"issued, asking for bob", 1, bob, false, 1},
+		{"resold to bob, asking for alice", 2, alice, false, 2},
+		{"resold to bob", 2, bob, true, 2},
+		{"resold to bob, in upper case", 2, "0x" + strings.ToUpper(bob[2:]), true, 2},
+		{"resold to carol", 3, carol, true, 3},
+		{"resold to carol, asking for bob", 3, bob, false, 3},
+		{"latest height", 0, carol, true, 3},
+		{"empty address", 0, "", false, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var response isOwnerResponse
+			queryJSON(t, app, "isowner", fmt.Sprintf(`{"id":1,"address":%q}`, test.address), test.height, &response)
+			height := test.height
+			if height == 0 {
+				height = 3
+			}
+			want := isOwnerResponse{Owner: test.owner, Nonce: test.nonce, Height: height}
+			if response != want {
+				t.Errorf("isowner query returned %+v, want %+v", response, want)
+			}
+		})
+	}
+}
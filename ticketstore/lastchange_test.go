@@ -0,0 +1,62 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestLastChangeQuery(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	resold := resell(t, issued, aliceKey, address(bobKey))
+	roots := map[int64][]byte{
+		1: commitBlock(t, app, issued, newTicket(2, carolKey)),
+		2: commitBlock(t, app, resold),
+	}
+	for height := int64(3); height <= 5; height++ {
+		roots[height] = commitBlock(t, app, newTicket(uint64(height), carolKey))
+	}
+
+	tests := []struct {
+		name   string
+		id     uint64
+		height int64
+		ticket TicketTx
+	}{
+		{"resold ticket", 1, 2, resold},
+		{"ticket unchanged since issue", 2, 1, newTicket(2, carolKey)},
+		{"ticket from the latest block", 5, 5, newTicket(5, carolKey)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var change TicketResponse
+			response := queryJSON(t, app, "lastChange", fmt.Sprint(test.id), 0, &change)
+			if response.Height != test.height || change.Height != test.height {
+				t.Fatalf("lastChange query returned height %v (response %v), want %v", change.Height, response.Height, test.height)
+			}
+			if change.Ticket.TicketTx != test.ticket {
+				t.Errorf("lastChange query returned %+v, want %+v", change.Ticket.TicketTx, test.ticket)
+			}
+			root, _ := hexutil.Decode(change.RootHash)
+			if !bytes.Equal(root, roots[test.height]) {
+				t.Errorf("lastChange query returned root %x, want the root committed at %v, %x", root, test.height, roots[test.height])
+			}
+			if valid, err := change.verify(roots[test.height], sha256.New); !valid || err != nil {
+				t.Errorf("Proof does not verify against the root at height %v: %v", test.height, err)
+			}
+
+			// The verify query accepts the proof against the header of that height
+			data, _ := json.Marshal(change)
+			var verified verifyResponse
+			queryJSON(t, app, "verify", string(data), 0, &verified)
+			if !verified.Valid || verified.Height != test.height {
+				t.Errorf("verify query returned %+v, want valid at height %v", verified, test.height)
+			}
+		})
+	}
+}
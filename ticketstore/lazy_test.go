@@ -0,0 +1,119 @@
+package ticketstore
+
+import (
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestLazySignatures(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	badProof := resell(t, issued, aliceKey, address(bobKey))
+	badProof.PrevOwnerProof = "0x00"
+	noProof := resell(t, issued, aliceKey, address(bobKey))
+	noProof.PrevOwnerProof = ""
+
+	tests := []struct {
+		name      string
+		resale    TicketTx
+		lazyCheck uint32
+		check     uint32
+		deliver   uint32
+	}{
+		{"signed by the owner", resell(t, issued, aliceKey, address(bobKey)), codeTypeOK, codeTypeOK, codeTypeOK},
+		{"signed by someone else", resell(t, issued, carolKey, address(bobKey)), codeTypeOK, codeTypeTicketError, codeTypeTicketError},
+		{"malformed proof", badProof, codeTypeOK, codeTypeTicketError, codeTypeTicketError},
+		{"no proof", noProof, codeTypeOK, codeTypeTicketError, codeTypeTicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			strict := NewTicketStoreApplication()
+			lazy := NewTicketStoreApplication(WithLazySignatures())
+			commitBlock(t, strict, issued)
+			commitBlock(t, lazy, issued)
+
+			if response := checkTx(t, strict, test.resale); response.Code != test.check {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.check)
+			}
+			if response := checkTx(t, lazy, test.resale); response.Code != test.lazyCheck {
+				t.Errorf("Lazy CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.lazyCheck)
+			}
+
+			// DeliverTx checks the signature whatever CheckTx let through
+			if response := deliver(t, lazy, test.resale); response.Code != test.deliver {
+				t.Errorf("Lazy DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.deliver)
+			}
+			lazy.Commit()
+			want := issued
+			if test.deliver == codeTypeOK {
+				want = test.resale
+			}
+			var ticket TicketResponse
+			queryJSON(t, lazy, "ticket", "1", 0, &ticket)
+			if ticket.Ticket.OwnerAddr != want.OwnerAddr || ticket.Ticket.Nonce != want.Nonce {
+				t.Errorf("Ticket is owned by %v at nonce %v, want %v at %v", ticket.Ticket.OwnerAddr, ticket.Ticket.Nonce, want.OwnerAddr, want.Nonce)
+			}
+		})
+	}
+}
+
+// signatureModes are the options for checking signatures in CheckTx and
+// DeliverTx, or leaving them to DeliverTx
+var signatureModes = []struct {
+	name    string
+	options []Option
+}{
+	{"strict", nil},
+	{"lazy", []Option{WithLazySignatures()}},
+}
+
+// benchmarkResales commits n tickets to app and returns a resale of each,
+// encoded as a tx
+func benchmarkResales(b *testing.B, app *TicketStoreApplication, n int) [][]byte {
+	b.Helper()
+	tickets := make([]TicketTx, n)
+	for i := range tickets {
+		tickets[i] = newTicket(uint64(i+1), aliceKey)
+	}
+	commitBlock(b, app, tickets...)
+	txs := make([][]byte, n)
+	for i, ticket := range tickets {
+		txs[i] = encodeTx(b, resell(b, ticket, aliceKey, address(bobKey)))
+	}
+	return txs
+}
+
+func BenchmarkCheckTx(b *testing.B) {
+	for _, mode := range signatureModes {
+		b.Run(mode.name, func(b *testing.B) {
+			app := NewTicketStoreApplication(mode.options...)
+			txs := benchmarkResales(b, app, 100)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if response := app.CheckTx(types.RequestCheckTx{Tx: txs[i%len(txs)]}); response.Code != codeTypeOK {
+					b.Fatalf("CheckTx returned code %v: %v", response.Code, response.Log)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCheckThenDeliverTx is the cost of a resale to the node, checked
+// once on entering the mempool and delivered once in a block
+func BenchmarkCheckThenDeliverTx(b *testing.B) {
+	for _, mode := range signatureModes {
+		b.Run(mode.name, func(b *testing.B) {
+			app := NewTicketStoreApplication(mode.options...)
+			txs := benchmarkResales(b, app, b.N)
+			b.ResetTimer()
+			for _, tx := range txs {
+				if response := app.CheckTx(types.RequestCheckTx{Tx: tx}); response.Code != codeTypeOK {
+					b.Fatalf("CheckTx returned code %v: %v", response.Code, response.Log)
+				}
+				if response := app.DeliverTx(types.RequestDeliverTx{Tx: tx}); response.Code != codeTypeOK {
+					b.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+				}
+			}
+		})
+	}
+}
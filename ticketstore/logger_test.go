@@ -0,0 +1,121 @@
+package ticketstore
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+type logEntry struct {
+	level   string
+	msg     string
+	keyvals []interface{}
+}
+
+// field returns the value logged under key
+func (entry logEntry) field(key string) interface{} {
+	for i := 0; i+1 < len(entry.keyvals); i += 2 {
+		if entry.keyvals[i] == key {
+			return entry.keyvals[i+1]
+		}
+	}
+	return nil
+}
+
+// capturingLogger keeps every entry logged to it
+type capturingLogger struct {
+	mtx     *sync.Mutex
+	entries *[]logEntry
+}
+
+func newCapturingLogger() capturingLogger {
+	return capturingLogger{&sync.Mutex{}, &[]logEntry{}}
+}
+
+func (logger capturingLogger) log(level string, msg string, keyvals []interface{}) {
+	logger.mtx.Lock()
+	defer logger.mtx.Unlock()
+	*logger.entries = append(*logger.entries, logEntry{level, msg, keyvals})
+}
+
+func (logger capturingLogger) Debug(msg string, keyvals ...interface{}) {
+	logger.log("debug", msg, keyvals)
+}
+func (logger capturingLogger) Info(msg string, keyvals ...interface{}) {
+	logger.log("info", msg, keyvals)
+}
+func (logger capturingLogger) Error(msg string, keyvals ...interface{}) {
+	logger.log("error", msg, keyvals)
+}
+func (logger capturingLogger) With(keyvals ...interface{}) log.Logger { return logger }
+
+// take returns the entries logged so far and forgets them
+func (logger capturingLogger) take() []logEntry {
+	logger.mtx.Lock()
+	defer logger.mtx.Unlock()
+	entries := *logger.entries
+	*logger.entries = nil
+	return entries
+}
+
+func TestLogging(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	replayed := issued
+	replayed.Details = "Replayed"
+
+	tests := []struct {
+		name  string
+		apply func(*TicketStoreApplication)
+		level string
+		msg   string
+		code  uint32
+	}{
+		{"delivered", func(app *TicketStoreApplication) {
+			app.DeliverTx(types.RequestDeliverTx{Tx: encodeTx(t, newTicket(2, aliceKey))})
+		}, "debug", "Delivered tx", codeTypeOK},
+		{"rejected in DeliverTx", func(app *TicketStoreApplication) {
+			app.DeliverTx(types.RequestDeliverTx{Tx: encodeTx(t, replayed)})
+		}, "info", "Rejected tx in DeliverTx", codeTypeTicketError},
+		{"malformed in DeliverTx", func(app *TicketStoreApplication) {
+			app.DeliverTx(types.RequestDeliverTx{Tx: []byte("{")})
+		}, "debug", "Rejected tx in DeliverTx", codeTypeEncodingError},
+		{"accepted in CheckTx", func(app *TicketStoreApplication) {
+			app.CheckTx(types.RequestCheckTx{Tx: encodeTx(t, newTicket(2, aliceKey))})
+		}, "debug", "Accepted tx in CheckTx", codeTypeOK},
+		{"rejected in CheckTx", func(app *TicketStoreApplication) {
+			app.CheckTx(types.RequestCheckTx{Tx: encodeTx(t, replayed)})
+		}, "info", "Rejected tx in CheckTx", codeTypeTicketError},
+		{"committed", func(app *TicketStoreApplication) {
+			app.Commit()
+		}, "debug", "Committed block", codeTypeOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := newCapturingLogger()
+			app := NewTicketStoreApplication(WithLogger(logger))
+			commitBlock(t, app, issued)
+			logger.take()
+
+			test.apply(app)
+			// Delivering a tx also logs each ticket it changes before the tx
+			entries := logger.take()
+			if len(entries) == 0 {
+				t.Fatal("Logged nothing")
+			}
+			entry := entries[len(entries)-1]
+			if entry.level != test.level || entry.msg != test.msg {
+				t.Errorf("Logged %v %q, want %v %q", entry.level, entry.msg, test.level, test.msg)
+			}
+			if test.code != codeTypeOK {
+				if code, _ := entry.field("code").(uint32); code != test.code {
+					t.Errorf("Logged code %v, want %v", code, test.code)
+				}
+				if reason, _ := entry.field("reason").(string); reason == "" {
+					t.Errorf("Logged no reason with %+v", entry)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package ticketstore
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArtosSystems/tendermint-exp/metrics"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestMetrics(t *testing.T) {
+	recorder := metrics.NewPrometheus()
+	app := NewTicketStoreApplication(WithMetrics(recorder))
+	commitBlock(t, app, newTicket(1, aliceKey), newTicket(2, aliceKey))
+	deliver(t, app, newTicket(1, aliceKey))
+	app.DeliverTx(types.RequestDeliverTx{Tx: []byte("not json")})
+	app.Commit()
+
+	response := httptest.NewRecorder()
+	recorder.ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"abci_app_txs_delivered_total 2\n",
+		fmt.Sprintf("abci_app_txs_rejected_total{code=\"%v\"} 1\n", codeTypeEncodingError),
+		fmt.Sprintf("abci_app_txs_rejected_total{code=\"%v\"} 1\n", codeTypeDuplicate),
+		"abci_app_commit_duration_seconds_count 2\n",
+		"abci_app_height 2\n",
+	} {
+		if !strings.Contains(response.Body.String(), want) {
+			t.Errorf("Metrics do not contain %q:\n%v", want, response.Body)
+		}
+	}
+}
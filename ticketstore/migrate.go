@@ -0,0 +1,126 @@
+package ticketstore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// stateVersion is the version of the state layout flush and snapshots write.
+// Version 0 predates the version header and tickets' prevOwnerAddr, version
+// 1 the DeliverTx stats, version 2 tickets' history, version 3 tickets'
+// validUntil, version 4 the recorded root hash and version 5 the leaf of
+// tickets stored without their proof
+const stateVersion = 6
+
+// stateMigrations upgrade an encoded state from the version it is keyed by to
+// the next version. Every version below stateVersion must have one. Stats,
+// history, validUntil and the root hash were each added while version 1 was
+// still being written, so a migration keeps whatever a state already has
+var stateMigrations = map[int]func(fields map[string]json.RawMessage) error{
+	// Version 0 tickets have no prevOwnerAddr, which decodes as empty just as
+	// for a ticket that has never been resold, so only the header changes
+	0: func(fields map[string]json.RawMessage) error { return nil },
+	// Version 1 has no stats. What was rejected before is unknown, so the
+	// counts start again from nothing
+	1: func(fields map[string]json.RawMessage) error {
+		if _, ok := fields["stats"]; ok {
+			return nil
+		}
+		stats, err := json.Marshal(txStats{Rejected: map[uint32]int64{}})
+		fields["stats"] = stats
+		return err
+	},
+	// Version 2 tickets have no history. Each gets the one change that is
+	// still known, its current owner and nonce at the height it last changed
+	2: func(fields map[string]json.RawMessage) error {
+		return migrateTickets(fields, func(ticket map[string]json.RawMessage) error {
+			if _, ok := ticket["history"]; ok {
+				return nil
+			}
+			var current struct {
+				TicketTx      TicketTx `json:"ticketTx"`
+				ChangeHeights []int64  `json:"changeHeights"`
+			}
+			if err := json.Unmarshal(ticket["ticketTx"], &current.TicketTx); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(ticket["changeHeights"], &current.ChangeHeights); err != nil {
+				return err
+			}
+			if len(current.ChangeHeights) == 0 {
+				return fmt.Errorf("Ticket %v has no change heights", current.TicketTx.Id)
+			}
+			history, err := json.Marshal([]Transfer{{
+				Owner:  current.TicketTx.OwnerAddr,
+				Nonce:  current.TicketTx.Nonce,
+				Height: current.ChangeHeights[len(current.ChangeHeights)-1]}})
+			ticket["history"] = history
+			return err
+		})
+	},
+	// Version 3 tickets have no validUntil, which decodes as zero, meaning no
+	// deadline, just as for a ticket submitted without one
+	3: func(fields map[string]json.RawMessage) error { return nil },
+	// Version 4 has no root hash. It is left out rather than computed here,
+	// as the hash strategy is not known, and the rebuilt root is then not
+	// checked against one
+	4: func(fields map[string]json.RawMessage) error { return nil },
+	// Version 5 tickets all keep their proof, as they do with no leaf now.
+	// The version changes so that an older node, which would hash a ticket
+	// without its proof, refuses the state rather than misreading it
+	5: func(fields map[string]json.RawMessage) error { return nil },
+}
+
+// migrateTickets applies migrate to each of the encoded tickets in fields
+func migrateTickets(fields map[string]json.RawMessage, migrate func(ticket map[string]json.RawMessage) error) error {
+	encoded, ok := fields["tickets"]
+	if !ok {
+		return nil
+	}
+	var tickets []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &tickets); err != nil {
+		return err
+	}
+	for _, ticket := range tickets {
+		if err := migrate(ticket); err != nil {
+			return err
+		}
+	}
+	migrated, err := json.Marshal(tickets)
+	fields["tickets"] = migrated
+	return err
+}
+
+// migrateState upgrades an encoded state to stateVersion, refusing a state
+// written by a newer version of the application
+func migrateState(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if encoded, ok := fields["version"]; ok {
+		if err := json.Unmarshal(encoded, &version); err != nil {
+			return nil, err
+		}
+	}
+	if version > stateVersion {
+		return nil, fmt.Errorf("State version %v is newer than the supported version %v", version, stateVersion)
+	}
+	if version == stateVersion {
+		return data, nil
+	}
+
+	for ; version < stateVersion; version++ {
+		migration, ok := stateMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("No migration from state version %v", version)
+		}
+		if err := migration(fields); err != nil {
+			return nil, fmt.Errorf("Migrating state version %v: %v", version, err)
+		}
+	}
+	fields["version"] = json.RawMessage(fmt.Sprint(stateVersion))
+	return json.Marshal(fields)
+}
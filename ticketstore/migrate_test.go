@@ -0,0 +1,167 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestStateMigrations(t *testing.T) {
+	for version := 0; version < stateVersion; version++ {
+		if _, ok := stateMigrations[version]; !ok {
+			t.Errorf("No migration from state version %v", version)
+		}
+	}
+
+	issued := newTicket(1, aliceKey)
+	resold := resell(t, issued, aliceKey, address(bobKey))
+	expiring := newTicket(2, carolKey)
+	expiring.ValidUntil = 1700000000
+	root := hexutil.Encode(referenceRoot(t, sha256.New, resold, expiring))
+
+	// state encodes the two tickets at height 2 as a state of the given
+	// version, with whichever of the later fields are set
+	type fields struct{ prevOwner, stats, history, validUntil, rootHash bool }
+	state := func(version int, with fields) []byte {
+		ticket := func(ticketTx TicketTx, changeHeights []int64, prevOwner string, history []Transfer) map[string]interface{} {
+			encoded := map[string]interface{}{
+				"id": ticketTx.Id, "nonce": ticketTx.Nonce, "details": ticketTx.Details,
+				"ownerAddr": ticketTx.OwnerAddr, "prevOwnerProof": ticketTx.PrevOwnerProof}
+			if with.validUntil && ticketTx.ValidUntil != 0 {
+				encoded["validUntil"] = ticketTx.ValidUntil
+			}
+			stored := map[string]interface{}{"ticketTx": encoded, "changeHeights": changeHeights}
+			if with.prevOwner {
+				stored["prevOwnerAddr"] = prevOwner
+			}
+			if with.history {
+				stored["history"] = history
+			}
+			return stored
+		}
+		state := map[string]interface{}{
+			"height": 2,
+			"size":   3,
+			"tickets": []interface{}{
+				ticket(resold, []int64{1, 2}, address(aliceKey), []Transfer{{address(aliceKey), 1, 1}, {address(bobKey), 2, 2}}),
+				ticket(expiring, []int64{1}, "", []Transfer{{address(carolKey), 1, 1}}),
+			}}
+		if version > 0 {
+			state["version"] = version
+		}
+		if with.stats {
+			state["stats"] = txStats{Accepted: 3, Rejected: map[uint32]int64{codeTypeTicketError: 1}}
+		}
+		if with.rootHash {
+			state["rootHash"] = root
+		}
+		encoded, err := json.Marshal(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	everything := fields{true, true, true, true, true}
+	tests := []struct {
+		name      string
+		state     []byte
+		prevOwner string
+		stats     txStats
+		history   []Transfer
+	}{
+		{"version 0", state(0, fields{}),
+			"", txStats{Rejected: map[uint32]int64{}}, []Transfer{{address(bobKey), 2, 2}}},
+		{"version 1", state(1, fields{prevOwner: true}),
+			address(aliceKey), txStats{Rejected: map[uint32]int64{}}, []Transfer{{address(bobKey), 2, 2}}},
+		{"version 1 written with every field", state(1, everything),
+			address(aliceKey), txStats{3, map[uint32]int64{codeTypeTicketError: 1}}, []Transfer{{address(aliceKey), 1, 1}, {address(bobKey), 2, 2}}},
+		{"version 2", state(2, fields{prevOwner: true, stats: true}),
+			address(aliceKey), txStats{3, map[uint32]int64{codeTypeTicketError: 1}}, []Transfer{{address(bobKey), 2, 2}}},
+		{"version 3", state(3, fields{prevOwner: true, stats: true, history: true}),
+			address(aliceKey), txStats{3, map[uint32]int64{codeTypeTicketError: 1}}, []Transfer{{address(aliceKey), 1, 1}, {address(bobKey), 2, 2}}},
+		{"version 4", state(4, fields{prevOwner: true, stats: true, history: true, validUntil: true}),
+			address(aliceKey), txStats{3, map[uint32]int64{codeTypeTicketError: 1}}, []Transfer{{address(aliceKey), 1, 1}, {address(bobKey), 2, 2}}},
+		{"version 5", state(5, everything),
+			address(aliceKey), txStats{3, map[uint32]int64{codeTypeTicketError: 1}}, []Transfer{{address(aliceKey), 1, 1}, {address(bobKey), 2, 2}}},
+		{"current version", state(stateVersion, everything),
+			address(aliceKey), txStats{3, map[uint32]int64{codeTypeTicketError: 1}}, []Transfer{{address(aliceKey), 1, 1}, {address(bobKey), 2, 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, cleanup := tempDir(t)
+			defer cleanup()
+			if err := ioutil.WriteFile(filepath.Join(dataDir, stateFileName), test.state, 0600); err != nil {
+				t.Fatal(err)
+			}
+			app := openApp(t, dataDir)
+
+			if app.state.height != 2 || app.state.size != 3 || hexutil.Encode(app.state.appHash()) != root {
+				t.Errorf("Migrated state is at height %v with %v txs and root %x, want 2, 3 and %v", app.state.height, app.state.size, app.state.appHash(), root)
+			}
+			ticket := app.state.tickets[1]
+			if ticket.TicketTx != resold || ticket.PrevOwnerAddr != test.prevOwner || !reflect.DeepEqual(ticket.History, test.history) {
+				t.Errorf("Migrated ticket 1 is %+v, want %+v with previous owner %q and history %v", ticket, resold, test.prevOwner, test.history)
+			}
+			// A state without validUntil gives every ticket no deadline
+			want := expiring
+			if !strings.Contains(string(test.state), "validUntil") {
+				want.ValidUntil = 0
+			}
+			if app.state.tickets[2].TicketTx != want {
+				t.Errorf("Migrated ticket 2 is %+v, want %+v", app.state.tickets[2].TicketTx, want)
+			}
+			if !reflect.DeepEqual(app.state.committedStats, test.stats) {
+				t.Errorf("Migrated stats are %+v, want %+v", app.state.committedStats, test.stats)
+			}
+
+			// The migrated state carries on and is written back as the
+			// current version
+			commitBlock(t, app, resell(t, resold, bobKey, address(carolKey)))
+			deliver(t, app, issued)
+			app.Commit()
+			if err := app.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dataDir, stateFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var written snapshotState
+			if err := json.Unmarshal(data, &written); err != nil || written.Version != stateVersion {
+				t.Errorf("State was written back as version %v (%v), want %v", written.Version, err, stateVersion)
+			}
+			migrated, err := migrateState(data)
+			if err != nil || !bytes.Equal(migrated, data) {
+				t.Errorf("Migrating the current version returned %s, %v, want it unchanged", migrated, err)
+			}
+		})
+	}
+}
+
+func TestMigrateStateErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		err   string
+	}{
+		{"newer version", `{"version":99,"height":1,"tickets":[]}`, "State version 99 is newer than the supported version"},
+		{"malformed version", `{"version":"one"}`, "cannot unmarshal"},
+		{"malformed tickets", `{"version":2,"tickets":{}}`, "Migrating state version 2"},
+		{"ticket without change heights", `{"version":2,"tickets":[{"ticketTx":{"id":7},"changeHeights":[]}]}`, "Ticket 7 has no change heights"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := migrateState([]byte(test.state)); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("migrateState returned %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
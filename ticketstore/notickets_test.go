@@ -0,0 +1,56 @@
+package ticketstore
+
+import "testing"
+
+func TestQueriesWithoutTickets(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	setups := []struct {
+		name   string
+		blocks func(t *testing.T, app *TicketStoreApplication)
+		height int64
+	}{
+		{"brand new app", func(*testing.T, *TicketStoreApplication) {}, 0},
+		{"after empty blocks", func(t *testing.T, app *TicketStoreApplication) {
+			app.Commit()
+			app.Commit()
+		}, 2},
+		{"every ticket burned", func(t *testing.T, app *TicketStoreApplication) {
+			commitBlock(t, app, issued)
+			commitBlock(t, app, resell(t, issued, aliceKey, burnAddress))
+		}, 2},
+		{"height before the first ticket", func(t *testing.T, app *TicketStoreApplication) {
+			app.Commit()
+			commitBlock(t, app, newTicket(3, aliceKey))
+		}, 1},
+	}
+	queries := []struct {
+		path  string
+		data  string
+		code  uint32
+		value string
+	}{
+		{"ticket", "2", codeTypeNoTickets, ""},
+		{"solidityProof", "2", codeTypeNoTickets, ""},
+		{"tickets", "[2]", codeTypeOK, "[null]"},
+		{"owner", address(aliceKey), codeTypeOK, "[]"},
+		{"ticket", "x", codeTypeEncodingError, ""},
+	}
+	for _, setup := range setups {
+		app := NewTicketStoreApplication()
+		setup.blocks(t, app)
+		for _, q := range queries {
+			t.Run(setup.name+" "+q.path, func(t *testing.T) {
+				response := query(app, q.path, q.data, setup.height)
+				if response.Code != q.code {
+					t.Fatalf("%v query returned code %v (%v), want %v", q.path, response.Code, response.Log, q.code)
+				}
+				if q.code == codeTypeNoTickets && response.Height != setup.height {
+					t.Errorf("%v query returned height %v, want %v", q.path, response.Height, setup.height)
+				}
+				if string(response.Value) != q.value {
+					t.Errorf("%v query returned %s, want %s", q.path, response.Value, q.value)
+				}
+			})
+		}
+	}
+}
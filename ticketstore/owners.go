@@ -0,0 +1,78 @@
+package ticketstore
+
+import (
+	"sort"
+	"strings"
+)
+
+// ownerIndex maps a lower case owner address to the ids of the live tickets
+// it holds, ordered by id. Id lists are never modified in place, so a shallow
+// copy of the map is a consistent snapshot of the index
+type ownerIndex map[string][]uint64
+
+// indexOwners builds the index of every live ticket in tickets
+func indexOwners(tickets map[uint64]Ticket) ownerIndex {
+	owners := make(ownerIndex)
+	for _, ticket := range sortTickets(tickets) {
+		owners.move(ticket.Id, "", ticket.OwnerAddr)
+	}
+	return owners
+}
+
+// move records ticket ticketId changing hands from prevOwner to owner. An
+// empty prevOwner is a newly created ticket and a burned ticket leaves the
+// index entirely
+func (owners ownerIndex) move(ticketId uint64, prevOwner string, owner string) {
+	if prevOwner != "" {
+		prevKey := strings.ToLower(prevOwner)
+		ids := owners[prevKey]
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= ticketId })
+		if i < len(ids) && ids[i] == ticketId {
+			remaining := make([]uint64, 0, len(ids)-1)
+			remaining = append(append(remaining, ids[:i]...), ids[i+1:]...)
+			if len(remaining) == 0 {
+				delete(owners, prevKey)
+			} else {
+				owners[prevKey] = remaining
+			}
+		}
+	}
+
+	key := strings.ToLower(owner)
+	if key == "" || key == burnAddress {
+		return
+	}
+	ids := owners[key]
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= ticketId })
+	if i < len(ids) && ids[i] == ticketId {
+		return
+	}
+	added := make([]uint64, 0, len(ids)+1)
+	added = append(append(append(added, ids[:i]...), ticketId), ids[i:]...)
+	owners[key] = added
+}
+
+func (owners ownerIndex) copy() ownerIndex {
+	copied := make(ownerIndex, len(owners))
+	for key, ids := range owners {
+		copied[key] = ids
+	}
+	return copied
+}
+
+// holder is an entry of the holders query: an owner and how many live
+// tickets it holds
+type holder struct {
+	Owner   string `json:"owner"`
+	Tickets int    `json:"tickets"`
+}
+
+// holders ranks the owners by how many tickets they hold, most first, with
+// ties ordered by address. limit keeps only the top entries when above zero
+func (owners ownerIndex) holders(limit int) []holder {
+	ranked := make([]holder, 0, len(owners))
+	for owner, ids := range owners {
+		ranked = append(ranked, holder{Owner: owner, Tickets: len(ids)})
+	}
+	return rankHolders(ranked, limit)
+}
@@ -0,0 +1,126 @@
+package ticketstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOwnerQuery(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(3, aliceKey), newTicket(1, bobKey), newTicket(2, aliceKey), newTicket(4, bobKey))
+
+	tests := []struct {
+		name  string
+		owner string
+		ids   []uint64
+	}{
+		{"first owner", address(aliceKey), []uint64{2, 3}},
+		{"second owner", address(bobKey), []uint64{1, 4}},
+		{"upper case address", "0x" + strings.ToUpper(address(aliceKey)[2:]), []uint64{2, 3}},
+		{"owner of nothing", address(carolKey), []uint64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var owned []Ticket
+			queryJSON(t, app, "owner", test.owner, 0, &owned)
+			if owned == nil {
+				t.Fatal("Owner query returned null, want an array")
+			}
+			ids := []uint64{}
+			for _, ticket := range owned {
+				ids = append(ids, ticket.Id)
+				if ticket.Nonce != 1 || ticket.Details == "" {
+					t.Errorf("Ticket %v is missing its nonce or details: %+v", ticket.Id, ticket)
+				}
+			}
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("Owner query returned tickets %v, want %v", ids, test.ids)
+			}
+		})
+	}
+}
+
+func TestOwnerIndexFollowsResales(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued, newTicket(2, aliceKey))
+	commitBlock(t, app, resell(t, issued, aliceKey, address(bobKey)))
+
+	want := ownerIndex{address(aliceKey): {2}, address(bobKey): {1}}
+	if !reflect.DeepEqual(app.state.owners, want) {
+		t.Errorf("Owner index is %v, want %v", app.state.owners, want)
+	}
+	if !reflect.DeepEqual(indexOwners(app.state.tickets), want) {
+		t.Errorf("Index rebuilt from the tickets is %v, want %v", indexOwners(app.state.tickets), want)
+	}
+}
+
+func TestOwnerIndexMove(t *testing.T) {
+	tests := []struct {
+		name      string
+		owners    ownerIndex
+		id        uint64
+		prevOwner string
+		owner     string
+		want      ownerIndex
+	}{
+		{"create", ownerIndex{}, 1, "", "0xa", ownerIndex{"0xa": {1}}},
+		{"create keeps ids ordered", ownerIndex{"0xa": {1, 3}}, 2, "", "0xa", ownerIndex{"0xa": {1, 2, 3}}},
+		{"transfer", ownerIndex{"0xa": {1, 2}}, 1, "0xa", "0xb", ownerIndex{"0xa": {2}, "0xb": {1}}},
+		{"transfer of last ticket", ownerIndex{"0xa": {1}}, 1, "0xa", "0xb", ownerIndex{"0xb": {1}}},
+		{"mixed case owner", ownerIndex{}, 1, "", "0xA", ownerIndex{"0xa": {1}}},
+		{"burn", ownerIndex{"0xa": {1}}, 1, "0xa", burnAddress, ownerIndex{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := test.owners.copy()
+			owners := test.owners.copy()
+			owners.move(test.id, test.prevOwner, test.owner)
+			if !reflect.DeepEqual(owners, test.want) {
+				t.Errorf("move gave %v, want %v", owners, test.want)
+			}
+			if !reflect.DeepEqual(test.owners, before) {
+				t.Errorf("move changed the copied index to %v", test.owners)
+			}
+		})
+	}
+}
+
+func TestOwnerIndexThroughBlocks(t *testing.T) {
+	dataDir, cleanup := tempDir(t)
+	defer cleanup()
+	app := openApp(t, dataDir)
+	defer func() { app.Close() }()
+
+	issued := newTicket(1, aliceKey)
+	resold := resell(t, issued, aliceKey, address(bobKey))
+	steps := []struct {
+		name   string
+		ticket TicketTx
+		want   ownerIndex
+	}{
+		{"create", issued, ownerIndex{address(aliceKey): {1}}},
+		{"create another", newTicket(2, aliceKey), ownerIndex{address(aliceKey): {1, 2}}},
+		{"resale", resold, ownerIndex{address(aliceKey): {2}, address(bobKey): {1}}},
+		{"burn", resell(t, resold, bobKey, burnAddress), ownerIndex{address(aliceKey): {2}}},
+	}
+	for _, step := range steps {
+		if response := deliver(t, app, step.ticket); response.Code != codeTypeOK {
+			t.Fatalf("%v: DeliverTx returned code %v: %v", step.name, response.Code, response.Log)
+		}
+		app.Commit()
+		if !reflect.DeepEqual(app.state.owners, step.want) {
+			t.Errorf("%v: Owner index is %v, want %v", step.name, app.state.owners, step.want)
+		}
+
+		// The index read back from disk matches the one kept in memory
+		if err := app.Close(); err != nil {
+			t.Fatal(err)
+		}
+		app = openApp(t, dataDir)
+		if !reflect.DeepEqual(app.state.owners, step.want) {
+			t.Errorf("%v: Reopened owner index is %v, want %v", step.name, app.state.owners, step.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ticketstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const stateFileName = "state.json"
+
+// OpenTicketStoreApplication creates an application that keeps its state in
+// dataDir, loading whatever an earlier flush wrote there and replaying any
+// commits logged since, so Info reports the height Tendermint should resume
+// from
+func OpenTicketStoreApplication(dataDir string, opts ...Option) (*TicketStoreApplication, error) {
+	app := NewTicketStoreApplication(opts...)
+	app.dataDir = dataDir
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, stateFileName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		restored, err := decodeSnapshotState(data, app.state.hashStrategy)
+		if err != nil {
+			return nil, err
+		}
+		app.state = restored
+	}
+
+	if err := app.state.replayWAL(dataDir); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// Close stops any running queries, waits for any in-flight DeliverTx or
+// Commit and flushes the last committed state to the data directory. Only the
+// first call flushes
+func (app *TicketStoreApplication) Close() error {
+	// Cancel before locking, since a running query holds the read lock
+	app.cancel()
+
+	app.mtx.Lock()
+	defer app.mtx.Unlock()
+
+	if app.closed {
+		return nil
+	}
+	app.closed = true
+
+	if app.dataDir == "" {
+		return nil
+	}
+	if err := app.flush(); err != nil {
+		return err
+	}
+	return app.truncateWAL()
+}
+
+// flush writes the committed state to the data directory. Transactions
+// delivered in a block that has not been committed yet are left out, since
+// Tendermint will deliver them again. The caller must hold the write lock
+func (app *TicketStoreApplication) flush() error {
+	data, err := app.state.encodeCommittedState()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(app.dataDir, stateFileName), data)
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new file in place, never a partial one
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
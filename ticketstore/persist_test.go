@@ -0,0 +1,104 @@
+package ticketstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestCloseFlushesCommittedState(t *testing.T) {
+	tests := []struct {
+		name        string
+		uncommitted []TicketTx
+	}{
+		{"committed blocks", nil},
+		{"block delivered but not committed", []TicketTx{newTicket(3, carolKey)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, cleanup := tempDir(t)
+			defer cleanup()
+			app := openApp(t, dataDir)
+			commitBlock(t, app, newTicket(1, aliceKey))
+			root := commitBlock(t, app, newTicket(2, bobKey))
+			for _, ticket := range test.uncommitted {
+				if response := deliver(t, app, ticket); response.Code != codeTypeOK {
+					t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+				}
+			}
+			if err := app.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Close(); err != nil {
+				t.Errorf("Second Close returned %v", err)
+			}
+
+			reopened := openApp(t, dataDir)
+			defer reopened.Close()
+			info := reopened.Info(types.RequestInfo{})
+			if info.LastBlockHeight != 2 || !bytes.Equal(info.LastBlockAppHash, root) {
+				t.Errorf("Reopened at height %v with root %x, want 2 with %x", info.LastBlockHeight, info.LastBlockAppHash, root)
+			}
+			if len(reopened.state.tickets) != 2 {
+				t.Errorf("Reopened with tickets %v, want the two committed", reopened.state.tickets)
+			}
+		})
+	}
+}
+
+func TestCloseStopsQueries(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(1, aliceKey))
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if response := query(app, "owner", address(aliceKey), 0); response.Code != codeTypeCancelled {
+		t.Errorf("Owner query after Close returned code %v, want %v", response.Code, codeTypeCancelled)
+	}
+}
+
+func TestGenesisSurvivesCrash(t *testing.T) {
+	genesis := types.RequestInitChain{AppStateBytes: encodeTx(t, newTicket(1, aliceKey), newTicket(2, bobKey))}
+	tests := []struct {
+		name    string
+		blocks  []TicketTx
+		height  int64
+		tickets int
+	}{
+		{"crash before the first block", nil, 0, 2},
+		{"crash before the first flush", []TicketTx{newTicket(3, carolKey)}, 1, 3},
+		{"crash after a flush", []TicketTx{newTicket(3, carolKey), newTicket(4, carolKey), newTicket(5, carolKey)}, 3, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir, cleanup := tempDir(t)
+			defer cleanup()
+			app := openApp(t, dataDir, WithFlushInterval(2))
+			app.InitChain(genesis)
+			root := app.Info(types.RequestInfo{}).LastBlockAppHash
+			for _, ticket := range test.blocks {
+				root = commitBlock(t, app, ticket)
+			}
+
+			// The app is never closed, so only what was flushed or logged
+			// survives
+			reopened := openApp(t, dataDir, WithFlushInterval(2))
+			defer reopened.Close()
+			if reopened.state.height == 0 {
+				// Tendermint replays InitChain to an app at height zero
+				reopened.InitChain(genesis)
+			}
+			info := reopened.Info(types.RequestInfo{})
+			if info.LastBlockHeight != test.height || !bytes.Equal(info.LastBlockAppHash, root) {
+				t.Errorf("Reopened at height %v with root %x, want %v with %x", info.LastBlockHeight, info.LastBlockAppHash, test.height, root)
+			}
+			if len(reopened.state.tickets) != test.tickets {
+				t.Errorf("Reopened with tickets %v, want %v", reopened.state.tickets, test.tickets)
+			}
+			if response := query(reopened, "ticket", "1", 0); response.Code != codeTypeOK {
+				t.Errorf("Genesis ticket query returned code %v: %v", response.Code, response.Log)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package ticketstore
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// persistentMap is an immutable map keyed by uint64. A map set from another
+// shares every node with it but those on the path to the key that changed,
+// so history can keep the tickets and owners of each height without copying
+// all of them. It is a trie taking mapBits of the key at each level from the
+// most significant, so walking it in order visits the keys in order
+type persistentMap struct {
+	root *mapNode
+	size int
+}
+
+const (
+	mapBits  = 4
+	mapWidth = 1 << mapBits
+	mapDepth = 64 / mapBits
+)
+
+// mapNode holds mapWidth children or, at the lowest level, values. An empty
+// slot is nil
+type mapNode struct {
+	children []*mapNode
+	values   []interface{}
+}
+
+// mapSlot is the slot of key in a node at level, counting up from the values
+func mapSlot(key uint64, level int) int {
+	return int(key >> (uint(level) * mapBits) & (mapWidth - 1))
+}
+
+// buildPersistentMap returns the map holding what fill puts in it. Nothing
+// else shares its nodes while it is built, so they are changed in place
+func buildPersistentMap(fill func(put func(key uint64, value interface{}))) *persistentMap {
+	built := &persistentMap{root: &mapNode{children: make([]*mapNode, mapWidth)}}
+	fill(func(key uint64, value interface{}) {
+		node := built.root
+		for level := mapDepth - 1; level > 0; level-- {
+			slot := mapSlot(key, level)
+			if node.children[slot] == nil {
+				if level == 1 {
+					node.children[slot] = &mapNode{values: make([]interface{}, mapWidth)}
+				} else {
+					node.children[slot] = &mapNode{children: make([]*mapNode, mapWidth)}
+				}
+			}
+			node = node.children[slot]
+		}
+		if node.values[mapSlot(key, 0)] == nil {
+			built.size++
+		}
+		node.values[mapSlot(key, 0)] = value
+	})
+	return built
+}
+
+// get returns the value of key. A nil map holds nothing
+func (m *persistentMap) get(key uint64) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+	node := m.root
+	for level := mapDepth - 1; level > 0 && node != nil; level-- {
+		node = node.children[mapSlot(key, level)]
+	}
+	if node == nil {
+		return nil, false
+	}
+	value := node.values[mapSlot(key, 0)]
+	return value, value != nil
+}
+
+func (m *persistentMap) len() int {
+	if m == nil {
+		return 0
+	}
+	return m.size
+}
+
+// set returns a copy of the map with key holding value, or without key when
+// value is nil. The map itself is never changed
+func (m *persistentMap) set(key uint64, value interface{}) *persistentMap {
+	if _, exists := m.get(key); !exists && value == nil {
+		return m
+	}
+	var root *mapNode
+	if m != nil {
+		root = m.root
+	}
+	root, added := root.set(mapDepth-1, key, value)
+	return &persistentMap{root: root, size: m.len() + added}
+}
+
+// set returns a copy of node with key holding value and how many keys that
+// added, which is negative when one was removed. A nil node is empty
+func (node *mapNode) set(level int, key uint64, value interface{}) (*mapNode, int) {
+	slot := mapSlot(key, level)
+	if level == 0 {
+		copied := &mapNode{values: make([]interface{}, mapWidth)}
+		if node != nil {
+			copy(copied.values, node.values)
+		}
+		added := 0
+		if copied.values[slot] == nil && value != nil {
+			added = 1
+		} else if copied.values[slot] != nil && value == nil {
+			added = -1
+		}
+		copied.values[slot] = value
+		return copied, added
+	}
+
+	copied := &mapNode{children: make([]*mapNode, mapWidth)}
+	var child *mapNode
+	if node != nil {
+		copy(copied.children, node.children)
+		child = node.children[slot]
+	}
+	var added int
+	copied.children[slot], added = child.set(level-1, key, value)
+	return copied, added
+}
+
+// each calls visit with every key and its value in key order
+func (m *persistentMap) each(visit func(key uint64, value interface{})) {
+	if m != nil {
+		m.root.each(mapDepth-1, 0, visit)
+	}
+}
+
+func (node *mapNode) each(level int, prefix uint64, visit func(key uint64, value interface{})) {
+	if node == nil {
+		return
+	}
+	for slot := 0; slot < mapWidth; slot++ {
+		key := prefix<<mapBits | uint64(slot)
+		if level > 0 {
+			node.children[slot].each(level-1, key, visit)
+		} else if value := node.values[slot]; value != nil {
+			visit(key, value)
+		}
+	}
+}
+
+// ticketMap is a persistentMap of tickets by id. Its zero value is empty
+type ticketMap struct {
+	tickets *persistentMap
+}
+
+// newTicketMap returns the tickets in byId as a ticketMap
+func newTicketMap(byId map[uint64]Ticket) ticketMap {
+	return ticketMap{buildPersistentMap(func(put func(key uint64, value interface{})) {
+		for id, ticket := range byId {
+			put(id, ticket)
+		}
+	})}
+}
+
+func (tickets ticketMap) get(id uint64) (Ticket, bool) {
+	ticket, ok := tickets.tickets.get(id)
+	if !ok {
+		return Ticket{}, false
+	}
+	return ticket.(Ticket), true
+}
+
+func (tickets ticketMap) len() int {
+	return tickets.tickets.len()
+}
+
+// set returns a copy of tickets holding each of changed
+func (tickets ticketMap) set(changed []Ticket) ticketMap {
+	for _, ticket := range changed {
+		tickets.tickets = tickets.tickets.set(ticket.Id, ticket)
+	}
+	return tickets
+}
+
+// sorted returns every ticket ordered by id
+func (tickets ticketMap) sorted() []Ticket {
+	sorted := make([]Ticket, 0, tickets.len())
+	tickets.tickets.each(func(id uint64, ticket interface{}) {
+		sorted = append(sorted, ticket.(Ticket))
+	})
+	return sorted
+}
+
+// ownerMap is a persistent ownerIndex. Its persistentMap is keyed by the hash
+// of each lower case owner address and holds the owners with that hash,
+// which is only ever more than one when two addresses collide. Its zero value
+// is empty
+type ownerMap struct {
+	owners *persistentMap
+}
+
+// ownerIds are the ids of the live tickets an owner holds
+type ownerIds struct {
+	owner string
+	ids   []uint64
+}
+
+func ownerKey(owner string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(owner))
+	return h.Sum64()
+}
+
+// newOwnerMap returns owners as an ownerMap
+func newOwnerMap(owners ownerIndex) ownerMap {
+	return ownerMap{buildPersistentMap(func(put func(key uint64, value interface{})) {
+		byKey := make(map[uint64][]ownerIds, len(owners))
+		for owner, ids := range owners {
+			key := ownerKey(owner)
+			byKey[key] = append(byKey[key], ownerIds{owner, ids})
+		}
+		for key, entries := range byKey {
+			put(key, entries)
+		}
+	})}
+}
+
+// get returns the ids of the tickets held by owner, a lower case address
+func (owners ownerMap) get(owner string) []uint64 {
+	entries, ok := owners.owners.get(ownerKey(owner))
+	if !ok {
+		return nil
+	}
+	for _, entry := range entries.([]ownerIds) {
+		if entry.owner == owner {
+			return entry.ids
+		}
+	}
+	return nil
+}
+
+// set returns a copy of owners where owner, a lower case address, holds ids,
+// leaving it out when ids is empty
+func (owners ownerMap) set(owner string, ids []uint64) ownerMap {
+	key := ownerKey(owner)
+	var entries []ownerIds
+	if stored, ok := owners.owners.get(key); ok {
+		entries = stored.([]ownerIds)
+	}
+	updated := make([]ownerIds, 0, len(entries)+1)
+	for _, entry := range entries {
+		if entry.owner != owner {
+			updated = append(updated, entry)
+		}
+	}
+	if len(ids) > 0 {
+		updated = append(updated, ownerIds{owner, ids})
+	}
+	if len(updated) == 0 {
+		owners.owners = owners.owners.set(key, nil)
+	} else {
+		owners.owners = owners.owners.set(key, updated)
+	}
+	return owners
+}
+
+// holders ranks the owners as ownerIndex.holders does
+func (owners ownerMap) holders(limit int) []holder {
+	ranked := make([]holder, 0, owners.owners.len())
+	owners.owners.each(func(key uint64, entries interface{}) {
+		for _, entry := range entries.([]ownerIds) {
+			ranked = append(ranked, holder{Owner: entry.owner, Tickets: len(entry.ids)})
+		}
+	})
+	return rankHolders(ranked, limit)
+}
+
+// rankHolders orders ranked by how many tickets each holds, most first, with
+// ties ordered by address, keeping only the top limit when above zero
+func rankHolders(ranked []holder, limit int) []holder {
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Tickets != ranked[j].Tickets {
+			return ranked[i].Tickets > ranked[j].Tickets
+		}
+		return ranked[i].Owner < ranked[j].Owner
+	})
+	if limit > 0 && limit < len(ranked) {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
@@ -0,0 +1,113 @@
+package ticketstore
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPersistentMap(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var m *persistentMap
+	want := make(map[uint64]interface{})
+	versions := []*persistentMap{m}
+	wants := []map[uint64]interface{}{{}}
+	for i := 0; i < 500; i++ {
+		// Keys far apart share no nodes below the root, and nearby keys most
+		key := uint64(random.Intn(64))
+		if random.Intn(4) == 0 {
+			key = random.Uint64()
+		}
+		if random.Intn(3) == 0 {
+			m = m.set(key, nil)
+			delete(want, key)
+		} else {
+			m = m.set(key, i)
+			want[key] = i
+		}
+
+		copied := make(map[uint64]interface{}, len(want))
+		for key, value := range want {
+			copied[key] = value
+		}
+		versions = append(versions, m)
+		wants = append(wants, copied)
+	}
+
+	// Every version still holds what it did when it was set
+	for i, version := range versions {
+		got := make(map[uint64]interface{})
+		last, first := uint64(0), true
+		version.each(func(key uint64, value interface{}) {
+			if !first && key <= last {
+				t.Errorf("Version %v visits key %v after %v", i, key, last)
+			}
+			last, first = key, false
+			got[key] = value
+		})
+		if !reflect.DeepEqual(got, wants[i]) || version.len() != len(wants[i]) {
+			t.Fatalf("Version %v holds %v keys %v, want %v", i, version.len(), got, wants[i])
+		}
+		for key, value := range wants[i] {
+			if got, ok := version.get(key); !ok || got != value {
+				t.Errorf("Version %v holds %v, %v at key %v, want %v", i, got, ok, key, value)
+			}
+		}
+	}
+	if _, ok := m.get(1 << 40); ok {
+		t.Errorf("Missing key was found")
+	}
+
+	built := buildPersistentMap(func(put func(key uint64, value interface{})) {
+		for key, value := range want {
+			put(key, value)
+		}
+	})
+	if built.len() != m.len() {
+		t.Errorf("Built map holds %v keys, want %v", built.len(), m.len())
+	}
+	for key, value := range want {
+		if got, ok := built.get(key); !ok || got != value {
+			t.Errorf("Built map holds %v, %v at key %v, want %v", got, ok, key, value)
+		}
+	}
+}
+
+func TestOwnerMap(t *testing.T) {
+	alice, bob, carol := address(aliceKey), address(bobKey), address(carolKey)
+	index := ownerIndex{alice: {1, 2}, bob: {3}}
+	owners := newOwnerMap(index)
+
+	steps := []struct {
+		owner string
+		ids   []uint64
+	}{
+		{carol, []uint64{4}},
+		{bob, []uint64{3, 5}},
+		{alice, nil},
+		{carol, []uint64{}},
+		{alice, []uint64{6}},
+	}
+	for _, step := range steps {
+		before := owners
+		beforeIndex := index.copy()
+
+		owners = owners.set(step.owner, step.ids)
+		if len(step.ids) == 0 {
+			delete(index, step.owner)
+		} else {
+			index[step.owner] = step.ids
+		}
+		for _, owner := range []string{alice, bob, carol} {
+			if got := owners.get(owner); !reflect.DeepEqual(got, index[owner]) {
+				t.Errorf("Setting %v to %v left %v holding %v, want %v", step.owner, step.ids, owner, got, index[owner])
+			}
+			if got := before.get(owner); !reflect.DeepEqual(got, beforeIndex[owner]) {
+				t.Errorf("Setting %v to %v changed the earlier map", step.owner, step.ids)
+			}
+		}
+		if got, want := owners.holders(0), index.holders(0); !reflect.DeepEqual(got, want) {
+			t.Errorf("Holders are %v, want %v", got, want)
+		}
+	}
+}
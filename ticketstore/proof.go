@@ -0,0 +1,227 @@
+package ticketstore
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ownerProofScheme produces the hash the previous owner signs to authorise a
+// resale. Every scheme is recovered as a secp256k1 signature
+type ownerProofScheme interface {
+	signedHash(prevTicket TicketTx, chainId uint64) ([]byte, error)
+}
+
+var ownerProofSchemes = map[string]ownerProofScheme{
+	"":              rawHashScheme{},
+	"personal_sign": personalSignScheme{},
+	"eip712":        eip712Scheme{},
+}
+
+// rawHashScheme signs the previous ticket's CalculateHash directly, as
+// EthCrypto.sign does
+type rawHashScheme struct{}
+
+func (rawHashScheme) signedHash(prevTicket TicketTx, chainId uint64) ([]byte, error) {
+	return prevTicket.CalculateHash()
+}
+
+// personalSignScheme signs CalculateHash wrapped in the eth_sign / personal_sign
+// message prefix, as wallets do for arbitrary messages
+type personalSignScheme struct{}
+
+func (personalSignScheme) signedHash(prevTicket TicketTx, chainId uint64) ([]byte, error) {
+	hash, err := prevTicket.CalculateHash()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n32"), hash), nil
+}
+
+var (
+	eip712DomainType = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId)"))
+	eip712TicketType = crypto.Keccak256([]byte("Ticket(uint256 id,uint256 nonce,string details,address ownerAddr,bytes prevOwnerProof)"))
+	eip712Name       = crypto.Keccak256([]byte("TicketStore"))
+	eip712Version    = crypto.Keccak256([]byte("1"))
+)
+
+// eip712Scheme signs the previous ticket as EIP-712 typed data in the
+// TicketStore version 1 domain for the configured chain id
+type eip712Scheme struct{}
+
+func (eip712Scheme) signedHash(prevTicket TicketTx, chainId uint64) ([]byte, error) {
+	// The leaf kept in place of a dropped proof does not give its hash
+	if prevTicket.leaf != "" {
+		return nil, ErrProofNotStored
+	}
+	prevOwnerProof, err := decodeProofBytes(prevTicket.PrevOwnerProof)
+	if err != nil {
+		return nil, err
+	}
+
+	domainSeparator := crypto.Keccak256(eip712DomainType, eip712Name, eip712Version, uint256Bytes(chainId))
+	ticketHash := crypto.Keccak256(
+		eip712TicketType,
+		uint256Bytes(prevTicket.Id),
+		uint256Bytes(prevTicket.Nonce),
+		crypto.Keccak256([]byte(prevTicket.Details)),
+		common.LeftPadBytes(common.HexToAddress(prevTicket.OwnerAddr).Bytes(), 32),
+		crypto.Keccak256(prevOwnerProof))
+	return crypto.Keccak256([]byte("\x19\x01"), domainSeparator, ticketHash), nil
+}
+
+func uint256Bytes(value uint64) []byte {
+	encoded := make([]byte, 32)
+	binary.BigEndian.PutUint64(encoded[24:], value)
+	return encoded
+}
+
+// decodeProofBytes decodes a hex proof, treating an empty proof as no bytes
+func decodeProofBytes(proof string) ([]byte, error) {
+	if proof == "" {
+		return []byte{}, nil
+	}
+	return hexutil.Decode(proof)
+}
+
+// MaxChainId is the largest chain id whose EIP-155 v, 35 + 2*chainId + 1,
+// fits in a uint64
+const MaxChainId = (math.MaxUint64 - 36) / 2
+
+// SignTicketTransfer produces the PrevOwnerProof that authorises a resale of
+// prevTicket, signed by its owner's key under the default proof scheme, for a
+// node without a chain id
+func SignTicketTransfer(prevTicket TicketTx, privKey *ecdsa.PrivateKey) (string, error) {
+	return signTicket(prevTicket, privKey, 0)
+}
+
+// SignTicketTransferForChain is SignTicketTransfer for a node run with
+// WithChainId(chainId), encoding the recovery id as EIP-155 for chainId
+func SignTicketTransferForChain(prevTicket TicketTx, privKey *ecdsa.PrivateKey, chainId uint64) (string, error) {
+	return signTicket(prevTicket, privKey, chainId)
+}
+
+// SignTicketIssue produces the PrevOwnerProof an issuer gives a new ticket,
+// signed by the issuer's key under the default proof scheme, for a node
+// without a chain id. Any proof already set on ticket is ignored
+func SignTicketIssue(ticket TicketTx, privKey *ecdsa.PrivateKey) (string, error) {
+	return SignTicketIssueForChain(ticket, privKey, 0)
+}
+
+// SignTicketIssueForChain is SignTicketIssue for a node run with
+// WithChainId(chainId), encoding the recovery id as EIP-155 for chainId
+func SignTicketIssueForChain(ticket TicketTx, privKey *ecdsa.PrivateKey, chainId uint64) (string, error) {
+	ticket.PrevOwnerProof = ""
+	return signTicket(ticket, privKey, chainId)
+}
+
+func signTicket(ticket TicketTx, privKey *ecdsa.PrivateKey, chainId uint64) (string, error) {
+	if chainId > MaxChainId {
+		return "", ErrBadChainId
+	}
+	hash, err := ticket.CalculateHash()
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := crypto.Sign(hash, privKey)
+	if err != nil {
+		return "", err
+	}
+	// crypto.Sign returns a 0/1 recovery id, the verifier expects legacy
+	// 27/28 or, for a chain id, its EIP-155 v in as many bytes as it needs
+	v := uint64(27)
+	if chainId != 0 {
+		v = 35 + 2*chainId
+	}
+	return hexutil.Encode(append(sig[:64], encodeRecoveryId(v+uint64(sig[64]))...)), nil
+}
+
+// encodeRecoveryId encodes v big-endian without leading zeros, the form
+// recoverSigner accepts
+func encodeRecoveryId(v uint64) []byte {
+	var encoded []byte
+	for ; v > 0; v >>= 8 {
+		encoded = append([]byte{byte(v)}, encoded...)
+	}
+	return encoded
+}
+
+// RecoverTransferSigner returns the lowercase address that signed ticket's
+// PrevOwnerProof over prevTicket, which validation compares with the previous
+// owner
+func RecoverTransferSigner(ticket TicketTx, prevTicket TicketTx, chainId uint64) (string, error) {
+	return ticket.getOwnerProofSigner(prevTicket, chainId)
+}
+
+// recoverSigner returns the lowercase address that produced proof over hash.
+// A proof is r and s followed by v, big-endian in as few bytes as it takes,
+// since an EIP-155 v outgrows one byte above chain id 109. Padded v, high S
+// and any v normaliseRecoveryId does not accept for chainId are rejected
+func recoverSigner(hash []byte, proof string, chainId uint64) (string, error) {
+	if len(proof) < 3 {
+		// Cannot be a valid proof
+		return "", ErrBadSignature
+	}
+
+	bytesProof, err := hexutil.Decode(proof)
+	if err != nil {
+		return "", err
+	}
+	if len(bytesProof) < 65 || len(bytesProof) > 64+8 {
+		return "", ErrBadSignature
+	}
+	if bytesProof[64] == 0 {
+		// A leading zero would give v a second encoding
+		return "", ErrBadRecoveryId
+	}
+	var v uint64
+	for _, b := range bytesProof[64:] {
+		v = v<<8 | uint64(b)
+	}
+
+	recoveryId, err := normaliseRecoveryId(v, chainId)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the low-S form of a signature is accepted, so each transfer has
+	// exactly one valid proof rather than a signature and its malleated twin
+	r := new(big.Int).SetBytes(bytesProof[:32])
+	s := new(big.Int).SetBytes(bytesProof[32:64])
+	if !crypto.ValidateSignatureValues(recoveryId, r, s, true) {
+		return "", ErrBadSignature
+	}
+
+	sig := make([]byte, 65)
+	copy(sig, bytesProof[:64])
+	sig[64] = recoveryId
+	signerPkey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(crypto.PubkeyToAddress(*signerPkey).Hex()), nil
+}
+
+// normaliseRecoveryId maps v to the 0/1 recovery id expected by
+// crypto.SigToPub. Legacy 27/28 is always accepted, and with a chain id so is
+// EIP-155's 35 + 2*chainId + {0,1}
+func normaliseRecoveryId(v uint64, chainId uint64) (byte, error) {
+	if v == 27 || v == 28 {
+		return byte(v - 27), nil
+	}
+	if chainId != 0 && chainId <= MaxChainId {
+		base := 35 + 2*chainId
+		if v == base || v == base+1 {
+			return byte(v - base), nil
+		}
+	}
+	return 0, ErrBadRecoveryId
+}
@@ -0,0 +1,310 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signRecoveryId signs hash with key and encodes the 0/1 recovery id as the
+// bytes v returns
+func signRecoveryId(t testing.TB, hash []byte, key *ecdsa.PrivateKey, v func(recoveryId byte) []byte) string {
+	t.Helper()
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hexutil.Encode(append(sig[:64], v(sig[64])...))
+}
+
+func legacyV(recoveryId byte) []byte { return []byte{27 + recoveryId} }
+
+func eip155V(chainId uint64) func(recoveryId byte) []byte {
+	return func(recoveryId byte) []byte {
+		v := 35 + 2*chainId + uint64(recoveryId)
+		var encoded []byte
+		for ; v > 0; v >>= 8 {
+			encoded = append([]byte{byte(v)}, encoded...)
+		}
+		return encoded
+	}
+}
+
+func TestResaleRecoveryIds(t *testing.T) {
+	const chainId = 1337
+	tests := []struct {
+		name    string
+		chainId uint64
+		v       func(recoveryId byte) []byte
+		code    uint32
+	}{
+		{"legacy without a chain id", 0, legacyV, codeTypeOK},
+		{"EIP-155 for the configured chain", chainId, eip155V(chainId), codeTypeOK},
+		{"EIP-155 with a two byte v", 137, eip155V(137), codeTypeOK},
+		{"EIP-155 for the largest chain id", MaxChainId, eip155V(MaxChainId), codeTypeOK},
+		{"EIP-155 without a chain id", 0, eip155V(chainId), codeTypeTicketError},
+		{"EIP-155 v padded with a zero byte", 137, func(recoveryId byte) []byte { return append([]byte{0}, eip155V(137)(recoveryId)...) }, codeTypeTicketError},
+		{"legacy with a chain id", chainId, legacyV, codeTypeOK},
+		{"EIP-155 for another chain", chainId, eip155V(chainId + 1), codeTypeTicketError},
+		{"raw recovery id", 0, func(recoveryId byte) []byte { return []byte{recoveryId} }, codeTypeTicketError},
+		{"out of range v", 0, func(byte) []byte { return []byte{29} }, codeTypeTicketError},
+		{"v padded to two bytes", 0, func(recoveryId byte) []byte { return []byte{0, 27 + recoveryId} }, codeTypeTicketError},
+		{"no v", 0, func(byte) []byte { return nil }, codeTypeTicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithChainId(test.chainId))
+			issued := newTicket(1, aliceKey)
+			commitBlock(t, app, issued)
+
+			hash, _ := issued.CalculateHash()
+			resale := TicketTx{Id: 1, Nonce: 2, Details: issued.Details, OwnerAddr: address(bobKey),
+				PrevOwnerProof: signRecoveryId(t, hash, aliceKey, test.v)}
+			if response := checkTx(t, app, resale); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			response := deliver(t, app, resale)
+			if response.Code != test.code {
+				t.Fatalf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			app.Commit()
+
+			owner := address(aliceKey)
+			if test.code == codeTypeOK {
+				owner = address(bobKey)
+			}
+			if stored := app.state.tickets[1]; stored.OwnerAddr != owner {
+				t.Errorf("Ticket is owned by %v, want %v", stored.OwnerAddr, owner)
+			}
+		})
+	}
+}
+
+func TestRecoveryIdsOnOneChain(t *testing.T) {
+	const chainId = 1337
+	tests := []struct {
+		name string
+		v    func(recoveryId byte) []byte
+		code uint32
+	}{
+		{"legacy", legacyV, codeTypeOK},
+		{"EIP-155 for the chain", eip155V(chainId), codeTypeOK},
+		{"EIP-155 for another chain", eip155V(1), codeTypeTicketError},
+		{"raw recovery id", func(recoveryId byte) []byte { return []byte{recoveryId} }, codeTypeTicketError},
+	}
+
+	// Every resale goes to the same store, so legacy and EIP-155 signatures
+	// are accepted side by side rather than by differently configured stores
+	app := NewTicketStoreApplication(WithChainId(chainId))
+	issued := make([]TicketTx, len(tests))
+	for i := range tests {
+		issued[i] = newTicket(uint64(i+1), aliceKey)
+	}
+	commitBlock(t, app, issued...)
+
+	for i, test := range tests {
+		hash, _ := issued[i].CalculateHash()
+		resale := TicketTx{Id: issued[i].Id, Nonce: 2, Details: issued[i].Details, OwnerAddr: address(bobKey),
+			PrevOwnerProof: signRecoveryId(t, hash, aliceKey, test.v)}
+		if response := checkTx(t, app, resale); response.Code != test.code {
+			t.Errorf("%v: CheckTx returned code %v (%v), want %v", test.name, response.Code, response.Log, test.code)
+		}
+		if response := deliver(t, app, resale); response.Code != test.code {
+			t.Errorf("%v: DeliverTx returned code %v (%v), want %v", test.name, response.Code, response.Log, test.code)
+		}
+	}
+	app.Commit()
+
+	for i, test := range tests {
+		owner := address(aliceKey)
+		if test.code == codeTypeOK {
+			owner = address(bobKey)
+		}
+		if stored := app.state.tickets[issued[i].Id]; stored.OwnerAddr != owner {
+			t.Errorf("%v: ticket is owned by %v, want %v", test.name, stored.OwnerAddr, owner)
+		}
+	}
+}
+
+func TestNormaliseRecoveryId(t *testing.T) {
+	tests := []struct {
+		v          uint64
+		chainId    uint64
+		recoveryId byte
+		err        error
+	}{
+		{27, 0, 0, nil},
+		{28, 0, 1, nil},
+		{37, 1, 0, nil},
+		{38, 1, 1, nil},
+		{35 + 2*100, 100, 0, nil},
+		{36 + 2*100, 100, 1, nil},
+		{35 + 2*1337, 1337, 0, nil},
+		{math.MaxUint64 - 1, MaxChainId, 1, nil},
+		{27, 1, 0, nil},
+		{28, 100, 1, nil},
+		{0, 0, 0, ErrBadRecoveryId},
+		{1, 0, 0, ErrBadRecoveryId},
+		{29, 0, 0, ErrBadRecoveryId},
+		{37, 0, 0, ErrBadRecoveryId},
+		{39, 1, 0, ErrBadRecoveryId},
+		{37 + 2*1337, 1337, 0, ErrBadRecoveryId},
+		{37, MaxChainId + 1, 0, ErrBadRecoveryId},
+	}
+	for _, test := range tests {
+		recoveryId, err := normaliseRecoveryId(test.v, test.chainId)
+		if err != test.err || (err == nil && recoveryId != test.recoveryId) {
+			t.Errorf("normaliseRecoveryId(%v, %v) = %v, %v, want %v, %v", test.v, test.chainId, recoveryId, err, test.recoveryId, test.err)
+		}
+	}
+}
+
+func TestSignatureMalleability(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	valid := resell(t, issued, aliceKey, address(bobKey))
+	sig := hexutil.MustDecode(valid.PrevOwnerProof)
+
+	// Each variant is the same signature by the owner in another form, which
+	// would recover the same signer if it were accepted
+	variant := func(change func(sig []byte) []byte) TicketTx {
+		changed := valid
+		changed.PrevOwnerProof = hexutil.Encode(change(append([]byte{}, sig...)))
+		return changed
+	}
+	tests := []struct {
+		name   string
+		resale TicketTx
+		code   uint32
+	}{
+		{"original", valid, codeTypeOK},
+		{"high S twin", variant(func(sig []byte) []byte {
+			s := new(big.Int).SetBytes(sig[32:64])
+			s.Sub(crypto.S256().Params().N, s)
+			copy(sig[32:64], common.LeftPadBytes(s.Bytes(), 32))
+			sig[64] ^= 1
+			return sig
+		}), codeTypeTicketError},
+		{"trailing byte", variant(func(sig []byte) []byte { return append(sig, 0) }), codeTypeTicketError},
+		{"v as two bytes", variant(func(sig []byte) []byte { return append(sig[:64], 0, sig[64]) }), codeTypeTicketError},
+		{"raw recovery id", variant(func(sig []byte) []byte {
+			sig[64] -= 27
+			return sig
+		}), codeTypeTicketError},
+		{"EIP-155 v without a chain id", variant(func(sig []byte) []byte {
+			sig[64] += 35 + 2 - 27
+			return sig
+		}), codeTypeTicketError},
+		{"truncated", variant(func(sig []byte) []byte { return sig[:64] }), codeTypeTicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			commitBlock(t, app, issued)
+			root := app.state.appHash()
+
+			if response := checkTx(t, app, test.resale); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if response := deliver(t, app, test.resale); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			appHash := app.Commit().Data
+			if changed := !bytes.Equal(appHash, root); changed != (test.code == codeTypeOK) {
+				t.Errorf("Commit changed the app hash is %v, want %v", changed, test.code == codeTypeOK)
+			}
+			if _, err := RecoverTransferSigner(test.resale, issued, 0); (err == nil) != (test.code == codeTypeOK) {
+				t.Errorf("RecoverTransferSigner returned %v", err)
+			}
+		})
+	}
+}
+
+func TestChainIdRange(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	tests := []struct {
+		chainId uint64
+		vBytes  int
+	}{
+		{1, 1},
+		{109, 1},
+		{110, 2},
+		{137, 2},
+		{1337, 2},
+		{MaxChainId, 8},
+	}
+	for _, test := range tests {
+		proof, err := SignTicketTransferForChain(issued, aliceKey, test.chainId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length := len(hexutil.MustDecode(proof)); length != 64+test.vBytes {
+			t.Errorf("Chain %v proof has %v bytes, want %v", test.chainId, length, 64+test.vBytes)
+		}
+		resale := TicketTx{Id: 1, Nonce: 2, Details: issued.Details, OwnerAddr: address(bobKey), PrevOwnerProof: proof}
+		if signer, err := RecoverTransferSigner(resale, issued, test.chainId); err != nil || signer != address(aliceKey) {
+			t.Errorf("Chain %v resale recovered %v, %v, want %v", test.chainId, signer, err, address(aliceKey))
+		}
+		if _, err := RecoverTransferSigner(resale, issued, 0); err != ErrBadRecoveryId {
+			t.Errorf("Chain %v resale without a chain id returned %v, want %v", test.chainId, err, ErrBadRecoveryId)
+		}
+	}
+
+	if _, err := SignTicketTransferForChain(issued, aliceKey, MaxChainId+1); err != ErrBadChainId {
+		t.Errorf("SignTicketTransferForChain with chain id %v returned %v, want %v", uint64(MaxChainId+1), err, ErrBadChainId)
+	}
+}
+
+func TestProofSchemes(t *testing.T) {
+	const chainId = 5
+	issued := newTicket(1, aliceKey)
+	signed := func(scheme string, chainId uint64) string {
+		hash, err := ownerProofSchemes[scheme].signedHash(issued, chainId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chainId == 0 {
+			return signRecoveryId(t, hash, aliceKey, legacyV)
+		}
+		return signRecoveryId(t, hash, aliceKey, eip155V(chainId))
+	}
+
+	tests := []struct {
+		name    string
+		scheme  string
+		chainId uint64
+		proof   string
+		code    uint32
+		log     string
+	}{
+		{"default", "", 0, signed("", 0), codeTypeOK, ""},
+		{"personal_sign", "personal_sign", 0, signed("personal_sign", 0), codeTypeOK, ""},
+		{"eip712", "eip712", 0, signed("eip712", 0), codeTypeOK, ""},
+		{"eip712 bound to the chain", "eip712", chainId, signed("eip712", chainId), codeTypeOK, ""},
+		{"eip712 signed for another chain", "eip712", chainId, signed("eip712", chainId+1), codeTypeTicketError, ErrBadRecoveryId.Error()},
+		{"personal_sign proof named as the default", "", 0, signed("personal_sign", 0), codeTypeTicketError, ErrBadSignature.Error()},
+		{"default proof named as eip712", "eip712", 0, signed("", 0), codeTypeTicketError, ErrBadSignature.Error()},
+		{"unknown scheme", "eth_signTypedData", 0, signed("", 0), codeTypeTicketError, ErrBadProofScheme.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithChainId(test.chainId))
+			commitBlock(t, app, issued)
+
+			resale := TicketTx{Id: 1, Nonce: 2, Details: issued.Details, OwnerAddr: address(bobKey),
+				PrevOwnerProof: test.proof, ProofScheme: test.scheme}
+			if response := checkTx(t, app, resale); response.Code != test.code || !strings.Contains(response.Log, test.log) {
+				t.Errorf("CheckTx returned code %v (%v), want %v containing %q", response.Code, response.Log, test.code, test.log)
+			}
+			if response := deliver(t, app, resale); response.Code != test.code || !strings.Contains(response.Log, test.log) {
+				t.Errorf("DeliverTx returned code %v (%v), want %v containing %q", response.Code, response.Log, test.code, test.log)
+			}
+		})
+	}
+}
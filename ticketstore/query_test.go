@@ -0,0 +1,308 @@
+package ticketstore
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestQueryMissingTicket(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(1, aliceKey))
+
+	tests := []struct {
+		name string
+		path string
+		data string
+		code uint32
+		log  string
+	}{
+		{"ticket", "ticket", "2", codeTypeNotFound, "Ticket 2 could not be found"},
+		{"last change", "lastChange", "2", codeTypeNotFound, "Ticket 2 could not be found"},
+		{"history", "history", "2", codeTypeNotFound, "Ticket 2 could not be found"},
+		{"isowner", "isowner", `{"id":2,"address":"` + address(aliceKey) + `"}`, codeTypeNotFound, "Ticket 2 could not be found"},
+		{"malformed id", "ticket", "two", codeTypeEncodingError, "two is not a valid ticket id"},
+		{"empty id", "ticket", "", codeTypeEncodingError, "not a valid ticket id"},
+		{"unknown path", "tickett", "1", codeTypeUnknownPath, "got tickett"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := query(app, test.path, test.data, 0)
+			if response.Code != test.code {
+				t.Errorf("%v query returned code %v, want %v", test.path, response.Code, test.code)
+			}
+			if !strings.Contains(response.Log, test.log) {
+				t.Errorf("%v query logged %q, want it to contain %q", test.path, response.Log, test.log)
+			}
+			if len(response.Value) > 0 {
+				t.Errorf("Failed %v query returned a value: %s", test.path, response.Value)
+			}
+		})
+	}
+}
+
+// TestQueryPaths checks the unknown path error lists exactly the paths the
+// cases of QueryContext's switch answer
+func TestQueryPaths(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "ticketstore.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		decl, ok := node.(*ast.FuncDecl)
+		if !ok || decl.Name.Name != "QueryContext" {
+			return true
+		}
+		for _, stmt := range decl.Body.List {
+			if switchStmt, ok := stmt.(*ast.SwitchStmt); ok {
+				for _, clause := range switchStmt.Body.List {
+					for _, expr := range clause.(*ast.CaseClause).List {
+						path, _ := strconv.Unquote(expr.(*ast.BasicLit).Value)
+						cases = append(cases, path)
+					}
+				}
+			}
+		}
+		return false
+	})
+	if !reflect.DeepEqual(cases, queryPaths) {
+		t.Errorf("QueryContext answers paths %v, want the listed %v", cases, queryPaths)
+	}
+
+	response := query(NewTicketStoreApplication(), "tickett", "", 0)
+	expected := strings.TrimSuffix(strings.TrimPrefix(response.Log, "Invalid query path. Expected "), ", got tickett")
+	listed := strings.Split(strings.Replace(expected, " or ", ", ", 1), ", ")
+	if response.Code != codeTypeUnknownPath || !reflect.DeepEqual(listed, cases) {
+		t.Errorf("Unknown path returned code %v listing %v, want %v listing %v", response.Code, listed, codeTypeUnknownPath, cases)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	app := NewTicketStoreApplication()
+	var tickets []TicketTx
+	for id := uint64(1); id <= 5; id++ {
+		tickets = append(tickets, newTicket(id, aliceKey))
+	}
+	commitBlock(t, app, tickets...)
+
+	tests := []struct {
+		name string
+		page string
+		ids  []uint64
+		code uint32
+	}{
+		{"first page", `"limit":2`, []uint64{1, 2}, codeTypeOK},
+		{"middle page", `"limit":2,"offset":2`, []uint64{3, 4}, codeTypeOK},
+		{"last partial page", `"limit":2,"offset":4`, []uint64{5}, codeTypeOK},
+		{"past the end", `"limit":2,"offset":9`, []uint64{}, codeTypeOK},
+		{"offset without limit", `"offset":3`, []uint64{4, 5}, codeTypeOK},
+		{"no page", ``, []uint64{1, 2, 3, 4, 5}, codeTypeOK},
+		{"negative limit", `"limit":-1`, nil, codeTypeEncodingError},
+		{"negative offset", `"offset":-1`, nil, codeTypeEncodingError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ownerQuery := `{"owner":"` + address(aliceKey) + `"`
+			if test.page != "" {
+				ownerQuery += "," + test.page
+			}
+			response := query(app, "owner", ownerQuery+"}", 0)
+			if response.Code != test.code {
+				t.Fatalf("Owner query returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if test.code == codeTypeOK {
+				var owned []Ticket
+				queryJSON(t, app, "owner", ownerQuery+"}", 0, &owned)
+				ids := []uint64{}
+				for _, ticket := range owned {
+					ids = append(ids, ticket.Id)
+				}
+				if !reflect.DeepEqual(ids, test.ids) {
+					t.Errorf("Owner query returned tickets %v, want %v", ids, test.ids)
+				}
+			}
+
+			response = query(app, "dump", "{"+test.page+"}", 0)
+			if response.Code != test.code {
+				t.Fatalf("Dump query returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if test.code == codeTypeOK {
+				var dumped dumpResponse
+				queryJSON(t, app, "dump", "{"+test.page+"}", 0, &dumped)
+				ids := []uint64{}
+				for _, ticket := range dumped.Tickets {
+					ids = append(ids, ticket.Id)
+				}
+				if !reflect.DeepEqual(ids, test.ids) || dumped.Total != 5 {
+					t.Errorf("Dump query returned tickets %v of %v, want %v of 5", ids, dumped.Total, test.ids)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryFailureCodes(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(1, aliceKey))
+
+	tests := []struct {
+		path   string
+		data   string
+		height int64
+		code   uint32
+	}{
+		{"ticket", "x", 0, codeTypeEncodingError},
+		{"ticket", "1", 5, codeTypeHeightUnavailable},
+		{"tickets", "[1", 0, codeTypeEncodingError},
+		{"tickets", "[1]", 5, codeTypeHeightUnavailable},
+		{"lastChange", "x", 0, codeTypeEncodingError},
+		{"dump", "{", 0, codeTypeEncodingError},
+		{"owner", "{", 0, codeTypeEncodingError},
+		{"owner", address(aliceKey), 5, codeTypeHeightUnavailable},
+		{"holders", "x", 0, codeTypeEncodingError},
+		{"isowner", "{", 0, codeTypeEncodingError},
+		{"history", "x", 0, codeTypeEncodingError},
+		{"tree", "", 0, codeTypeUnknownPath},
+		{"verify", "{", 0, codeTypeEncodingError},
+		{"", "", 0, codeTypeUnknownPath},
+	}
+	for _, test := range tests {
+		t.Run(test.path+" "+test.data, func(t *testing.T) {
+			response := query(app, test.path, test.data, test.height)
+			if response.Code != test.code {
+				t.Errorf("%v query returned code %v (%v), want %v", test.path, response.Code, response.Log, test.code)
+			}
+			if response.Log == "" {
+				t.Errorf("%v query failed without a Log", test.path)
+			}
+			if _, described := codes.Descriptions[response.Code]; !described {
+				t.Errorf("%v query returned undocumented code %v", test.path, response.Code)
+			}
+		})
+	}
+}
+
+func TestRootQuery(t *testing.T) {
+	app := NewTicketStoreApplication()
+	first := newTicket(1, aliceKey)
+
+	steps := []struct {
+		name   string
+		block  func() []byte
+		height int64
+	}{
+		{"before the first block", func() []byte { return nil }, 0},
+		{"after a block of tickets", func() []byte { return commitBlock(t, app, first) }, 1},
+		{"after an empty block", func() []byte { return app.Commit().Data }, 2},
+		{"while a block is delivered", func() []byte {
+			deliver(t, app, newTicket(2, aliceKey))
+			return referenceRoot(t, sha256.New, first)
+		}, 2},
+	}
+	for _, step := range steps {
+		root := step.block()
+		var response rootResponse
+		queryJSON(t, app, "root", "", 0, &response)
+		if response.RootHash != hexutil.Encode(root) || response.Height != step.height {
+			t.Errorf("%v: root query returned %+v, want %x at height %v", step.name, response, root, step.height)
+		}
+	}
+}
+
+func TestTicketsQuery(t *testing.T) {
+	app := NewTicketStoreApplication(WithMaxBatchSize(4))
+	commitBlock(t, app, newTicket(1, aliceKey), newTicket(2, bobKey), newTicket(3, carolKey))
+
+	tests := []struct {
+		name  string
+		ids   string
+		found []bool
+		code  uint32
+	}{
+		{"empty batch", "[]", []bool{}, codeTypeOK},
+		{"existing ids", "[3,1]", []bool{true, true}, codeTypeOK},
+		{"mixed ids", "[1,9,2,0]", []bool{true, false, true, false}, codeTypeOK},
+		{"repeated id", "[2,2]", []bool{true, true}, codeTypeOK},
+		{"over the cap", "[1,2,3,4,5]", nil, codeTypeEncodingError},
+		{"not an array", "1", nil, codeTypeEncodingError},
+		{"negative id", "[-1]", nil, codeTypeEncodingError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := query(app, "tickets", test.ids, 0)
+			if response.Code != test.code {
+				t.Fatalf("tickets query returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if test.code != codeTypeOK {
+				return
+			}
+			var ids []uint64
+			json.Unmarshal([]byte(test.ids), &ids)
+			var tickets []*TicketResponse
+			if err := json.Unmarshal(response.Value, &tickets); err != nil || len(tickets) != len(test.found) {
+				t.Fatalf("tickets query returned %s, want %v entries", response.Value, len(test.found))
+			}
+			for i, ticket := range tickets {
+				if (ticket != nil) != test.found[i] {
+					t.Fatalf("Entry %v is %+v, want found %v", i, ticket, test.found[i])
+				}
+				if ticket == nil {
+					continue
+				}
+				// Each entry matches the single ticket query for its id
+				var single TicketResponse
+				queryJSON(t, app, "ticket", fmt.Sprint(ids[i]), 0, &single)
+				if !reflect.DeepEqual(*ticket, single) {
+					t.Errorf("Entry %v is %+v, want %+v", i, *ticket, single)
+				}
+			}
+		})
+	}
+}
+
+func TestPrevOwnerAddr(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	toBob := resell(t, issued, aliceKey, address(bobKey))
+	toCarol := resell(t, toBob, bobKey, address(carolKey))
+
+	steps := []struct {
+		name      string
+		ticket    TicketTx
+		owner     string
+		prevOwner string
+	}{
+		{"created", issued, address(aliceKey), ""},
+		{"resold", toBob, address(bobKey), address(aliceKey)},
+		{"resold again", toCarol, address(carolKey), address(bobKey)},
+	}
+	for i, step := range steps {
+		commitBlock(t, app, step.ticket)
+
+		var response TicketResponse
+		queryJSON(t, app, "ticket", "1", 0, &response)
+		if response.Ticket.OwnerAddr != step.owner || response.Ticket.PrevOwnerAddr != step.prevOwner {
+			t.Errorf("%v: ticket is owned by %q after %q, want %q after %q", step.name,
+				response.Ticket.OwnerAddr, response.Ticket.PrevOwnerAddr, step.owner, step.prevOwner)
+		}
+
+		// Earlier heights keep the previous owner they had
+		for height, earlier := range steps[:i+1] {
+			queryJSON(t, app, "ticket", "1", int64(height+1), &response)
+			if response.Ticket.PrevOwnerAddr != earlier.prevOwner {
+				t.Errorf("%v: ticket at height %v has previous owner %q, want %q", step.name, height+1, response.Ticket.PrevOwnerAddr, earlier.prevOwner)
+			}
+		}
+	}
+}
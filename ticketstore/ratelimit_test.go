@@ -0,0 +1,58 @@
+package ticketstore
+
+import "testing"
+
+func TestMaxTransfersPerBlock(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	first := resell(t, issued, aliceKey, address(bobKey))
+	second := resell(t, first, bobKey, address(carolKey))
+	third := resell(t, second, carolKey, address(aliceKey))
+
+	tests := []struct {
+		name   string
+		max    int
+		blocks [][][]TicketTx
+		codes  [][]uint32
+	}{
+		{"no limit", 0,
+			[][][]TicketTx{{{issued}, {first}, {second}, {third}}},
+			[][]uint32{{codeTypeOK, codeTypeOK, codeTypeOK, codeTypeOK}}},
+		{"limit within a block", 2,
+			[][][]TicketTx{{{issued}, {first}, {second}}},
+			[][]uint32{{codeTypeOK, codeTypeOK, codeTypeRateLimited}}},
+		{"limit resets each block", 2,
+			[][][]TicketTx{{{issued}, {first}}, {{second}, {third}}},
+			[][]uint32{{codeTypeOK, codeTypeOK}, {codeTypeOK, codeTypeOK}}},
+		{"bundle counts each change", 2,
+			[][][]TicketTx{{{issued, first, second}, {issued}}},
+			[][]uint32{{codeTypeRateLimited, codeTypeOK}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithMaxTransfersPerBlock(test.max))
+			for b, block := range test.blocks {
+				for i, tx := range block {
+					if response := deliver(t, app, tx...); response.Code != test.codes[b][i] {
+						t.Errorf("Block %v tx %v returned code %v (%v), want %v", b, i, response.Code, response.Log, test.codes[b][i])
+					}
+				}
+				app.Commit()
+			}
+		})
+	}
+}
+
+func TestMaxTransfersPerBlockSparesCheckTx(t *testing.T) {
+	app := NewTicketStoreApplication(WithMaxTransfersPerBlock(1))
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued)
+	if response := deliver(t, app, resell(t, issued, aliceKey, address(bobKey))); response.Code != codeTypeOK {
+		t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+	}
+
+	// The block being delivered has used up the ticket's transfers, but the
+	// mempool still admits a transfer for a later block
+	if response := checkTx(t, app, resell(t, issued, aliceKey, address(carolKey))); response.Code != codeTypeOK {
+		t.Errorf("CheckTx returned code %v: %v", response.Code, response.Log)
+	}
+}
@@ -0,0 +1,75 @@
+package ticketstore
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// panickingLogger panics when asked to log the change of ticket panicId,
+// standing in for a fault part way through applying a bundle
+type panickingLogger struct {
+	capturingLogger
+	panicId uint64
+}
+
+func (logger panickingLogger) Debug(msg string, keyvals ...interface{}) {
+	entry := logEntry{keyvals: keyvals}
+	if msg == "Changing ticket" && entry.field("id") == logger.panicId {
+		panic("logger failed")
+	}
+	logger.capturingLogger.Debug(msg, keyvals...)
+}
+
+func TestPanicPartWayThroughBundle(t *testing.T) {
+	issued := []TicketTx{newTicket(1, aliceKey), newTicket(2, aliceKey), newTicket(3, aliceKey)}
+	bundle := []TicketTx{
+		resell(t, issued[0], aliceKey, address(bobKey)),
+		resell(t, issued[1], aliceKey, address(bobKey)),
+		newTicket(4, bobKey),
+	}
+
+	for _, panicId := range []uint64{1, 2, 4} {
+		t.Run(fmt.Sprint("ticket ", panicId), func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			root := commitBlock(t, app, issued...)
+			logger := panickingLogger{newCapturingLogger(), panicId}
+			app.logger = logger
+			tickets := sortTickets(app.state.tickets)
+			owners := app.state.owners.copy()
+			size := app.state.size
+
+			response := app.DeliverTx(types.RequestDeliverTx{Tx: encodeTx(t, bundle...)})
+			if response.Code != codeTypeInternalError || response.Log != "Internal error: logger failed" {
+				t.Fatalf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, codeTypeInternalError)
+			}
+			if !reflect.DeepEqual(sortTickets(app.state.tickets), tickets) || !reflect.DeepEqual(app.state.owners, owners) {
+				t.Errorf("Bundle was partly applied: tickets %+v, owners %v", app.state.tickets, app.state.owners)
+			}
+			if app.state.size != size || len(app.state.tempTreeContent) != 0 || len(app.state.blockTransfers) != 0 {
+				t.Errorf("Bundle was partly counted: size %v, tree content %v, transfers %v",
+					app.state.size, app.state.tempTreeContent, app.state.blockTransfers)
+			}
+			var logged bool
+			for _, entry := range logger.take() {
+				logged = logged || (entry.level == "error" && strings.Contains(entry.field("stack").(string), "stageTicketTxs"))
+			}
+			if !logged {
+				t.Error("Panic was not logged with its stack")
+			}
+
+			// The node carries on and the block commits without the bundle
+			if response := deliver(t, app, newTicket(5, carolKey)); response.Code != codeTypeOK {
+				t.Errorf("DeliverTx after the panic returned code %v: %v", response.Code, response.Log)
+			}
+			live := append(append([]TicketTx{}, issued...), newTicket(5, carolKey))
+			if committed := app.Commit().Data; bytes.Equal(committed, root) || !bytes.Equal(committed, referenceRoot(t, app.state.hashStrategy, live...)) {
+				t.Errorf("Block committed root %x, want the root over the issued tickets and ticket 5", committed)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package ticketstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRetainHeights(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		available   []int64
+		unavailable []int64
+	}{
+		{"every height by default", nil, []int64{1, 2, 3, 4, 5}, nil},
+		{"latest two", []Option{WithRetainHeights(2)}, []int64{4, 5}, []int64{1, 2, 3}},
+		{"latest only", []Option{WithRetainHeights(1)}, []int64{5}, []int64{1, 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(test.opts...)
+			for id := uint64(1); id <= 5; id++ {
+				commitBlock(t, app, newTicket(id, aliceKey))
+			}
+
+			for _, height := range test.available {
+				if response := query(app, "ticket", "1", height); response.Code != codeTypeOK {
+					t.Errorf("Ticket query at height %v returned code %v: %v", height, response.Code, response.Log)
+				}
+				if _, kept := app.state.history[height]; !kept {
+					t.Errorf("History dropped height %v", height)
+				}
+			}
+			for _, height := range test.unavailable {
+				if response := query(app, "ticket", fmt.Sprintf("1:%v", height), 0); response.Code != codeTypeHeightUnavailable {
+					t.Errorf("Ticket query at pruned height %v returned code %v, want %v", height, response.Code, codeTypeHeightUnavailable)
+				}
+				if _, kept := app.state.history[height]; kept {
+					t.Errorf("History kept pruned height %v", height)
+				}
+			}
+			if len(app.state.history) != len(test.available) {
+				t.Errorf("History holds %v heights, want %v", len(app.state.history), len(test.available))
+			}
+		})
+	}
+}
+
+func TestRetainHeightsLastChange(t *testing.T) {
+	app := NewTicketStoreApplication(WithRetainHeights(2))
+	commitBlock(t, app, newTicket(1, aliceKey))
+	commitBlock(t, app, newTicket(2, aliceKey))
+	commitBlock(t, app, newTicket(3, aliceKey))
+
+	tests := []struct {
+		id   string
+		code uint32
+	}{
+		{"1", codeTypeHeightUnavailable},
+		{"2", codeTypeOK},
+		{"3", codeTypeOK},
+	}
+	for _, test := range tests {
+		if response := query(app, "lastChange", test.id, 0); response.Code != test.code {
+			t.Errorf("lastChange query for ticket %v returned code %v (%v), want %v", test.id, response.Code, response.Log, test.code)
+		}
+	}
+}
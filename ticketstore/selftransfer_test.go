@@ -0,0 +1,62 @@
+package ticketstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestSelfTransfers(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	toBob := resell(t, issued, aliceKey, address(bobKey))
+	tests := []struct {
+		name    string
+		tickets []TicketTx
+		code    uint32
+		strict  uint32
+	}{
+		{"resale to the owner", []TicketTx{resell(t, issued, aliceKey, address(aliceKey))}, codeTypeOK, codeTypeSelfTransfer},
+		{"resale to the owner checksummed", []TicketTx{resell(t, issued, aliceKey, crypto.PubkeyToAddress(aliceKey.PublicKey).Hex())}, codeTypeOK, codeTypeSelfTransfer},
+		{"resale to someone else", []TicketTx{toBob}, codeTypeOK, codeTypeOK},
+		{"resold back within a bundle", []TicketTx{toBob, resell(t, toBob, bobKey, address(aliceKey))}, codeTypeOK, codeTypeOK},
+		{"burn", []TicketTx{resell(t, issued, aliceKey, burnAddress)}, codeTypeOK, codeTypeOK},
+		{"new ticket to its issuer", []TicketTx{newTicket(2, aliceKey)}, codeTypeOK, codeTypeOK},
+	}
+	for _, test := range tests {
+		for _, strict := range []bool{false, true} {
+			name, code, opts := test.name, test.code, []Option(nil)
+			if strict {
+				name, code, opts = test.name+" without self transfers", test.strict, []Option{WithoutSelfTransfers()}
+			}
+			t.Run(name, func(t *testing.T) {
+				app := NewTicketStoreApplication(opts...)
+				root := commitBlock(t, app, issued)
+
+				if response := checkTx(t, app, test.tickets...); response.Code != code {
+					t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, code)
+				}
+				if response := deliver(t, app, test.tickets...); response.Code != code {
+					t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, code)
+				}
+				app.Commit()
+
+				// A rejected self transfer leaves the ticket, its history and
+				// the root as they were
+				changed := !bytes.Equal(app.Info(types.RequestInfo{}).LastBlockAppHash, root)
+				if code == codeTypeOK {
+					if !changed {
+						t.Errorf("Accepted tx left the root at %x", root)
+					}
+					return
+				}
+				var stored TicketResponse
+				queryJSON(t, app, "ticket", "1", 0, &stored)
+				if changed || stored.Ticket.Nonce != issued.Nonce || len(stored.Ticket.History) != 1 {
+					t.Errorf("Rejected tx changed the root or ticket to %+v", stored.Ticket)
+				}
+			})
+		}
+	}
+}
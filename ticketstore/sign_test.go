@@ -0,0 +1,130 @@
+package ticketstore
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSignTicketTransfer(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	resold := resell(t, issued, aliceKey, address(bobKey))
+
+	tests := []struct {
+		name string
+		prev TicketTx
+		key  *ecdsa.PrivateKey
+	}{
+		{"issued ticket", issued, aliceKey},
+		{"resold ticket", resold, bobKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof, err := SignTicketTransfer(test.prev, test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := hexutil.Decode(proof)
+			if err != nil || len(sig) != 65 || (sig[64] != 27 && sig[64] != 28) {
+				t.Fatalf("SignTicketTransfer returned %v, want 65 bytes ending in v 27 or 28", proof)
+			}
+
+			resale := TicketTx{Id: 1, Nonce: test.prev.Nonce + 1, OwnerAddr: address(carolKey), PrevOwnerProof: proof}
+			signer, err := RecoverTransferSigner(resale, test.prev, 0)
+			if err != nil || signer != test.prev.OwnerAddr {
+				t.Errorf("RecoverTransferSigner returned %v, %v, want %v", signer, err, test.prev.OwnerAddr)
+			}
+		})
+	}
+}
+
+func TestSignTicketIssue(t *testing.T) {
+	issuer := address(carolKey)
+	withOldProof := newTicket(1, aliceKey)
+	withOldProof.PrevOwnerProof = "0x1234"
+
+	tests := []struct {
+		name   string
+		ticket TicketTx
+		signer func(TicketTx) string
+		code   uint32
+	}{
+		{"signed by the issuer", newTicket(1, aliceKey), func(ticket TicketTx) string {
+			proof, _ := SignTicketIssue(ticket, carolKey)
+			return proof
+		}, codeTypeOK},
+		{"existing proof ignored", withOldProof, func(ticket TicketTx) string {
+			proof, _ := SignTicketIssue(ticket, carolKey)
+			return proof
+		}, codeTypeOK},
+		{"signed by someone else", newTicket(1, aliceKey), func(ticket TicketTx) string {
+			proof, _ := SignTicketIssue(ticket, aliceKey)
+			return proof
+		}, codeTypeUnauthorized},
+		{"unsigned", newTicket(1, aliceKey), func(TicketTx) string { return "" }, codeTypeTicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithIssuers(issuer))
+			ticket := test.ticket
+			ticket.PrevOwnerProof = test.signer(test.ticket)
+			if response := deliver(t, app, ticket); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+		})
+	}
+}
+
+func TestIssuersOnlyGateCreation(t *testing.T) {
+	issue := func(t *testing.T, ticket TicketTx, key *ecdsa.PrivateKey) TicketTx {
+		proof, err := SignTicketIssue(ticket, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticket.PrevOwnerProof = proof
+		return ticket
+	}
+	issued := issue(t, newTicket(1, aliceKey), carolKey)
+
+	tests := []struct {
+		name    string
+		issuers []string
+		ticket  TicketTx
+		code    uint32
+		log     string
+	}{
+		{"created by an issuer", []string{address(carolKey)}, issued, codeTypeOK, ""},
+		{"issuer listed checksummed", []string{crypto.PubkeyToAddress(carolKey.PublicKey).Hex()}, issued, codeTypeOK, ""},
+		{"created by a non-issuer", []string{address(bobKey)}, issued, codeTypeUnauthorized, ErrUnauthorizedIssuer.Error()},
+		{"resold by the owner", []string{address(carolKey)}, resell(t, issued, aliceKey, address(bobKey)), codeTypeOK, ""},
+		{"resold by the issuer", []string{address(carolKey)}, resell(t, issued, carolKey, address(bobKey)), codeTypeTicketError, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithIssuers(test.issuers...))
+			if test.ticket.Nonce > 1 {
+				commitBlock(t, app, issued)
+			}
+
+			if response := checkTx(t, app, test.ticket); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			response := deliver(t, app, test.ticket)
+			if response.Code != test.code || !strings.Contains(response.Log, test.log) {
+				t.Errorf("DeliverTx returned code %v (%v), want %v (%v)", response.Code, response.Log, test.code, test.log)
+			}
+			app.Commit()
+
+			_, stored := app.state.tickets[test.ticket.Id]
+			if want := test.code == codeTypeOK || test.ticket.Nonce > 1; stored != want {
+				t.Errorf("Ticket %v stored is %v, want %v", test.ticket.Id, stored, want)
+			}
+			if test.code == codeTypeOK && app.state.tickets[test.ticket.Id].OwnerAddr != test.ticket.OwnerAddr {
+				t.Errorf("Ticket %v is owned by %v, want %v", test.ticket.Id, app.state.tickets[test.ticket.Id].OwnerAddr, test.ticket.OwnerAddr)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package ticketstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestSimulateQuery(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	valid := resell(t, issued, aliceKey, address(bobKey))
+	forged := resell(t, issued, carolKey, address(bobKey))
+	stale := issued
+	stale.Details = "Stale"
+
+	tests := []struct {
+		name string
+		tx   []byte
+		code uint32
+	}{
+		{"valid transfer", encodeTx(t, valid), codeTypeOK},
+		{"bad signature", encodeTx(t, forged), codeTypeTicketError},
+		{"stale nonce", encodeTx(t, stale), codeTypeTicketError},
+		{"new ticket", encodeTx(t, newTicket(2, carolKey)), codeTypeOK},
+		{"not JSON", []byte("{"), codeTypeEncodingError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			root := commitBlock(t, app, issued)
+
+			var simulated simulateResponse
+			queryJSON(t, app, "simulate", string(test.tx), 0, &simulated)
+			if simulated.Code != test.code {
+				t.Errorf("simulate query returned code %v (%v), want %v", simulated.Code, simulated.Log, test.code)
+			}
+			if app.state.tickets[1].TicketTx != issued || len(app.state.tickets) != 1 {
+				t.Errorf("simulate query changed the tickets to %+v", app.state.tickets)
+			}
+
+			response := app.DeliverTx(types.RequestDeliverTx{Tx: test.tx})
+			if response.Code != simulated.Code || response.Log != simulated.Log || response.GasWanted != simulated.Gas {
+				t.Errorf("DeliverTx returned code %v (%v) with gas %v, simulate returned %+v", response.Code, response.Log, response.GasWanted, simulated)
+			}
+			if test.code != codeTypeOK && !bytes.Equal(app.Commit().Data, root) {
+				t.Error("Rejected tx changed the root")
+			}
+		})
+	}
+}
+
+func TestSimulateChecksSignaturesInLazyMode(t *testing.T) {
+	app := NewTicketStoreApplication(WithLazySignatures())
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued)
+
+	var simulated simulateResponse
+	queryJSON(t, app, "simulate", string(encodeTx(t, resell(t, issued, carolKey, address(bobKey)))), 0, &simulated)
+	if simulated.Code != codeTypeTicketError {
+		t.Errorf("simulate query returned code %v (%v), want %v", simulated.Code, simulated.Log, codeTypeTicketError)
+	}
+}
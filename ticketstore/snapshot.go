@@ -0,0 +1,118 @@
+package ticketstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// snapshotKeepRecent is how many snapshots are kept in the data directory
+const snapshotKeepRecent = 2
+
+// snapshotState is the serialised state carried by a snapshot and kept in the
+// data directory. Tickets are ordered by id so every node produces byte
+// identical snapshots
+type snapshotState struct {
+	Version int      `json:"version"`
+	Height  int64    `json:"height"`
+	Size    int64    `json:"size"`
+	Tickets []Ticket `json:"tickets"`
+	Stats   txStats  `json:"stats"`
+	// RootHash is the app hash at Height. States written before it was
+	// recorded leave it empty and are not checked against it
+	RootHash string `json:"rootHash,omitempty"`
+}
+
+// WithSnapshotInterval writes a snapshot of the committed state to the data
+// directory every interval heights, keeping the most recent two, which the
+// restore subcommand can rebuild a node's data directory from. It has no
+// effect on an application without a data directory
+func WithSnapshotInterval(interval int64) Option {
+	return func(app *TicketStoreApplication) {
+		app.snapshotInterval = interval
+	}
+}
+
+// takeSnapshot writes a snapshot of the committed state to the data directory
+// and removes the older ones. The caller must hold the write lock
+func (app *TicketStoreApplication) takeSnapshot() {
+	data, err := app.state.encodeSnapshotState()
+	if err != nil {
+		panic(err)
+	}
+	if err := writeSnapshotFile(app.dataDir, app.state.height, data); err != nil {
+		panic(err)
+	}
+	if err := pruneSnapshotFiles(app.dataDir, snapshotKeepRecent); err != nil {
+		panic(err)
+	}
+}
+
+func (state state) encodeSnapshotState() ([]byte, error) {
+	return canonicalJSON(snapshotState{
+		Version:  stateVersion,
+		Height:   state.height,
+		Size:     state.size,
+		Tickets:  sortTickets(state.tickets),
+		Stats:    state.committedStats,
+		RootHash: hexutil.Encode(state.appHash())})
+}
+
+// encodeCommittedState encodes the state as of the last Commit, leaving out
+// anything delivered since
+func (state state) encodeCommittedState() ([]byte, error) {
+	committed := snapshotState{
+		Version:  stateVersion,
+		Height:   state.height,
+		Tickets:  []Ticket{},
+		Stats:    state.committedStats,
+		RootHash: hexutil.Encode(state.appHash())}
+	if snapshot, ok := state.history[state.height]; ok {
+		committed.Size = snapshot.size
+		committed.Tickets = snapshot.tickets.sorted()
+	}
+	return canonicalJSON(committed)
+}
+
+// decodeSnapshotState rebuilds a state, including its tree hashed with
+// hashStrategy, from a snapshot, first migrating it from any older version.
+// The rebuilt root must match the one the snapshot recorded, if any
+func decodeSnapshotState(data []byte, hashStrategy func() hash.Hash) (state, error) {
+	data, err := migrateState(data)
+	if err != nil {
+		return state{}, err
+	}
+
+	var decoded snapshotState
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return state{}, err
+	}
+
+	restored := state{
+		size:           decoded.Size,
+		height:         decoded.Height,
+		tickets:        make(map[uint64]Ticket),
+		history:        make(map[int64]snapshot),
+		retainedFrom:   decoded.Height,
+		hashStrategy:   hashStrategy,
+		deliverStats:   decoded.Stats.copy(),
+		committedStats: decoded.Stats}
+	for _, ticket := range decoded.Tickets {
+		if _, exists := restored.tickets[ticket.Id]; exists {
+			return state{}, fmt.Errorf("Snapshot contains ticket %v more than once", ticket.Id)
+		}
+		restored.tickets[ticket.Id] = ticket
+	}
+	restored.owners = indexOwners(restored.tickets)
+
+	if err := restored.buildTree(); err != nil {
+		return state{}, err
+	}
+	if decoded.RootHash != "" && !strings.EqualFold(decoded.RootHash, hexutil.Encode(restored.appHash())) {
+		return state{}, fmt.Errorf("Snapshot root %v does not match the rebuilt root %v", decoded.RootHash, hexutil.Encode(restored.appHash()))
+	}
+	return restored, nil
+}
@@ -0,0 +1,151 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// tempDir creates a directory for a test to use, returning it with a function
+// that removes it
+func tempDir(t testing.TB) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ticketstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func openApp(t testing.TB, dataDir string, opts ...Option) *TicketStoreApplication {
+	t.Helper()
+	app, err := OpenTicketStoreApplication(dataDir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	dataDir, cleanup := tempDir(t)
+	defer cleanup()
+	app := openApp(t, dataDir, WithSnapshotInterval(2))
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued, newTicket(2, bobKey))
+	commitBlock(t, app, newTicket(3, carolKey))
+	commitBlock(t, app, resell(t, issued, aliceKey, address(carolKey)))
+	root := commitBlock(t, app, newTicket(4, aliceKey))
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := ReadDataDir(dataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var heights []int64
+	for _, snapshot := range layout.Snapshots {
+		heights = append(heights, snapshot.Height)
+	}
+	if !reflect.DeepEqual(heights, []int64{2, 4}) {
+		t.Fatalf("Snapshots are at heights %v, want [2 4]", heights)
+	}
+
+	parent, cleanupRestored := tempDir(t)
+	defer cleanupRestored()
+	restoredDir := filepath.Join(parent, "restored")
+	stored, err := RestoreDataDir(restoredDir, layout.Snapshots[1].Path, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Height != 4 || stored.Tickets != 4 {
+		t.Errorf("Restored height %v with %v tickets, want height 4 with 4", stored.Height, stored.Tickets)
+	}
+
+	restored := openApp(t, restoredDir)
+	defer restored.Close()
+	info := restored.Info(types.RequestInfo{})
+	if info.LastBlockHeight != 4 || !bytes.Equal(info.LastBlockAppHash, root) {
+		t.Errorf("Restored node is at height %v with root %x, want 4 with %x", info.LastBlockHeight, info.LastBlockAppHash, root)
+	}
+	if !reflect.DeepEqual(restored.state.tickets, app.state.tickets) {
+		t.Errorf("Restored tickets are %v, want %v", restored.state.tickets, app.state.tickets)
+	}
+	var proof TicketResponse
+	queryJSON(t, restored, "ticket", "1", 0, &proof)
+	if proof.Ticket.OwnerAddr != address(carolKey) {
+		t.Errorf("Restored ticket 1 is owned by %v, want %v", proof.Ticket.OwnerAddr, address(carolKey))
+	}
+	if valid, err := proof.verify(root, sha256.New); err != nil || !valid {
+		t.Errorf("Proof from the restored node does not verify: %v", err)
+	}
+}
+
+func TestRestoreDataDirRefusesToOverwrite(t *testing.T) {
+	dataDir, cleanup := tempDir(t)
+	defer cleanup()
+	app := openApp(t, dataDir, WithSnapshotInterval(1))
+	commitBlock(t, app, newTicket(1, aliceKey))
+	app.Close()
+	snapshot := snapshotFilePath(dataDir, 1)
+
+	tests := []struct {
+		name  string
+		force bool
+		fails bool
+	}{
+		{"without force", false, true},
+		{"with force", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, cleanup := tempDir(t)
+			defer cleanup()
+			other := openApp(t, target)
+			commitBlock(t, other, newTicket(2, bobKey))
+			other.Close()
+
+			_, err := RestoreDataDir(target, snapshot, test.force, nil)
+			if (err != nil) != test.fails {
+				t.Fatalf("RestoreDataDir returned %v, want failure %v", err, test.fails)
+			}
+			restored := openApp(t, target)
+			defer restored.Close()
+			_, hasFirst := restored.state.tickets[1]
+			if hasFirst == test.fails {
+				t.Errorf("Restored tickets are %v", restored.state.tickets)
+			}
+		})
+	}
+}
+
+func TestSnapshotsKeepMostRecent(t *testing.T) {
+	dataDir, cleanup := tempDir(t)
+	defer cleanup()
+	app := openApp(t, dataDir, WithSnapshotInterval(1))
+	defer app.Close()
+	for id := uint64(1); id <= 5; id++ {
+		commitBlock(t, app, newTicket(id, aliceKey))
+	}
+	heights, err := snapshotFileHeights(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(heights, []int64{4, 5}) {
+		t.Errorf("Snapshots are at heights %v, want [4 5]", heights)
+	}
+}
+
+func TestSnapshotIntervalWithoutDataDir(t *testing.T) {
+	app := NewTicketStoreApplication(WithSnapshotInterval(1))
+	commitBlock(t, app, newTicket(1, aliceKey))
+	if app.state.height != 1 {
+		t.Errorf("Height is %v, want 1", app.state.height)
+	}
+}
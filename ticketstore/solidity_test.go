@@ -0,0 +1,83 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// verifySolidityProof computes the root from proof as the on-chain verifier
+// does and reports whether it matches root
+func verifySolidityProof(t *testing.T, hashStrategy func() hash.Hash, leaf []byte, proof SolidityProof, root []byte) bool {
+	t.Helper()
+	path, err := hexutil.DecodeBig(proof.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := leaf
+	for i, siblingHex := range proof.Proof {
+		sibling := hexutil.MustDecode(siblingHex)
+		if len(sibling) != 32 {
+			t.Fatalf("Proof element %v is %v bytes, not a bytes32", i, len(sibling))
+		}
+		h := hashStrategy()
+		if path.Bit(i) == 1 {
+			h.Write(node)
+			h.Write(sibling)
+		} else {
+			h.Write(sibling)
+			h.Write(node)
+		}
+		node = h.Sum(nil)
+	}
+	// Bits past the proof would be ignored by the contract, so none may be set
+	if path.BitLen() > len(proof.Proof) {
+		t.Errorf("Path %v has bits past the %v proof elements", proof.Path, len(proof.Proof))
+	}
+	return bytes.Equal(node, root)
+}
+
+func TestSolidityProofQuery(t *testing.T) {
+	strategies := []struct {
+		name         string
+		hashStrategy func() hash.Hash
+	}{
+		{"sha256", sha256.New},
+		{"keccak256", Keccak256},
+	}
+	for _, strategy := range strategies {
+		for _, size := range []int{1, 2, 3, 5, 8} {
+			t.Run(fmt.Sprintf("%v with %v tickets", strategy.name, size), func(t *testing.T) {
+				app := NewTicketStoreApplication(WithHashStrategy(strategy.hashStrategy))
+				tickets := make([]TicketTx, size)
+				for i := range tickets {
+					tickets[i] = newTicket(uint64(i+1), aliceKey)
+				}
+				commitBlock(t, app, tickets...)
+				root := app.Info(types.RequestInfo{}).LastBlockAppHash
+
+				for _, ticket := range tickets {
+					var proof SolidityProof
+					queryJSON(t, app, "solidityProof", fmt.Sprint(ticket.Id), 0, &proof)
+					leaf, _ := ticket.CalculateHash()
+					if proof.Leaf != hexutil.Encode(leaf) || proof.Root != hexutil.Encode(root) {
+						t.Errorf("Ticket %v has leaf %v and root %v, want %x and %x", ticket.Id, proof.Leaf, proof.Root, leaf, root)
+					}
+					if !verifySolidityProof(t, strategy.hashStrategy, leaf, proof, root) {
+						t.Errorf("Proof %+v of ticket %v does not verify", proof, ticket.Id)
+					}
+
+					other, _ := newTicket(ticket.Id, bobKey).CalculateHash()
+					if verifySolidityProof(t, strategy.hashStrategy, other, proof, root) {
+						t.Errorf("Proof of ticket %v verifies another owner's leaf", ticket.Id)
+					}
+				}
+			})
+		}
+	}
+}
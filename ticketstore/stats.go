@@ -0,0 +1,46 @@
+package ticketstore
+
+// txStats counts the transactions accepted and, by response code, rejected
+type txStats struct {
+	Accepted int64            `json:"accepted"`
+	Rejected map[uint32]int64 `json:"rejected"`
+}
+
+// statsResponse is the stats query's result. DeliverTx counts are as of the
+// committed height and are the same on every node, while CheckTx counts are
+// this node's since it started
+type statsResponse struct {
+	DeliverTx txStats `json:"deliverTx"`
+	CheckTx   txStats `json:"checkTx"`
+	Height    int64   `json:"height"`
+}
+
+func (stats *txStats) record(code uint32) {
+	if code == codeTypeOK {
+		stats.Accepted++
+		return
+	}
+	if stats.Rejected == nil {
+		stats.Rejected = make(map[uint32]int64)
+	}
+	stats.Rejected[code]++
+}
+
+func (stats txStats) copy() txStats {
+	copied := txStats{Accepted: stats.Accepted, Rejected: make(map[uint32]int64, len(stats.Rejected))}
+	for code, count := range stats.Rejected {
+		copied.Rejected[code] = count
+	}
+	return copied
+}
+
+// stats reports the transaction counters. The caller must hold the read lock
+func (app *TicketStoreApplication) stats() statsResponse {
+	app.statsMtx.Lock()
+	defer app.statsMtx.Unlock()
+
+	return statsResponse{
+		DeliverTx: app.state.committedStats.copy(),
+		CheckTx:   app.checkStats.copy(),
+		Height:    app.state.height}
+}
@@ -0,0 +1,84 @@
+package ticketstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestStatsQuery(t *testing.T) {
+	dataDir, cleanup := tempDir(t)
+	defer cleanup()
+	app := openApp(t, dataDir)
+	issued := newTicket(1, aliceKey)
+	tooLong := newTicket(3, aliceKey)
+	tooLong.Details = strings.Repeat("x", defaultMaxDetailsBytes+1)
+
+	txs := []struct {
+		name string
+		tx   []byte
+		code uint32
+	}{
+		{"issued", encodeTx(t, issued), codeTypeOK},
+		{"bundle", encodeTx(t, newTicket(2, bobKey), newTicket(4, carolKey)), codeTypeOK},
+		{"resold", encodeTx(t, resell(t, issued, aliceKey, address(bobKey))), codeTypeOK},
+		{"malformed", []byte("{"), codeTypeEncodingError},
+		{"details too long", encodeTx(t, tooLong), codeTypeDetailsError},
+		{"stale nonce", encodeTx(t, issued), codeTypeTicketError},
+		{"unsigned resale", encodeTx(t, TicketTx{Id: 2, Nonce: 2, OwnerAddr: address(aliceKey)}), codeTypeTicketError},
+	}
+	for _, tx := range txs {
+		if response := app.DeliverTx(types.RequestDeliverTx{Tx: tx.tx}); response.Code != tx.code {
+			t.Fatalf("DeliverTx of %v returned code %v (%v), want %v", tx.name, response.Code, response.Log, tx.code)
+		}
+	}
+	want := txStats{Accepted: 3, Rejected: map[uint32]int64{codeTypeEncodingError: 1, codeTypeDetailsError: 1, codeTypeTicketError: 2}}
+
+	// queryStats decodes into new counts each time, as decoding into a map
+	// would merge with what it already holds
+	var stats statsResponse
+	queryStats := func(app *TicketStoreApplication) {
+		stats = statsResponse{}
+		queryJSON(t, app, "stats", "", 0, &stats)
+	}
+
+	// Counts only change with the committed height, like the rest of state
+	queryStats(app)
+	if stats.DeliverTx.Accepted != 0 || len(stats.DeliverTx.Rejected) != 0 || stats.Height != 0 {
+		t.Errorf("Stats before Commit are %+v at height %v, want none at 0", stats.DeliverTx, stats.Height)
+	}
+	app.Commit()
+	queryStats(app)
+	if !reflect.DeepEqual(stats.DeliverTx, want) || stats.Height != 1 {
+		t.Errorf("Stats are %+v at height %v, want %+v at 1", stats.DeliverTx, stats.Height, want)
+	}
+
+	// CheckTx is counted separately and changes nothing DeliverTx counted
+	checkTx(t, app, newTicket(5, aliceKey))
+	app.CheckTx(types.RequestCheckTx{Tx: []byte("{")})
+	checkTx(t, app, issued)
+	queryStats(app)
+	wantCheck := txStats{Accepted: 1, Rejected: map[uint32]int64{codeTypeEncodingError: 1, codeTypeTicketError: 1}}
+	if !reflect.DeepEqual(stats.CheckTx, wantCheck) || !reflect.DeepEqual(stats.DeliverTx, want) {
+		t.Errorf("Stats after CheckTx are %+v and %+v, want CheckTx %+v and DeliverTx %+v", stats.CheckTx, stats.DeliverTx, wantCheck, want)
+	}
+
+	// DeliverTx counts survive a restart, while CheckTx's are this node's
+	// since it started
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openApp(t, dataDir)
+	queryStats(reopened)
+	if !reflect.DeepEqual(stats.DeliverTx, want) || stats.CheckTx.Accepted != 0 || len(stats.CheckTx.Rejected) != 0 {
+		t.Errorf("Stats after restart are %+v and %+v, want DeliverTx %+v and no CheckTx", stats.DeliverTx, stats.CheckTx, want)
+	}
+	deliver(t, reopened, issued)
+	reopened.Commit()
+	queryStats(reopened)
+	if want.Rejected[codeTypeTicketError]++; !reflect.DeepEqual(stats.DeliverTx, want) {
+		t.Errorf("Stats after restart and another block are %+v, want %+v", stats.DeliverTx, want)
+	}
+}
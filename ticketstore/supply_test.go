@@ -0,0 +1,51 @@
+package ticketstore
+
+import "testing"
+
+func TestMaxTickets(t *testing.T) {
+	issued := []TicketTx{newTicket(1, aliceKey), newTicket(2, aliceKey)}
+	resold := resell(t, issued[0], aliceKey, address(bobKey))
+
+	tests := []struct {
+		name    string
+		max     int
+		tickets []TicketTx
+		code    uint32
+		stored  int
+	}{
+		{"unlimited", 0, []TicketTx{newTicket(3, aliceKey)}, codeTypeOK, 3},
+		{"below the cap", 3, []TicketTx{newTicket(3, aliceKey)}, codeTypeOK, 3},
+		{"at the cap", 2, []TicketTx{newTicket(3, aliceKey)}, codeTypeSupplyExhausted, 2},
+		{"resale at the cap", 2, []TicketTx{resold}, codeTypeOK, 2},
+		{"burn at the cap", 2, []TicketTx{resell(t, issued[1], aliceKey, burnAddress)}, codeTypeOK, 2},
+		{"bundle crossing the cap", 3, []TicketTx{newTicket(3, aliceKey), newTicket(4, aliceKey)}, codeTypeSupplyExhausted, 2},
+		{"bundle of a resale and a creation", 3, []TicketTx{resold, newTicket(3, aliceKey)}, codeTypeOK, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithMaxTickets(test.max))
+			commitBlock(t, app, issued...)
+
+			if response := checkTx(t, app, test.tickets...); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if response := deliver(t, app, test.tickets...); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			app.Commit()
+			if len(app.state.tickets) != test.stored {
+				t.Errorf("%v tickets stored, want %v", len(app.state.tickets), test.stored)
+			}
+		})
+	}
+}
+
+func TestBurnedTicketsCountTowardsTheCap(t *testing.T) {
+	app := NewTicketStoreApplication(WithMaxTickets(1))
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued)
+	commitBlock(t, app, resell(t, issued, aliceKey, burnAddress))
+	if response := deliver(t, app, newTicket(2, aliceKey)); response.Code != codeTypeSupplyExhausted {
+		t.Errorf("DeliverTx after a burn returned code %v (%v), want %v", response.Code, response.Log, codeTypeSupplyExhausted)
+	}
+}
@@ -0,0 +1,45 @@
+package ticketstore
+
+import "time"
+
+// defaultCatchUpWindow is how close to the node's clock a committed block's
+// time must be for the application to consider itself caught up
+const defaultCatchUpWindow = 30 * time.Second
+
+// SyncingResponse is the syncing query's result. Syncing is set from start up
+// until a block is committed whose time is within the catch up window of the
+// node's clock, so results queried while it is set may be behind the chain
+type SyncingResponse struct {
+	Syncing   bool      `json:"syncing"`
+	Height    int64     `json:"height"`
+	BlockTime time.Time `json:"blockTime"`
+}
+
+// WithCatchUpWindow sets how recent a committed block must be, by the node's
+// clock, for the application to stop reporting itself as syncing. It
+// defaults to 30 seconds
+func WithCatchUpWindow(window time.Duration) Option {
+	return func(app *TicketStoreApplication) {
+		app.catchUpWindow = window
+	}
+}
+
+// checkCaughtUp clears the syncing flag once the block just committed is
+// recent. It only informs queries and never affects state, so reading the
+// node's clock here does not break determinism. The caller must hold the lock
+func (app *TicketStoreApplication) checkCaughtUp() {
+	if app.caughtUp || app.state.block.Time.IsZero() {
+		return
+	}
+	if time.Since(app.state.block.Time) <= app.catchUpWindow {
+		app.caughtUp = true
+		app.logger.Info("Caught up", "height", app.state.height)
+	}
+}
+
+func (app *TicketStoreApplication) syncing() SyncingResponse {
+	return SyncingResponse{
+		Syncing:   !app.caughtUp,
+		Height:    app.state.height,
+		BlockTime: app.state.block.Time}
+}
@@ -0,0 +1,49 @@
+package ticketstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestSyncingQuery(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		window time.Duration
+		blocks []time.Time
+		want   bool
+	}{
+		{"before any block", 0, nil, true},
+		{"replaying old blocks", 0, []time.Time{now.Add(-time.Hour), now.Add(-time.Minute)}, true},
+		{"block without a time", 0, []time.Time{{}}, true},
+		{"caught up with a recent block", 0, []time.Time{now.Add(-time.Hour), now}, false},
+		{"stays caught up after a late block", 0, []time.Time{now, now.Add(-time.Hour)}, false},
+		{"recent block outside a shorter window", time.Millisecond, []time.Time{now.Add(-time.Second)}, true},
+		{"old block inside a longer window", 2 * time.Hour, []time.Time{now.Add(-time.Hour)}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opts []Option
+			if test.window > 0 {
+				opts = append(opts, WithCatchUpWindow(test.window))
+			}
+			app := NewTicketStoreApplication(opts...)
+			for i, blockTime := range test.blocks {
+				app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: int64(i + 1), Time: blockTime}})
+				app.Commit()
+			}
+
+			var response SyncingResponse
+			queryJSON(t, app, "syncing", "", 0, &response)
+			want := SyncingResponse{Syncing: test.want, Height: int64(len(test.blocks))}
+			if len(test.blocks) > 0 {
+				want.BlockTime = test.blocks[len(test.blocks)-1]
+			}
+			if response.Syncing != want.Syncing || response.Height != want.Height || !response.BlockTime.Equal(want.BlockTime) {
+				t.Errorf("syncing query returned %+v, want %+v", response, want)
+			}
+		})
+	}
+}
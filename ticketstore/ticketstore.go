@@ -1,258 +1,1821 @@
 package ticketstore
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"os"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
-	"github.com/cbergoon/merkletree"
+	"github.com/ArtosSystems/tendermint-exp/codes"
+	"github.com/ArtosSystems/tendermint-exp/metrics"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/crypto"
 	sha3 "github.com/miguelmota/go-solidity-sha3"
 	"github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/libs/log"
 )
 
+// Response codes, as exported by the codes package. Query failures use
+// codeTypeEncodingError for query data that cannot be parsed,
+// codeTypeNotFound for missing tickets and codeTypeUnknownPath for an
+// unsupported path and codeTypeHeightUnavailable for a height whose state is
+// not retained
 const (
-	codeTypeOK            uint32 = 0
-	codeTypeEncodingError uint32 = 1
-	codeTypeTicketError   uint32 = 2
+	codeTypeOK                = codes.OK
+	codeTypeEncodingError     = codes.EncodingError
+	codeTypeTicketError       = codes.TicketError
+	codeTypeNotFound          = codes.NotFound
+	codeTypeDetailsError      = codes.DetailsError
+	codeTypeUnknownPath       = codes.UnknownPath
+	codeTypeHeightUnavailable = codes.HeightUnavailable
+	codeTypeRateLimited       = codes.RateLimited
+	codeTypeDuplicate         = codes.Duplicate
+	codeTypeSupplyExhausted   = codes.SupplyExhausted
+	codeTypeInternalError     = codes.InternalError
+	codeTypeUnauthorized      = codes.Unauthorized
+	codeTypeUnhealthy         = codes.Unhealthy
+	codeTypeCancelled         = codes.Cancelled
+	codeTypeNoTickets         = codes.NoTickets
+	codeTypeExpired           = codes.Expired
+	codeTypeSelfTransfer      = codes.SelfTransfer
+)
+
+// Version is the version of the ticket store reported by Info
+const Version = "0.1.0"
+
+// The ABCI and Tendermint versions the ticket store is built against, as
+// pinned in Gopkg.toml
+const (
+	abciVersion       = "0.16.1"
+	tendermintVersion = "0.32.2"
+)
+
+const (
+	defaultMaxDetailsBytes = 1024
+	defaultMaxBatchSize    = 100
+	defaultTxGas           = 1000
+	defaultGasPerByte      = 10
+	defaultQueryTimeout    = 10 * time.Second
 )
 
 var (
-	ErrBadAddress     = &ticketError{"Ticket must have an address"}
-	ErrBadNonce       = &ticketError{"Ticket nonce must increase on resale"}
-	ErrBadSignature   = &ticketError{"Resale must be signed by the previous owner"}
-	ErrTicketNotFound = &ticketError{"Ticket could not be found"}
+	ErrBadId              = &ticketError{"Ticket id must not be zero"}
+	ErrBadAddress         = &ticketError{"Ticket owner must be a 0x prefixed 20 byte hex address, EIP-55 checksummed if mixed case"}
+	ErrBadNonce           = &ticketError{"Ticket nonce must increase on resale"}
+	ErrBadSignature       = &ticketError{"Resale must be signed by the previous owner"}
+	ErrTicketNotFound     = &ticketError{"Ticket could not be found"}
+	ErrBadRecoveryId      = &ticketError{"Signature recovery id must be 27 or 28, or EIP-155 encoded when a chain id is set"}
+	ErrTicketBurned       = &ticketError{"Ticket has been burned"}
+	ErrBadDetails         = &ticketError{"Ticket details must be valid UTF-8 within the maximum length"}
+	ErrHeightUnavailable  = &ticketError{"State at the requested height is not available"}
+	ErrBadProofScheme     = &ticketError{"Ownership proof scheme must be empty, personal_sign or eip712"}
+	ErrRateLimited        = &ticketError{"Ticket has reached its transfer limit for this block"}
+	ErrDuplicateTicket    = &ticketError{"Ticket is identical to the stored version"}
+	ErrBatchTooLarge      = &ticketError{"Too many ticket ids requested at once"}
+	ErrSupplyExhausted    = &ticketError{"No more tickets can be issued"}
+	ErrUnauthorizedIssuer = &ticketError{"New tickets must be signed by an authorized issuer"}
+	ErrNoTickets          = &ticketError{"No tickets have been committed yet"}
+	ErrBadProofEncoding   = &ticketError{"Ownership proof must be empty or 0x prefixed hex"}
+	ErrExpired            = &ticketError{"Ticket transfer is past its deadline"}
+	ErrSelfTransfer       = &ticketError{"Ticket is already held by the new owner"}
+	ErrBadChainId         = &ticketError{"Chain id is too large for its EIP-155 recovery id to fit in 64 bits"}
+	ErrProofNotStored     = &ticketError{"Ticket was stored without its ownership proof, so it cannot be resold under the eip712 scheme"}
 )
 
+// burnAddress is the reserved owner a ticket is transferred to in order to
+// retire it. Burned tickets can never change again
+const burnAddress = "0x0000000000000000000000000000000000000000"
+
 type ticketError struct{ msg string }
 
 func (err ticketError) Error() string { return err.msg }
 
 type TicketStoreApplication struct {
 	types.BaseApplication
+
+	// mtx guards state. Tendermint calls CheckTx and Query from the mempool
+	// and query connections while DeliverTx and Commit run on consensus
+	mtx   sync.RWMutex
 	state state
+
+	rules validationRules
+
+	// snapshotInterval is how many heights apart snapshots are written to
+	// the data directory. Zero disables them
+	snapshotInterval int64
+
+	// maxTransfersPerBlock caps how often one ticket may change within a
+	// block. Zero means no limit
+	maxTransfersPerBlock int
+
+	// maxTickets caps how many ticket ids can ever be issued. Zero means no
+	// limit
+	maxTickets int
+
+	// validators derives validator power from ticket holdings. Nil leaves
+	// the validator set alone
+	validators *validatorHoldings
+
+	// lazySignatures leaves signature checks to DeliverTx
+	lazySignatures bool
+
+	// checkCache remembers CheckTx results until the next Commit. Nil
+	// caches nothing
+	checkCache *checkCache
+
+	// debugQueries enables the tree query
+	debugQueries bool
+
+	// caughtUp is set by the first Commit of a block within catchUpWindow
+	// of the node's clock
+	catchUpWindow time.Duration
+	caughtUp      bool
+
+	// maxHistory caps how many transfers each ticket's history keeps. Zero
+	// means no limit
+	maxHistory int
+
+	// dropProofs stores each ticket's leaf in place of its PrevOwnerProof
+	dropProofs bool
+
+	// maxBatchSize caps how many ids one tickets query may ask for. Zero
+	// means no limit
+	maxBatchSize int
+
+	// retainHeights is how many of the latest heights history keeps state
+	// for. Zero keeps every height
+	retainHeights int64
+
+	// txGas and gasPerByte price a tx as txGas plus gasPerByte for each
+	// byte of its details
+	txGas      int64
+	gasPerByte int64
+
+	metrics metrics.Recorder
+	logger  log.Logger
+
+	// audit records rejected txs. Nil records nothing
+	audit *auditSink
+
+	// checkStats counts CheckTx results. CheckTx only holds the read lock, so
+	// statsMtx guards it instead
+	statsMtx   sync.Mutex
+	checkStats txStats
+
+	// dataDir is where Close flushes the committed state. Empty keeps the
+	// state in memory only
+	dataDir string
+	closed  bool
+
+	// flushInterval is how many commits apart the state is flushed, with a
+	// write-ahead log covering the commits in between. Zero only flushes on
+	// Close
+	flushInterval int64
+	wal           *os.File
+
+	// ctx is cancelled by Close so that queries still running stop early.
+	// Each query also gets a context of its own from it, which queryTimeout
+	// bounds so that one slow query cannot hold up the next Commit
+	ctx          context.Context
+	cancel       context.CancelFunc
+	queryTimeout time.Duration
+}
+
+// validationRules are the configurable parts of ticket validation
+type validationRules struct {
+	// chainId is the EIP-155 chain id resale and issuer signatures may be
+	// bound to. Zero only accepts legacy signatures
+	chainId uint64
+	// maxDetailsBytes bounds the length of Details. Zero disables the limit
+	maxDetailsBytes int
+	// strictNonces requires a newly created ticket to start at nonce 1
+	strictNonces bool
+	// issuers holds the lower case addresses allowed to create tickets. Empty
+	// lets anyone create them
+	issuers map[string]bool
+	// skipSignatures leaves out recovering the signer of resale and issuer
+	// proofs
+	skipSignatures bool
+	// checksumAddresses requires owner addresses in EIP-55 checksum form
+	checksumAddresses bool
+	// noSelfTransfers rejects a resale to the ticket's current owner
+	noSelfTransfers bool
+}
+
+// Option configures a TicketStoreApplication at construction
+type Option func(*TicketStoreApplication)
+
+// WithMetrics reports delivered and rejected transactions and commits to recorder
+func WithMetrics(recorder metrics.Recorder) Option {
+	return func(app *TicketStoreApplication) {
+		app.metrics = recorder
+	}
+}
+
+// WithLogger logs accepted and rejected transactions and commits to logger.
+// Nothing is logged by default
+func WithLogger(logger log.Logger) Option {
+	return func(app *TicketStoreApplication) {
+		app.logger = logger
+	}
+}
+
+// WithQueryTimeout stops a tickets, dump or owner query that runs for longer
+// than timeout with codeTypeCancelled, 10 seconds by default. Zero disables
+// the limit
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(app *TicketStoreApplication) {
+		app.queryTimeout = timeout
+	}
+}
+
+// WithChainId accepts resale and issuer signatures with an EIP-155 recovery
+// id for chainId as well as legacy 27/28. A chain id above MaxChainId has no
+// EIP-155 recovery id, so only legacy signatures are accepted with it
+func WithChainId(chainId uint64) Option {
+	return func(app *TicketStoreApplication) {
+		app.rules.chainId = chainId
+	}
+}
+
+// WithMaxTransfersPerBlock rejects changes to a ticket once it has changed max
+// times in the current block
+func WithMaxTransfersPerBlock(max int) Option {
+	return func(app *TicketStoreApplication) {
+		app.maxTransfersPerBlock = max
+	}
+}
+
+// WithMaxTickets rejects the creation of a new ticket once max ids have been
+// issued. Burned tickets still count towards the cap and resales are never
+// limited
+func WithMaxTickets(max int) Option {
+	return func(app *TicketStoreApplication) {
+		app.maxTickets = max
+	}
+}
+
+// WithMaxHistory keeps only the latest max transfers in each ticket's
+// history. By default the whole history is kept
+func WithMaxHistory(max int) Option {
+	return func(app *TicketStoreApplication) {
+		app.maxHistory = max
+	}
+}
+
+// WithRetainHeights keeps the state of only the latest heights heights for
+// height-pinned queries and proofs, pruning older heights from memory as
+// blocks are committed. Queries for a pruned height fail with
+// codeTypeHeightUnavailable. By default every height is kept
+func WithRetainHeights(heights int64) Option {
+	return func(app *TicketStoreApplication) {
+		app.retainHeights = heights
+	}
+}
+
+// WithMaxBatchSize caps the ids a single tickets query may request, 100 by
+// default. Zero disables the limit
+func WithMaxBatchSize(max int) Option {
+	return func(app *TicketStoreApplication) {
+		app.maxBatchSize = max
+	}
+}
+
+// WithGas prices every tx at txGas plus gasPerByte for each byte of its
+// details, 1000 and 10 by default
+func WithGas(txGas int64, gasPerByte int64) Option {
+	return func(app *TicketStoreApplication) {
+		app.txGas = txGas
+		app.gasPerByte = gasPerByte
+	}
+}
+
+// WithMaxDetailsBytes bounds ticket Details to max bytes, 1024 by default.
+// Zero disables the limit
+func WithMaxDetailsBytes(max int) Option {
+	return func(app *TicketStoreApplication) {
+		app.rules.maxDetailsBytes = max
+	}
+}
+
+// WithStrictNonces rejects a ticket created with any nonce other than 1, so
+// every ticket's nonce sequence starts from the same place. By default any
+// nonce, including zero, may create a ticket. Genesis tickets are exempt, so
+// a dump of resold tickets can be imported
+func WithStrictNonces() Option {
+	return func(app *TicketStoreApplication) {
+		app.rules.strictNonces = true
+	}
+}
+
+// WithIssuers only accepts a new ticket whose PrevOwnerProof is a signature by
+// one of issuers over the ticket with an empty proof, as SignTicketIssue
+// produces. Resales are unaffected. By default anyone may create tickets
+func WithIssuers(issuers ...string) Option {
+	return func(app *TicketStoreApplication) {
+		app.rules.issuers = make(map[string]bool, len(issuers))
+		for _, issuer := range issuers {
+			app.rules.issuers[strings.ToLower(issuer)] = true
+		}
+	}
+}
+
+// WithChecksummedAddresses only accepts owner addresses in EIP-55 checksum
+// form. By default lower and upper case addresses are accepted too. Genesis
+// tickets are exempt, so a dump can be imported
+func WithChecksummedAddresses() Option {
+	return func(app *TicketStoreApplication) {
+		app.rules.checksumAddresses = true
+	}
+}
+
+// WithoutSelfTransfers rejects a resale whose owner is the ticket's current
+// owner with ErrSelfTransfer, since it would change the tree and history
+// without changing hands. This includes an owner only editing Details. By
+// default such a resale is accepted like any other
+func WithoutSelfTransfers() Option {
+	return func(app *TicketStoreApplication) {
+		app.rules.noSelfTransfers = true
+	}
+}
+
+// WithLazySignatures checks resale and issuer signatures in DeliverTx only,
+// sparing CheckTx the cost of recovering them. The mempool then admits txs
+// with bad signatures, which take up space in a block before being rejected
+func WithLazySignatures() Option {
+	return func(app *TicketStoreApplication) {
+		app.lazySignatures = true
+	}
+}
+
+// WithoutStoredProofs stores each ticket's 32 byte leaf in place of its
+// verified PrevOwnerProof, which shrinks the state by the size of every proof
+// less the leaf. The leaf is all CalculateHash needs, so roots and Merkle
+// proofs are unchanged and nodes may differ in this setting. The proof itself
+// is then no longer returned, and a resale signed with the eip712 scheme,
+// which hashes the previous proof on its own, is rejected with
+// ErrProofNotStored
+func WithoutStoredProofs() Option {
+	return func(app *TicketStoreApplication) {
+		app.dropProofs = true
+	}
 }
 
 type state struct {
-	size            int64
-	height          int64
-	rootHash        []byte
-	tickets         map[uint64]ticket
-	history         map[int64]snapshot
-	tempTreeContent []merkletree.Content
+	size     int64
+	height   int64
+	rootHash []byte
+	tree     *merkleTree
+	tickets  map[uint64]Ticket
+	owners   ownerIndex
+	history  map[int64]snapshot
+	// tempTreeContent lists the tickets changed in the current block in
+	// delivery order. It only tells Commit what changed, as the tree's leaves
+	// are always every live ticket ordered by id
+	tempTreeContent []TicketTx
+	// blockTransfers counts the changes to each ticket in the current block
+	blockTransfers map[uint64]int
+	// hashStrategy hashes the tree's parent nodes
+	hashStrategy func() hash.Hash
+
+	// deliverStats counts DeliverTx results including the current block and
+	// committedStats as of the last Commit
+	deliverStats   txStats
+	committedStats txStats
+
+	// retainedFrom is the lowest height history can answer for. It is above
+	// zero when the state was restored from a snapshot or history has been
+	// pruned
+	retainedFrom int64
+
+	// block is the header of the block being processed, or the last one
+	// committed between blocks
+	block blockInfo
+}
+
+type blockInfo struct {
+	Height   int64     `json:"height"`
+	Time     time.Time `json:"time"`
+	Proposer string    `json:"proposer"`
 }
 
+// TicketTx is a ticket as submitted and stored. PrevOwnerProof is kept in
+// state after it has been verified since it is part of CalculateHash, which is
+// both the Merkle leaf a contract checks and the hash the next owner signs to
+// resell the ticket. Keeping only its hash would change every ticket's hash.
+// WithoutStoredProofs keeps the leaf in its place instead
 type TicketTx struct {
 	Id             uint64 `json:"id"`
 	Nonce          uint64 `json:"nonce"`
 	Details        string `json:"details"`
 	OwnerAddr      string `json:"ownerAddr"`
 	PrevOwnerProof string `json:"prevOwnerProof"`
+	// ProofScheme names how PrevOwnerProof was produced. Empty means a
+	// signature over the previous ticket's CalculateHash
+	ProofScheme string `json:"proofScheme,omitempty"`
+	// ValidUntil is the unix time after which the tx is rejected, compared
+	// with the block time. Zero never expires. It is not part of
+	// CalculateHash, so it does not change the ticket's leaf
+	ValidUntil int64 `json:"validUntil,omitempty"`
+
+	// leaf is the hex CalculateHash of a stored ticket whose PrevOwnerProof
+	// was dropped, returned by CalculateHash in its place
+	leaf string
 }
 
-type ticketResponse struct {
-	Ticket      ticket   `json:"ticket"`
+// TicketResponse is the result of the ticket query: the ticket and its
+// Merkle proof against the root at the queried height. Tickets change, so a
+// proof only holds against the root it was built for. Height and RootHash
+// name that root, and verifiers must check the proof against the root at
+// Height rather than whichever root is latest. The leaf itself is left free
+// of the height, since it is also the hash resales sign
+type TicketResponse struct {
+	Ticket      Ticket   `json:"ticket"`
 	MerkleProof []string `json:"merkleProof"`
 	Index       []int64  `json:"index"`
+	Height      int64    `json:"height"`
+	RootHash    string   `json:"rootHash"`
+}
+
+// infoResponse is the Data returned by Info
+type infoResponse struct {
+	Height int64 `json:"height"`
+	// Txs counts every ticket issued, resold or burned
+	Txs      int64  `json:"txs"`
+	RootHash string `json:"rootHash"`
+	Version  string `json:"version"`
+}
+
+// simulateResponse is the outcome a tx would have if delivered on top of the
+// last committed block
+type simulateResponse struct {
+	Code uint32 `json:"code"`
+	Log  string `json:"log,omitempty"`
+	Gas  int64  `json:"gas"`
+}
+
+// page selects part of an ordered result set. A zero Limit returns
+// everything from Offset onwards
+type page struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// dumpResponse is a page of the live tickets at a height, in the form
+// InitChain accepts as genesis tickets, with the root they produce
+type dumpResponse struct {
+	Tickets  []TicketTx `json:"tickets"`
+	Total    int        `json:"total"`
+	RootHash string     `json:"rootHash"`
+	Height   int64      `json:"height"`
+}
+
+// isOwnerQuery asks whether Address currently owns ticket Id
+type isOwnerQuery struct {
+	Id      uint64 `json:"id"`
+	Address string `json:"address"`
+}
+
+// isOwnerResponse answers an isOwnerQuery without a Merkle proof
+type isOwnerResponse struct {
+	Owner  bool   `json:"owner"`
+	Nonce  uint64 `json:"nonce"`
+	Height int64  `json:"height"`
+}
+
+type ownerQuery struct {
+	Owner string `json:"owner"`
+	page
+}
+
+type verifyResponse struct {
+	Valid    bool   `json:"valid"`
+	RootHash string `json:"rootHash"`
+	Height   int64  `json:"height"`
+}
+
+// versionResponse is the version query's result: the app version, the ABCI
+// and Tendermint versions it was built against and the committed height
+type versionResponse struct {
+	Version    string `json:"version"`
+	ABCI       string `json:"abci"`
+	Tendermint string `json:"tendermint"`
+	Height     int64  `json:"height"`
+}
+
+// healthResponse is the health query's result, counting the live tickets
+// and transactions as of the committed height
+type healthResponse struct {
+	Height  int64 `json:"height"`
+	Tickets int   `json:"tickets"`
+	Txs     int64 `json:"txs"`
 }
 
-type ticket struct {
+// rootResponse is the committed root hash and the height it was committed at
+type rootResponse struct {
+	RootHash string `json:"rootHash"`
+	Height   int64  `json:"height"`
+}
+
+// Ticket is the stored version of a ticket, the heights it changed at and
+// who owned it before its last change. PrevOwnerAddr is empty for a ticket
+// that has never been resold. History lists every change to the ticket,
+// oldest first, up to the configured maximum. Leaf is set in place of
+// PrevOwnerProof when the ticket was stored without its proof
+type Ticket struct {
 	TicketTx      `json:"ticketTx"`
-	ChangeHeights []int64 `json:"changeHeights"`
+	ChangeHeights []int64    `json:"changeHeights"`
+	PrevOwnerAddr string     `json:"prevOwnerAddr"`
+	History       []Transfer `json:"history,omitempty"`
+	Leaf          string     `json:"leaf,omitempty"`
+}
+
+// UnmarshalJSON decodes a ticket, carrying Leaf into the TicketTx so that
+// its CalculateHash is still the ticket's leaf
+func (ticket *Ticket) UnmarshalJSON(data []byte) error {
+	type plainTicket Ticket
+	if err := json.Unmarshal(data, (*plainTicket)(ticket)); err != nil {
+		return err
+	}
+	if ticket.Leaf == "" {
+		return nil
+	}
+	if ticket.PrevOwnerProof != "" {
+		return fmt.Errorf("Ticket %v has both a prevOwnerProof and a leaf", ticket.Id)
+	}
+	if leaf, err := hexutil.Decode(ticket.Leaf); err != nil || len(leaf) != 32 {
+		return fmt.Errorf("Ticket %v has an invalid leaf %v", ticket.Id, ticket.Leaf)
+	}
+	ticket.TicketTx.leaf = ticket.Leaf
+	return nil
+}
+
+// withoutProof returns the ticket with its PrevOwnerProof replaced by its
+// leaf, which hashes the same
+func (ticket Ticket) withoutProof() Ticket {
+	if ticket.PrevOwnerProof == "" {
+		return ticket
+	}
+	leaf, _ := ticket.CalculateHash()
+	ticket.Leaf = hexutil.Encode(leaf)
+	ticket.TicketTx.leaf = ticket.Leaf
+	ticket.PrevOwnerProof = ""
+	return ticket
+}
+
+// Transfer is a change to a ticket: the owner and nonce it left the ticket
+// with and the height it was made at
+type Transfer struct {
+	Owner  string `json:"owner"`
+	Nonce  uint64 `json:"nonce"`
+	Height int64  `json:"height"`
+}
+
+// appendHistory returns history followed by transfer, dropping the oldest
+// transfers beyond max unless max is zero. history is never modified, since
+// earlier snapshots may share it
+func appendHistory(history []Transfer, transfer Transfer, max int) []Transfer {
+	appended := make([]Transfer, 0, len(history)+1)
+	appended = append(append(appended, history...), transfer)
+	if max > 0 && len(appended) > max {
+		appended = appended[len(appended)-max:]
+	}
+	return appended
 }
 
 type snapshot struct {
-	tickets map[uint64]ticket
-	tree    merkletree.MerkleTree
+	tickets ticketMap
+	owners  ownerMap
+	tree    *merkleTree
+	size    int64
 }
 
-func NewTicketStoreApplication() *TicketStoreApplication {
-	return &TicketStoreApplication{state: state{tickets: make(map[uint64]ticket), history: make(map[int64]snapshot)}}
+func NewTicketStoreApplication(opts ...Option) *TicketStoreApplication {
+	app := &TicketStoreApplication{
+		state: state{
+			tickets:      make(map[uint64]Ticket),
+			owners:       make(ownerIndex),
+			history:      make(map[int64]snapshot),
+			hashStrategy: sha256.New},
+		rules:         validationRules{maxDetailsBytes: defaultMaxDetailsBytes},
+		maxBatchSize:  defaultMaxBatchSize,
+		queryTimeout:  defaultQueryTimeout,
+		catchUpWindow: defaultCatchUpWindow,
+		txGas:         defaultTxGas,
+		gasPerByte:    defaultGasPerByte,
+		metrics:       metrics.Nop(),
+		logger:        log.NewNopLogger()}
+	app.ctx, app.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(app)
+	}
+	return app
 }
 
 func (app *TicketStoreApplication) Info(req types.RequestInfo) types.ResponseInfo {
+	app.mtx.RLock()
+	defer app.mtx.RUnlock()
+
+	data, _ := json.Marshal(infoResponse{
+		Height:   app.state.height,
+		Txs:      app.state.size,
+		RootHash: hexutil.Encode(app.state.appHash()),
+		Version:  Version})
 	return types.ResponseInfo{
-		Data:             fmt.Sprintf("{\"hashes\":%v,\"tickets\":%v}", app.state.height, app.state.size),
+		Data:             string(data),
+		Version:          Version,
 		LastBlockHeight:  app.state.height,
-		LastBlockAppHash: app.state.rootHash}
+		LastBlockAppHash: app.state.appHash()}
+}
+
+// InitChain issues the tickets listed in the genesis app state, a JSON array
+// of tickets, and builds the tree they start the chain with
+func (app *TicketStoreApplication) InitChain(req types.RequestInitChain) types.ResponseInitChain {
+	app.mtx.Lock()
+	defer app.mtx.Unlock()
+
+	if len(req.AppStateBytes) == 0 {
+		return types.ResponseInitChain{}
+	}
+
+	var genesisTickets []TicketTx
+	if err := json.Unmarshal(req.AppStateBytes, &genesisTickets); err != nil {
+		panic(fmt.Sprintf("Invalid genesis tickets: %v", err))
+	}
+
+	// Genesis is trusted, so its tickets need no issuer signature. It may also
+	// be a dump of another chain, whose tickets passed these checks when they
+	// were delivered but are stored with lower case owners and later nonces
+	genesisRules := app.rules
+	genesisRules.issuers = nil
+	genesisRules.strictNonces = false
+	genesisRules.checksumAddresses = false
+
+	// Tendermint sends InitChain again whenever the app reports height zero,
+	// so genesis persisted before the node stopped is replaced, not added to
+	app.state.size = 0
+	app.state.tickets = make(map[uint64]Ticket)
+	app.state.owners = make(ownerIndex)
+	app.state.history = make(map[int64]snapshot)
+	for _, ticketTx := range genesisTickets {
+		if _, exists := app.state.tickets[ticketTx.Id]; exists {
+			panic(fmt.Sprintf("Genesis ticket %v is issued more than once", ticketTx.Id))
+		}
+		if err := ticketTx.validate(TicketTx{}, genesisRules); err != nil {
+			panic(fmt.Sprintf("Invalid genesis ticket %v: %v", ticketTx.Id, err))
+		}
+		ticketTx.OwnerAddr = strings.ToLower(ticketTx.OwnerAddr)
+
+		app.state.size++
+		ticket := Ticket{
+			TicketTx:      ticketTx,
+			ChangeHeights: []int64{app.state.height},
+			History:       []Transfer{{ticketTx.OwnerAddr, ticketTx.Nonce, app.state.height}}}
+		if app.dropProofs {
+			ticket = ticket.withoutProof()
+		}
+		app.state.tickets[ticketTx.Id] = ticket
+		app.state.owners.move(ticketTx.Id, "", ticketTx.OwnerAddr)
+	}
+
+	if err := app.state.buildTree(); err != nil {
+		panic(err)
+	}
+
+	// Commits between flushes only log what they change, so genesis has to be
+	// written now or a crash before the first flush loses it
+	if app.dataDir != "" && app.flushInterval > 0 {
+		if err := app.flush(); err != nil {
+			panic(err)
+		}
+	}
+	return types.ResponseInitChain{}
+}
+
+// BeginBlock records the block header so block time is available to the
+// transactions in the block
+func (app *TicketStoreApplication) BeginBlock(req types.RequestBeginBlock) types.ResponseBeginBlock {
+	app.mtx.Lock()
+	defer app.mtx.Unlock()
+
+	app.state.block = blockInfo{
+		Height:   req.Header.Height,
+		Time:     req.Header.Time,
+		Proposer: hexutil.Encode(req.Header.ProposerAddress)}
+	return types.ResponseBeginBlock{}
+}
+
+// EndBlock updates the validator set from ticket holdings when configured
+// with WithValidatorHoldings, and otherwise makes no changes
+func (app *TicketStoreApplication) EndBlock(req types.RequestEndBlock) types.ResponseEndBlock {
+	if app.validators == nil {
+		return types.ResponseEndBlock{}
+	}
+
+	app.mtx.RLock()
+	defer app.mtx.RUnlock()
+
+	committed, _, _ := app.state.snapshotAt(app.state.height)
+	return types.ResponseEndBlock{ValidatorUpdates: app.validators.updates(committed.owners, app.state.owners)}
 }
 
 func (app *TicketStoreApplication) DeliverTx(tx types.RequestDeliverTx) types.ResponseDeliverTx {
-	var ticketTx TicketTx
-	err := json.Unmarshal(tx.Tx, &ticketTx)
+	app.mtx.Lock()
+	defer app.mtx.Unlock()
 
+	response := app.deliverTx(tx)
+	app.state.deliverStats.record(response.Code)
+	if response.Code == codeTypeOK {
+		app.metrics.TxDelivered()
+		app.logger.Debug("Delivered tx", "height", app.state.height+1)
+	} else {
+		app.metrics.TxRejected(response.Code)
+		app.logRejection("Rejected tx in DeliverTx", response.Code, response.Log)
+		app.auditRejection("DeliverTx", tx.Tx, response.Code, response.Log)
+	}
+	return response
+}
+
+// deliverTx applies every ticket in the tx or, if any of them is invalid,
+// none of them
+func (app *TicketStoreApplication) deliverTx(tx types.RequestDeliverTx) (response types.ResponseDeliverTx) {
+	defer func() {
+		if r := recover(); r != nil {
+			response = types.ResponseDeliverTx{Code: codeTypeInternalError, Log: app.recoverTx(r)}
+		}
+	}()
+
+	ticketTxs, err := decodeTicketTxs(tx.Tx)
 	if err != nil {
 		return types.ResponseDeliverTx{
 			Code: codeTypeEncodingError,
 			Log:  fmt.Sprint(err)}
 	}
 
-	previousTicket := app.state.tickets[ticketTx.Id]
-	err = ticketTx.validate(previousTicket.TicketTx)
-	if err != nil {
+	if index, err := app.validateTicketTxs(ticketTxs, ticketsById(app.state.tickets), app.rules, true); err != nil {
 		return types.ResponseDeliverTx{
-			Code: codeTypeTicketError,
-			Log:  fmt.Sprint(err)}
+			Code: validationCode(err),
+			Log:  rejectionLog(ticketTxs, index, err)}
+	}
+
+	// Every change is worked out before any is made, so a tx that fails part
+	// way through a bundle leaves the state as it was
+	changes := app.stageTicketTxs(ticketTxs)
+	app.state.apply(changes)
+	return types.ResponseDeliverTx{
+		Code:      codeTypeOK,
+		GasWanted: changes.gas,
+		GasUsed:   changes.gas,
+		Events:    changes.events}
+}
+
+// ticketChanges are the changes a tx makes to the state
+type ticketChanges struct {
+	// tickets holds the new version of each ticket the tx changes
+	tickets map[uint64]Ticket
+	// owners holds the new id list of each owner in staged, which lists
+	// every owner whose holdings the tx changes. An owner in staged but not
+	// in owners no longer holds any ticket
+	owners    ownerIndex
+	staged    map[string]bool
+	transfers map[uint64]int
+	content   []TicketTx
+	events    []types.Event
+	gas       int64
+}
+
+// stageTicketTxs works out the changes ticketTxs, which have been
+// validated, make to the state without making any of them
+func (app *TicketStoreApplication) stageTicketTxs(ticketTxs []TicketTx) ticketChanges {
+	changes := ticketChanges{
+		tickets:   make(map[uint64]Ticket, len(ticketTxs)),
+		owners:    make(ownerIndex),
+		staged:    make(map[string]bool),
+		transfers: make(map[uint64]int, len(ticketTxs)),
+		events:    make([]types.Event, 0, len(ticketTxs))}
+	for _, ticketTx := range ticketTxs {
+		// Owners are stored in lower case so they compare equal however they
+		// were submitted. The address hashes the same in either case
+		ticketTx.OwnerAddr = strings.ToLower(ticketTx.OwnerAddr)
+		previousTicket, changed := changes.tickets[ticketTx.Id]
+		if !changed {
+			previousTicket = app.state.tickets[ticketTx.Id]
+		}
+		app.logger.Debug("Changing ticket", "id", ticketTx.Id, "owner", ticketTx.OwnerAddr, "prevOwner", previousTicket.OwnerAddr)
+
+		changeHeights := append(previousTicket.ChangeHeights, app.state.height+1)
+		ticket := Ticket{
+			TicketTx:      ticketTx,
+			ChangeHeights: changeHeights,
+			PrevOwnerAddr: previousTicket.OwnerAddr,
+			History: appendHistory(previousTicket.History,
+				Transfer{ticketTx.OwnerAddr, ticketTx.Nonce, app.state.height + 1}, app.maxHistory)}
+		if app.dropProofs {
+			ticket = ticket.withoutProof()
+		}
+		changes.tickets[ticketTx.Id] = ticket
+		for _, owner := range []string{previousTicket.OwnerAddr, ticketTx.OwnerAddr} {
+			key := strings.ToLower(owner)
+			if key == "" || changes.staged[key] {
+				continue
+			}
+			changes.staged[key] = true
+			if ids, ok := app.state.owners[key]; ok {
+				changes.owners[key] = ids
+			}
+		}
+		changes.owners.move(ticketTx.Id, previousTicket.OwnerAddr, ticketTx.OwnerAddr)
+		changes.transfers[ticketTx.Id]++
+		// The tree holds the stored ticket, so a dropped proof is not kept
+		// there either
+		changes.content = append(changes.content, ticket.TicketTx)
+		changes.gas += app.gas(ticketTx)
+		changes.events = append(changes.events, ticketEvent(ticketTx, previousTicket.OwnerAddr))
 	}
+	return changes
+}
 
-	app.state.size++
-	changeHeights := append(previousTicket.ChangeHeights, app.state.height+1)
-	app.state.tickets[ticketTx.Id] = ticket{ticketTx, changeHeights}
-	app.state.tempTreeContent = append(app.state.tempTreeContent, ticketTx)
-	return types.ResponseDeliverTx{Code: codeTypeOK}
+// apply makes the changes stageTicketTxs worked out. It only assigns them,
+// so it cannot stop part way through
+func (state *state) apply(changes ticketChanges) {
+	if state.blockTransfers == nil {
+		state.blockTransfers = make(map[uint64]int)
+	}
+	for id, ticket := range changes.tickets {
+		state.tickets[id] = ticket
+	}
+	for owner := range changes.staged {
+		if ids, ok := changes.owners[owner]; ok {
+			state.owners[owner] = ids
+		} else {
+			delete(state.owners, owner)
+		}
+	}
+	for id, transfers := range changes.transfers {
+		state.blockTransfers[id] += transfers
+	}
+	state.size += int64(len(changes.content))
+	state.tempTreeContent = append(state.tempTreeContent, changes.content...)
 }
 
+// CheckTx validates against the state of the last committed block rather
+// than the tickets DeliverTx has changed since. A recheck after Commit then
+// sees exactly the state the new block produced, and a tx is never admitted
+// on the strength of a block that has not been committed yet
 func (app *TicketStoreApplication) CheckTx(tx types.RequestCheckTx) types.ResponseCheckTx {
-	var ticketTx TicketTx
-	err := json.Unmarshal(tx.Tx, &ticketTx)
+	app.mtx.RLock()
+	defer app.mtx.RUnlock()
 
+	response, cached := app.checkCache.get(tx.Tx)
+	if !cached {
+		rules := app.rules
+		rules.skipSignatures = app.lazySignatures
+		response = app.checkTx(tx, rules)
+		app.checkCache.put(tx.Tx, response)
+	}
+	app.statsMtx.Lock()
+	app.checkStats.record(response.Code)
+	app.statsMtx.Unlock()
+	if response.Code == codeTypeOK {
+		app.logger.Debug("Accepted tx in CheckTx")
+	} else {
+		app.logRejection("Rejected tx in CheckTx", response.Code, response.Log)
+		app.auditRejection("CheckTx", tx.Tx, response.Code, response.Log)
+	}
+	return response
+}
+
+// checkTx validates tx against the last committed state under rules
+func (app *TicketStoreApplication) checkTx(tx types.RequestCheckTx, rules validationRules) (response types.ResponseCheckTx) {
+	defer func() {
+		if r := recover(); r != nil {
+			response = types.ResponseCheckTx{Code: codeTypeInternalError, Log: app.recoverTx(r)}
+		}
+	}()
+
+	ticketTxs, err := decodeTicketTxs(tx.Tx)
 	if err != nil {
 		return types.ResponseCheckTx{
 			Code: codeTypeEncodingError,
 			Log:  fmt.Sprint(err)}
 	}
 
-	previousTicket := app.state.tickets[ticketTx.Id]
-	err = ticketTx.validate(previousTicket.TicketTx)
-	if err != nil {
+	if index, err := app.validateTicketTxs(ticketTxs, app.state.committedTickets(), rules, false); err != nil {
 		return types.ResponseCheckTx{
-			Code: codeTypeTicketError,
-			Log:  fmt.Sprint(err)}
+			Code: validationCode(err),
+			Log:  rejectionLog(ticketTxs, index, err)}
 	}
 
-	return types.ResponseCheckTx{Code: codeTypeOK}
+	var gas int64
+	for _, ticketTx := range ticketTxs {
+		gas += app.gas(ticketTx)
+	}
+	return types.ResponseCheckTx{Code: codeTypeOK, GasWanted: gas, GasUsed: gas}
+}
+
+// gas is the cost of storing ticket, a flat cost per tx plus a cost for
+// each byte of its details
+func (app *TicketStoreApplication) gas(ticket TicketTx) int64 {
+	return app.txGas + app.gasPerByte*int64(len(ticket.Details))
 }
 
 func (app *TicketStoreApplication) Commit() (resp types.ResponseCommit) {
+	app.mtx.Lock()
+	defer app.mtx.Unlock()
+
+	start := time.Now()
+	defer func() { app.metrics.Committed(app.state.height, time.Since(start)) }()
+
 	app.state.height++
+	app.state.committedStats = app.state.deliverStats.copy()
+	app.checkCache.reset()
+	changed := app.state.changedTickets()
 	if len(app.state.tempTreeContent) > 0 {
-		tree, _ := merkletree.NewTree(app.state.tempTreeContent)
-		app.state.rootHash = tree.Root.Hash
-		ticketsSnapshot := make(map[uint64]ticket)
-		for key, value := range app.state.tickets {
-			ticketsSnapshot[key] = value
+		if err := app.state.buildTree(); err != nil {
+			// Commit cannot report an error and every node must agree on the root
+			panic(err)
 		}
-		app.state.history[app.state.height] = snapshot{ticketsSnapshot, *tree}
 		app.state.tempTreeContent = app.state.tempTreeContent[:0]
+		app.state.blockTransfers = nil
+	} else if prev, ok := app.state.history[app.state.height-1]; ok {
+		// Nothing changed, so the previous block's tree is still the current one
+		app.state.history[app.state.height] = prev
 	}
 
-	return types.ResponseCommit{Data: app.state.rootHash}
+	if app.retainHeights > 0 {
+		app.state.pruneHistory(app.state.height - app.retainHeights + 1)
+	}
+
+	if app.dataDir != "" && app.snapshotInterval > 0 && app.state.height%app.snapshotInterval == 0 {
+		app.takeSnapshot()
+	}
+
+	if app.dataDir != "" && app.flushInterval > 0 {
+		if err := app.persistCommit(changed); err != nil {
+			// Tendermint takes a block to be durable once Commit returns
+			panic(err)
+		}
+	}
+
+	app.checkCaughtUp()
+	appHash := app.state.appHash()
+	app.logger.Debug("Committed block", "height", app.state.height, "root", hexutil.Encode(appHash))
+	return types.ResponseCommit{Data: appHash}
+}
+
+// recoverTx logs a panic raised while processing a tx, with its stack, and
+// returns the Log to reject the tx with. The Log only depends on the panic
+// value so every node rejects the tx identically
+func (app *TicketStoreApplication) recoverTx(r interface{}) string {
+	app.logger.Error("Recovered from panic processing tx", "err", r, "stack", string(debug.Stack()))
+	return fmt.Sprintf("Internal error: %v", r)
 }
 
+// logRejection logs a rejected tx. Validation failures are logged at info
+// level, being the closest the logger has to a warning, and malformed
+// transactions at debug
+func (app *TicketStoreApplication) logRejection(msg string, code uint32, reason string) {
+	switch code {
+	case codeTypeTicketError, codeTypeDetailsError:
+		app.logger.Info(msg, "code", code, "reason", reason)
+	default:
+		app.logger.Debug(msg, "code", code, "reason", reason)
+	}
+}
+
+// Query answers reqQuery, stopping early if the application is closed or the
+// query times out
 func (app *TicketStoreApplication) Query(reqQuery types.RequestQuery) types.ResponseQuery {
+	return app.QueryContext(context.Background(), reqQuery)
+}
+
+// QueryContext answers reqQuery like Query, but the tickets, dump and owner
+// paths also give up with codeTypeCancelled as soon as ctx is done. The
+// gateway queries through client.NewLocal with each HTTP request's context,
+// so a query its client has abandoned stops. State is never changed by a
+// query, so stopping part way leaves nothing to undo
+func (app *TicketStoreApplication) QueryContext(ctx context.Context, reqQuery types.RequestQuery) types.ResponseQuery {
+	ctx, cancel := app.queryContext(ctx)
+	defer cancel()
+
+	app.mtx.RLock()
+	defer app.mtx.RUnlock()
+
 	switch reqQuery.Path {
 	case "hash":
 		return types.ResponseQuery{Value: []byte(fmt.Sprint(app.state.height))}
 	case "tx":
 		return types.ResponseQuery{Value: []byte(fmt.Sprint(app.state.size))}
-	case "ticket":
-		ticketResponse, err := app.state.findTicket(reqQuery)
-		if err != nil {
-			return types.ResponseQuery{Log: fmt.Sprintf("%v is not a valid ticket id", reqQuery.Data)}
+	case "ticket", "solidityProof":
+		ticketResponse, height, err := app.state.findTicket(reqQuery)
+		switch err {
+		case nil:
+		case ErrHeightUnavailable:
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		case ErrNoTickets:
+			return types.ResponseQuery{Code: codeTypeNoTickets, Log: fmt.Sprintf("No tickets have been committed at height %v", height), Height: height}
+		case ErrTicketNotFound:
+			return types.ResponseQuery{Code: codeTypeNotFound, Log: fmt.Sprintf("Ticket %s could not be found", reqQuery.Data)}
+		case ErrTicketBurned:
+			return types.ResponseQuery{Code: codeTypeNotFound, Log: fmt.Sprintf("Ticket %s has been burned", reqQuery.Data)}
+		default:
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprintf("%s is not a valid ticket id", reqQuery.Data)}
+		}
+		if reqQuery.Path == "solidityProof" {
+			proof, err := ticketResponse.solidityProof(app.state.history[height].rootHash())
+			if err != nil {
+				return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+			}
+			response, _ := json.Marshal(proof)
+			return types.ResponseQuery{Value: response, Height: height}
 		}
 		response, _ := json.Marshal(ticketResponse)
+		return types.ResponseQuery{Value: response, Height: height}
+	case "tickets":
+		var ticketIds []uint64
+		if err := json.Unmarshal(reqQuery.Data, &ticketIds); err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		if app.maxBatchSize > 0 && len(ticketIds) > app.maxBatchSize {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(ErrBatchTooLarge)}
+		}
+		ticketResponses, height, err := app.state.findTickets(ctx, ticketIds, reqQuery.Height)
+		switch err {
+		case nil:
+		case ErrHeightUnavailable:
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		case context.Canceled, context.DeadlineExceeded:
+			return cancelledQuery(err)
+		default:
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		response, _ := json.Marshal(ticketResponses)
+		return types.ResponseQuery{Value: response, Height: height}
+	case "lastChange":
+		ticketId, err := strconv.ParseUint(string(reqQuery.Data), 10, 64)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprintf("%s is not a valid ticket id", reqQuery.Data)}
+		}
+		lastChange, err := app.state.findLastChange(ticketId)
+		switch err {
+		case nil:
+		case ErrHeightUnavailable:
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", lastChange.Height)}
+		case ErrTicketNotFound:
+			return types.ResponseQuery{Code: codeTypeNotFound, Log: fmt.Sprintf("Ticket %s could not be found", reqQuery.Data)}
+		case ErrTicketBurned:
+			return types.ResponseQuery{Code: codeTypeNotFound, Log: fmt.Sprintf("Ticket %s has been burned", reqQuery.Data)}
+		default:
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		response, _ := json.Marshal(lastChange)
+		return types.ResponseQuery{Value: response, Height: lastChange.Height}
+	case "simulate":
+		// CheckTx already validates against committed state without changing it.
+		// Signatures are always checked, as DeliverTx will
+		result := app.checkTx(types.RequestCheckTx{Tx: reqQuery.Data}, app.rules)
+		response, _ := json.Marshal(simulateResponse{Code: result.Code, Log: result.Log, Gas: result.GasWanted})
+		return types.ResponseQuery{Value: response, Height: app.state.height}
+	case "dump":
+		var query page
+		if len(reqQuery.Data) > 0 {
+			if err := json.Unmarshal(reqQuery.Data, &query); err != nil {
+				return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+			}
+		}
+		if query.Limit < 0 || query.Offset < 0 {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: "Page limit and offset must not be negative"}
+		}
+		snapshot, height, err := app.state.snapshotAt(reqQuery.Height)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		}
+		dumped, err := snapshot.dump(ctx, query, height)
+		if err != nil {
+			return cancelledQuery(err)
+		}
+		response, _ := json.Marshal(dumped)
+		return types.ResponseQuery{Value: response, Height: height}
+	case "owner":
+		query, err := parseOwnerQuery(reqQuery.Data)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		snapshot, height, err := app.state.snapshotAt(reqQuery.Height)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		}
+		owned, err := snapshot.ownerTickets(ctx, query.Owner)
+		if err != nil {
+			return cancelledQuery(err)
+		}
+		start, end := query.bounds(len(owned))
+		response, _ := json.Marshal(owned[start:end])
+		return types.ResponseQuery{Value: response, Height: height}
+	case "holders":
+		// The data is how many of the top holders to return, all of them when empty
+		var limit int
+		if len(reqQuery.Data) > 0 {
+			n, err := strconv.ParseUint(string(reqQuery.Data), 10, 31)
+			if err != nil {
+				return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprintf("%s is not a valid number of holders", reqQuery.Data)}
+			}
+			limit = int(n)
+		}
+		snapshot, height, err := app.state.snapshotAt(reqQuery.Height)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		}
+		response, _ := json.Marshal(snapshot.owners.holders(limit))
+		return types.ResponseQuery{Value: response, Height: height}
+	case "isowner":
+		var query isOwnerQuery
+		if err := json.Unmarshal(reqQuery.Data, &query); err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		snapshot, height, err := app.state.snapshotAt(reqQuery.Height)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		}
+		ticket, exists := snapshot.tickets.get(query.Id)
+		if !exists {
+			return types.ResponseQuery{Code: codeTypeNotFound, Log: fmt.Sprintf("Ticket %v could not be found", query.Id)}
+		}
+		// A burned ticket is owned by the burn address, which nobody holds
+		response, _ := json.Marshal(isOwnerResponse{
+			Owner:  !ticket.isBurned() && strings.EqualFold(ticket.OwnerAddr, query.Address),
+			Nonce:  ticket.Nonce,
+			Height: height})
+		return types.ResponseQuery{Value: response, Height: height}
+	case "history":
+		ticketId, err := strconv.ParseUint(string(reqQuery.Data), 10, 64)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprintf("%s is not a valid ticket id", reqQuery.Data)}
+		}
+		snapshot, height, err := app.state.snapshotAt(reqQuery.Height)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		}
+		ticket, exists := snapshot.tickets.get(ticketId)
+		if !exists {
+			return types.ResponseQuery{Code: codeTypeNotFound, Log: fmt.Sprintf("Ticket %s could not be found", reqQuery.Data)}
+		}
+		// Burned tickets keep their history for auditing
+		response, _ := json.Marshal(ticket.History)
+		return types.ResponseQuery{Value: response, Height: height}
+	case "root":
+		response, _ := json.Marshal(rootResponse{
+			RootHash: hexutil.Encode(app.state.appHash()),
+			Height:   app.state.height})
+		return types.ResponseQuery{Value: response, Height: app.state.height}
+	case "tree":
+		if !app.debugQueries {
+			return types.ResponseQuery{Code: codeTypeUnknownPath, Log: "The tree query is only available with debug queries enabled"}
+		}
+		snapshot, height, err := app.state.snapshotAt(reqQuery.Height)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", height)}
+		}
+		response, _ := json.Marshal(snapshot.dumpTree(height))
+		return types.ResponseQuery{Value: response, Height: height}
+	case "stats":
+		response, _ := json.Marshal(app.stats())
+		return types.ResponseQuery{Value: response, Height: app.state.height}
+	case "syncing":
+		response, _ := json.Marshal(app.syncing())
+		return types.ResponseQuery{Value: response, Height: app.state.height}
+	case "health":
+		response, err := app.state.checkHealth()
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeUnhealthy, Log: fmt.Sprint(err), Height: app.state.height}
+		}
+		value, _ := json.Marshal(response)
+		return types.ResponseQuery{Value: value, Height: app.state.height}
+	case "version":
+		response, _ := json.Marshal(versionResponse{
+			Version:    Version,
+			ABCI:       abciVersion,
+			Tendermint: tendermintVersion,
+			Height:     app.state.height})
+		return types.ResponseQuery{Value: response, Height: app.state.height}
+	case "block":
+		response, _ := json.Marshal(app.state.block)
 		return types.ResponseQuery{Value: response}
+	case "verify":
+		var proof TicketResponse
+		if err := json.Unmarshal(reqQuery.Data, &proof); err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		// A proof is checked against the root of the height it was built at,
+		// or the latest root for proofs that do not name one
+		root, height := app.state.appHash(), app.state.height
+		if proof.Height > 0 {
+			snapshot, _, err := app.state.snapshotAt(proof.Height)
+			if err != nil {
+				return types.ResponseQuery{Code: codeTypeHeightUnavailable, Log: fmt.Sprintf("State at height %v is not available", proof.Height)}
+			}
+			root, height = snapshot.rootHash(), proof.Height
+		}
+		valid, err := proof.verify(root, app.state.hashStrategy)
+		if err != nil {
+			return types.ResponseQuery{Code: codeTypeEncodingError, Log: fmt.Sprint(err)}
+		}
+		response, _ := json.Marshal(verifyResponse{
+			Valid:    valid,
+			RootHash: hexutil.Encode(root),
+			Height:   height})
+		return types.ResponseQuery{Value: response, Height: height}
 	default:
-		return types.ResponseQuery{Log: fmt.Sprintf("Invalid query path. Expected hash, tx or ticket, got %v", reqQuery.Path)}
+		return types.ResponseQuery{
+			Code: codeTypeUnknownPath,
+			Log:  fmt.Sprintf("Invalid query path. Expected %v or %v, got %v", strings.Join(queryPaths[:len(queryPaths)-1], ", "), queryPaths[len(queryPaths)-1], reqQuery.Path)}
 	}
 }
 
+// queryPaths are the paths QueryContext answers, in the order of its cases,
+// which the unknown path error lists. tree is only answered with debug
+// queries enabled
+var queryPaths = []string{"hash", "tx", "ticket", "solidityProof", "tickets", "lastChange", "simulate", "dump",
+	"owner", "holders", "isowner", "history", "root", "tree", "stats", "syncing", "health", "version", "block", "verify"}
+
+// queryContext derives the context of a single query, which is done once the
+// application is closed, the query times out or parent is done
+func (app *TicketStoreApplication) queryContext(parent context.Context) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if app.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(app.ctx, app.queryTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(app.ctx)
+	}
+	if done := parent.Done(); done != nil {
+		select {
+		case <-done:
+			cancel()
+		default:
+			go func() {
+				select {
+				case <-done:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
+	return ctx, cancel
+}
+
+// cancelledQuery is the response to a query whose context was done before it
+// finished
+func cancelledQuery(err error) types.ResponseQuery {
+	return types.ResponseQuery{Code: codeTypeCancelled, Log: fmt.Sprintf("Query stopped early: %v", err)}
+}
+
+// ticketEvent describes an accepted ticket change so it can be indexed and
+// searched through tx_search or subscribed to over the event bus
+func ticketEvent(ticket TicketTx, prevOwner string) types.Event {
+	return types.Event{
+		Type: "ticket",
+		Attributes: []cmn.KVPair{
+			{Key: []byte("id"), Value: []byte(fmt.Sprint(ticket.Id))},
+			{Key: []byte("owner"), Value: []byte(ticket.OwnerAddr)},
+			{Key: []byte("prevOwner"), Value: []byte(prevOwner)},
+			{Key: []byte("nonce"), Value: []byte(fmt.Sprint(ticket.Nonce))},
+		}}
+}
+
+// CalculateHash is the Merkle leaf and the hash resale signatures are made
+// over. It matches Solidity's
+// keccak256(abi.encodePacked(uint256 id, uint256 nonce, string details, address ownerAddr, bytes prevOwnerProof))
+// so the same ticket hashes identically on chain. The hash is over the field
+// values, so it does not depend on how the ticket's JSON was laid out
 func (ticket TicketTx) CalculateHash() ([]byte, error) {
-	idBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(idBytes, ticket.Id)
+	if ticket.leaf != "" {
+		return hexutil.Decode(ticket.leaf)
+	}
 	hash := sha3.SoliditySHA3(
 		[]string{"uint256", "uint256", "string", "address", "bytes"},
 		[]interface{}{fmt.Sprint(ticket.Id), fmt.Sprint(ticket.Nonce), ticket.Details, ticket.OwnerAddr, ticket.PrevOwnerProof})
 	return hash, nil
 }
 
-func (ticket TicketTx) Equals(other merkletree.Content) (bool, error) {
-	otherTicket, isTicket := other.(TicketTx)
-	if isTicket {
-		return ticket == otherTicket, nil
+func (ticket TicketTx) validate(prevTicket TicketTx, rules validationRules) error {
+	// Id zero is reserved so it is never confused with the zero value of a
+	// missing ticket
+	if ticket.Id == 0 {
+		return ErrBadId
 	}
 
-	return false, fmt.Errorf("%v is not a ticket", other)
-}
-
-func (ticket TicketTx) validate(prevTicket TicketTx) error {
-	if ticket.OwnerAddr == "" {
+	if !validAddress(ticket.OwnerAddr, rules.checksumAddresses) {
 		return ErrBadAddress
 	}
 
-	if ticket.Nonce <= prevTicket.Nonce {
+	// The proof is hashed as bytes into the Merkle leaf when the block is
+	// committed, where a proof that does not decode could not be rejected
+	if _, err := decodeProofBytes(ticket.PrevOwnerProof); err != nil {
+		return ErrBadProofEncoding
+	}
+
+	// A replay of the stored version is reported apart from a nonce conflict
+	// so clients can treat resubmitting a ticket as having succeeded
+	if prevTicket.OwnerAddr != "" && ticket.hashEquals(prevTicket) {
+		return ErrDuplicateTicket
+	}
+
+	if !utf8.ValidString(ticket.Details) ||
+		(rules.maxDetailsBytes > 0 && len(ticket.Details) > rules.maxDetailsBytes) {
+		return ErrBadDetails
+	}
+
+	if prevTicket.isBurned() {
+		return ErrTicketBurned
+	}
+
+	// Only an existing ticket can be burned, and only by its current owner
+	// through the usual resale signature
+	if ticket.isBurned() && prevTicket.OwnerAddr == "" {
+		return ErrTicketNotFound
+	}
+
+	if rules.noSelfTransfers && prevTicket.OwnerAddr != "" &&
+		strings.EqualFold(ticket.OwnerAddr, prevTicket.OwnerAddr) {
+		return ErrSelfTransfer
+	}
+
+	// A new ticket has no previous nonce to exceed, so it may start at zero
+	if prevTicket.OwnerAddr != "" && ticket.Nonce <= prevTicket.Nonce {
 		return ErrBadNonce
 	}
 
+	if rules.strictNonces && prevTicket.OwnerAddr == "" && ticket.Nonce != 1 {
+		return ErrBadNonce
+	}
+
+	if rules.skipSignatures {
+		return nil
+	}
+
 	if prevTicket.OwnerAddr != "" {
-		prevTicketHash, err := prevTicket.CalculateHash()
+		signer, err := ticket.getOwnerProofSigner(prevTicket, rules.chainId)
 		if err != nil {
 			return err
 		}
-
-		signer, err := ticket.getOwnerProofSigner(prevTicketHash)
+		if signer != strings.ToLower(prevTicket.OwnerAddr) {
+			return ErrBadSignature
+		}
+	} else if len(rules.issuers) > 0 {
+		signer, err := ticket.getIssuerSigner(rules.chainId)
 		if err != nil {
 			return err
 		}
-		if signer != strings.ToLower(prevTicket.OwnerAddr) {
-			return ErrBadSignature
+		if !rules.issuers[signer] {
+			return ErrUnauthorizedIssuer
 		}
 	}
 
 	return nil
 }
 
-func (ticket TicketTx) getOwnerProofSigner(prevTicketHash []byte) (string, error) {
-	if len(ticket.PrevOwnerProof) < 3 {
-		// Cannot be a valid proof
-		return "", ErrBadSignature
+// validAddress reports whether addr is a 0x prefixed 20 byte hex address. A
+// mixed case address must match its EIP-55 checksum, as must every address
+// when checksummed is set
+func validAddress(addr string, checksummed bool) bool {
+	if !strings.HasPrefix(addr, "0x") || !common.IsHexAddress(addr) {
+		return false
+	}
+	digits := addr[2:]
+	mixedCase := strings.ToLower(digits) != digits && strings.ToUpper(digits) != digits
+	if mixedCase || checksummed {
+		return common.HexToAddress(addr).Hex() == addr
 	}
+	return true
+}
+
+// validationCode is the response code for a transaction rejected by validate
+func validationCode(err error) uint32 {
+	switch err {
+	case ErrBadDetails:
+		return codeTypeDetailsError
+	case ErrDuplicateTicket:
+		return codeTypeDuplicate
+	case ErrRateLimited:
+		return codeTypeRateLimited
+	case ErrSupplyExhausted:
+		return codeTypeSupplyExhausted
+	case ErrUnauthorizedIssuer:
+		return codeTypeUnauthorized
+	case ErrExpired:
+		return codeTypeExpired
+	case ErrSelfTransfer:
+		return codeTypeSelfTransfer
+	default:
+		return codeTypeTicketError
+	}
+}
+
+func (ticket TicketTx) hashEquals(other TicketTx) bool {
+	hash, _ := ticket.CalculateHash()
+	otherHash, _ := other.CalculateHash()
+	return bytes.Equal(hash, otherHash)
+}
+
+// expired reports whether the ticket's deadline is before blockTime. A zero
+// blockTime, before the first block, is never past a deadline
+func (ticket TicketTx) expired(blockTime time.Time) bool {
+	return ticket.ValidUntil != 0 && !blockTime.IsZero() && ticket.ValidUntil < blockTime.Unix()
+}
+
+func (ticket TicketTx) isBurned() bool {
+	return strings.ToLower(ticket.OwnerAddr) == burnAddress
+}
 
-	bytesProof, err := hexutil.Decode(ticket.PrevOwnerProof)
+// getOwnerProofSigner recovers the address that signed the previous ticket
+// under the ticket's proof scheme
+func (ticket TicketTx) getOwnerProofSigner(prevTicket TicketTx, chainId uint64) (string, error) {
+	scheme, ok := ownerProofSchemes[ticket.ProofScheme]
+	if !ok {
+		return "", ErrBadProofScheme
+	}
+
+	signedHash, err := scheme.signedHash(prevTicket, chainId)
 	if err != nil {
 		return "", err
 	}
+	return recoverSigner(signedHash, ticket.PrevOwnerProof, chainId)
+}
+
+// getIssuerSigner recovers the address that signed a new ticket under the
+// ticket's proof scheme. The signature is over the ticket itself with its
+// proof left empty
+func (ticket TicketTx) getIssuerSigner(chainId uint64) (string, error) {
+	scheme, ok := ownerProofSchemes[ticket.ProofScheme]
+	if !ok {
+		return "", ErrBadProofScheme
+	}
 
-	bytesProof[64] -= 27
-	signerPkey, err := crypto.SigToPub(prevTicketHash, bytesProof)
+	unsigned := ticket
+	unsigned.PrevOwnerProof = ""
+	signedHash, err := scheme.signedHash(unsigned, chainId)
 	if err != nil {
 		return "", err
 	}
-
-	return strings.ToLower(crypto.PubkeyToAddress(*signerPkey).Hex()), nil
+	return recoverSigner(signedHash, ticket.PrevOwnerProof, chainId)
 }
 
-func (state state) findTicket(query types.RequestQuery) (ticketResponse, error) {
-	ticketId, err := strconv.ParseUint(string(query.Data), 10, 64)
+// buildTree builds the tree over the current tickets and records it in
+// history at the current height, with the tickets and owners as they are
+// now. When the block's changes are known and history holds the height
+// before it, the tree, tickets and owners are updated from that height's,
+// sharing everything the block left alone, so the cost depends on what the
+// block changed rather than on the size of the state. Otherwise, as on
+// genesis, restore and replay, they are built from scratch
+func (state *state) buildTree() error {
+	prev, ok := state.history[state.height-1]
+	if !ok || len(state.tempTreeContent) == 0 {
+		tree, err := newMerkleTree(state.treeContent(), state.hashStrategy)
+		if err != nil {
+			return err
+		}
+		state.setTree(tree)
+		state.history[state.height] = snapshot{newTicketMap(state.tickets), newOwnerMap(state.owners), tree, state.size}
+		return nil
+	}
+
+	changed := state.changedTickets()
+	tree, err := prev.tree.update(changed, state.hashStrategy)
 	if err != nil {
-		return ticketResponse{}, err
+		return err
 	}
+	state.setTree(tree)
 
-	height := query.Height
-	if height <= 0 {
-		height = state.height
+	owners := prev.owners
+	for _, ticket := range changed {
+		prevTicket, _ := prev.tickets.get(ticket.Id)
+		for _, owner := range []string{prevTicket.OwnerAddr, ticket.OwnerAddr} {
+			if key := strings.ToLower(owner); key != "" {
+				owners = owners.set(key, state.owners[key])
+			}
+		}
+	}
+	state.history[state.height] = snapshot{prev.tickets.set(changed), owners, tree, state.size}
+	return nil
+}
+
+// setTree makes tree the current tree and its root the root hash
+func (state *state) setTree(tree *merkleTree) {
+	state.tree = tree
+	state.rootHash = nil
+	if tree != nil {
+		state.rootHash = tree.root.hash
+	}
+}
+
+// treeContent returns the latest version of every live ticket ordered by id,
+// so the tree always covers the full state and is identical on every node
+func (state state) treeContent() []TicketTx {
+	content := make([]TicketTx, 0, len(state.tickets))
+	for _, ticket := range sortTickets(state.tickets) {
+		if !ticket.isBurned() {
+			content = append(content, ticket.TicketTx)
+		}
+	}
+	return content
+}
+
+// sortTickets returns the tickets in byId ordered by id
+func sortTickets(byId map[uint64]Ticket) []Ticket {
+	tickets := make([]Ticket, 0, len(byId))
+	for _, ticket := range byId {
+		tickets = append(tickets, ticket)
 	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].Id < tickets[j].Id })
+	return tickets
+}
 
-	lastTicketChange, err := state.tickets[ticketId].findLastChangeBeforeHeight(height)
+// findTicket builds the ticket and its proof as of the height in the query,
+// returning the height it resolved to. The id may be followed by :height in
+// the query data, which takes precedence over the query height. It returns
+// ErrNoTickets when no tree had been committed at that height
+func (state state) findTicket(query types.RequestQuery) (TicketResponse, int64, error) {
+	ticketId, height, err := parseTicketQuery(string(query.Data), query.Height)
 	if err != nil {
-		return ticketResponse{}, err
+		return TicketResponse{}, 0, err
 	}
 
-	snapshot := state.history[lastTicketChange]
-	ticket := snapshot.tickets[ticketId]
-	merkleProofBytes, index, err := snapshot.tree.GetMerklePath(ticket.TicketTx)
+	// Prove against the tree committed at the requested height, which holds
+	// every ticket alive at that point rather than only the ones changed then
+	snapshot, height, err := state.snapshotAt(height)
 	if err != nil {
-		return ticketResponse{}, err
+		return TicketResponse{}, height, err
+	}
+	if snapshot.tree == nil {
+		return TicketResponse{}, height, ErrNoTickets
+	}
+	response, err := snapshot.proveTicket(ticketId, height)
+	return response, height, err
+}
+
+// proveTicket builds ticket ticketId and its proof against the snapshot's
+// tree, which was committed at height
+func (snapshot snapshot) proveTicket(ticketId uint64, height int64) (TicketResponse, error) {
+	ticket, exists := snapshot.tickets.get(ticketId)
+	if !exists {
+		return TicketResponse{}, ErrTicketNotFound
+	}
+	if ticket.isBurned() {
+		return TicketResponse{}, ErrTicketBurned
+	}
+	if snapshot.tree == nil {
+		return TicketResponse{}, ErrNoTickets
+	}
+	merkleProofBytes, index, err := snapshot.tree.proof(ticketId)
+	if err != nil {
+		return TicketResponse{}, err
 	}
 
 	merkleProof := make([]string, len(merkleProofBytes))
 	for i, v := range merkleProofBytes {
 		merkleProof[i] = hexutil.Encode(v)
 	}
-	return ticketResponse{Ticket: ticket, Index: index, MerkleProof: merkleProof}, nil
+	return TicketResponse{
+		Ticket:      ticket,
+		Index:       index,
+		MerkleProof: merkleProof,
+		Height:      height,
+		RootHash:    hexutil.Encode(snapshot.rootHash())}, nil
+}
+
+// findTickets proves each of ticketIds as of height, in the order given.
+// Tickets that are missing or burned are left nil. It returns ctx's error if
+// ctx is done before every ticket is proved
+func (state state) findTickets(ctx context.Context, ticketIds []uint64, height int64) ([]*TicketResponse, int64, error) {
+	snapshot, height, err := state.snapshotAt(height)
+	if err != nil {
+		return nil, height, err
+	}
+
+	responses := make([]*TicketResponse, len(ticketIds))
+	for i, ticketId := range ticketIds {
+		if err := ctx.Err(); err != nil {
+			return nil, height, err
+		}
+		response, err := snapshot.proveTicket(ticketId, height)
+		switch err {
+		case nil:
+			responses[i] = &response
+		case ErrTicketNotFound, ErrTicketBurned, ErrNoTickets:
+		default:
+			return nil, height, err
+		}
+	}
+	return responses, height, nil
+}
+
+// findLastChange proves the committed version of ticket ticketId against the
+// tree of the block it last changed in, so it can be checked against a header
+// from that height
+func (state state) findLastChange(ticketId uint64) (TicketResponse, error) {
+	ticket, exists := state.committedTickets().get(ticketId)
+	if !exists || len(ticket.ChangeHeights) == 0 {
+		return TicketResponse{}, ErrTicketNotFound
+	}
+
+	height := ticket.ChangeHeights[len(ticket.ChangeHeights)-1]
+	snapshot, ok := state.history[height]
+	if !ok || height < state.retainedFrom {
+		return TicketResponse{Height: height}, ErrHeightUnavailable
+	}
+	return snapshot.proveTicket(ticketId, height)
+}
+
+// pruneHistory drops the state of every height below from
+func (state *state) pruneHistory(from int64) {
+	for height := state.retainedFrom; height < from; height++ {
+		delete(state.history, height)
+	}
+	if from > state.retainedFrom {
+		state.retainedFrom = from
+	}
+}
+
+// committedTickets returns the tickets as of the last Commit
+func (state state) committedTickets() ticketMap {
+	return state.history[state.height].tickets
+}
+
+// snapshotAt returns the committed state at height, where zero or less means
+// the latest height, along with the height it resolved to
+func (state state) snapshotAt(height int64) (snapshot, int64, error) {
+	if height <= 0 {
+		height = state.height
+	}
+	if height > state.height || height < state.retainedFrom {
+		return snapshot{}, height, ErrHeightUnavailable
+	}
+
+	if snapshot, ok := state.history[height]; ok {
+		return snapshot, height, nil
+	}
+	// History starts with the first block that held tickets
+	return snapshot{}, height, nil
+}
+
+// checkHealth reports the committed state's counters, or an error if its
+// tickets, tree and root hash disagree with each other
+func (state state) checkHealth() (healthResponse, error) {
+	snapshot, _, err := state.snapshotAt(state.height)
+	if err != nil {
+		return healthResponse{}, err
+	}
+	live := 0
+	for _, ticket := range snapshot.tickets.sorted() {
+		if !ticket.isBurned() {
+			live++
+		}
+	}
+
+	switch {
+	case live > 0 && len(state.rootHash) == 0:
+		return healthResponse{}, fmt.Errorf("%v live tickets but no root hash", live)
+	case live == 0 && len(state.rootHash) > 0:
+		return healthResponse{}, fmt.Errorf("Root hash without any live tickets")
+	case !bytes.Equal(snapshot.rootHash(), state.rootHash):
+		return healthResponse{}, fmt.Errorf("Root hash does not match the tree committed at height %v", state.height)
+	}
+	return healthResponse{Height: state.height, Tickets: live, Txs: snapshot.size}, nil
+}
+
+// appHash is the app hash reported for the committed height: the tree's root
+// or, with no live tickets, the hash of no input. Every committed height then
+// has a non-nil app hash, while height zero keeps the empty genesis app hash
+func (state state) appHash() []byte {
+	if len(state.rootHash) > 0 || state.height == 0 {
+		return state.rootHash
+	}
+	return state.hashStrategy().Sum(nil)
+}
+
+// rootHash is the root of the snapshot's tree, empty when it holds no tickets
+func (snapshot snapshot) rootHash() []byte {
+	if snapshot.tree == nil {
+		return nil
+	}
+	return snapshot.tree.root.hash
+}
+
+// dump returns a page of the live tickets in the snapshot, ordered by id, or
+// ctx's error if ctx is done first
+func (snapshot snapshot) dump(ctx context.Context, query page, height int64) (dumpResponse, error) {
+	live := make([]TicketTx, 0, snapshot.tickets.len())
+	for _, ticket := range snapshot.tickets.sorted() {
+		if err := ctx.Err(); err != nil {
+			return dumpResponse{}, err
+		}
+		if !ticket.isBurned() {
+			live = append(live, ticket.TicketTx)
+		}
+	}
+
+	start, end := query.bounds(len(live))
+	return dumpResponse{
+		Tickets:  live[start:end],
+		Total:    len(live),
+		RootHash: hexutil.Encode(snapshot.rootHash()),
+		Height:   height}, nil
+}
+
+// ownerTickets returns the tickets held by owner, ordered by id, or ctx's
+// error if ctx is done first. Addresses are compared case-insensitively
+func (snapshot snapshot) ownerTickets(ctx context.Context, owner string) ([]Ticket, error) {
+	ids := snapshot.owners.get(strings.ToLower(owner))
+	owned := make([]Ticket, 0, len(ids))
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ticket, _ := snapshot.tickets.get(id)
+		owned = append(owned, ticket)
+	}
+	return owned, nil
+}
+
+// parseOwnerQuery accepts either a bare address or a JSON object with the
+// owner and the page to return
+func parseOwnerQuery(data []byte) (ownerQuery, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return ownerQuery{Owner: string(data)}, nil
+	}
+
+	var query ownerQuery
+	if err := json.Unmarshal(data, &query); err != nil {
+		return ownerQuery{}, err
+	}
+	if query.Limit < 0 || query.Offset < 0 {
+		return ownerQuery{}, fmt.Errorf("Page limit and offset must not be negative")
+	}
+	return query, nil
+}
+
+// bounds returns the start and end of the page within a result set of size n
+func (page page) bounds(n int) (int, int) {
+	start := page.Offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if page.Limit > 0 && start+page.Limit < n {
+		end = start + page.Limit
+	}
+	return start, end
+}
+
+// verify reports whether the proof, as returned by the ticket query, hashes
+// the ticket up to root. Each index entry is 1 when the sibling at that level
+// is the right hand node and 0 when it is the left. Parents are hashed with
+// hashStrategy, as in the tree. A proof naming a different root never
+// verifies, even if its leaf is also in root
+func (proof TicketResponse) verify(root []byte, hashStrategy func() hash.Hash) (bool, error) {
+	if len(proof.MerkleProof) != len(proof.Index) {
+		return false, fmt.Errorf("Proof has %v hashes but %v indexes", len(proof.MerkleProof), len(proof.Index))
+	}
+	if proof.RootHash != "" && !strings.EqualFold(proof.RootHash, hexutil.Encode(root)) {
+		return false, nil
+	}
+
+	hash, err := proof.Ticket.TicketTx.CalculateHash()
+	if err != nil {
+		return false, err
+	}
+
+	for i, encodedSibling := range proof.MerkleProof {
+		sibling, err := hexutil.Decode(encodedSibling)
+		if err != nil {
+			return false, err
+		}
+
+		h := hashStrategy()
+		if proof.Index[i] == 1 {
+			h.Write(hash)
+			h.Write(sibling)
+		} else {
+			h.Write(sibling)
+			h.Write(hash)
+		}
+		hash = h.Sum(nil)
+	}
+
+	return len(root) > 0 && bytes.Equal(hash, root), nil
 }
 
 func parseTicketQuery(queryData string, currentHeight int64) (ticketId uint64, height int64, err error) {
@@ -262,7 +1825,7 @@ func parseTicketQuery(queryData string, currentHeight int64) (ticketId uint64, h
 		return
 	}
 
-	// Height was not provided so assume latest
+	// Height was not provided so use the query height
 	if len(params) == 1 {
 		height = currentHeight
 		return
@@ -271,13 +1834,3 @@ func parseTicketQuery(queryData string, currentHeight int64) (ticketId uint64, h
 	height, err = strconv.ParseInt(params[1], 10, 64)
 	return
 }
-
-func (ticket ticket) findLastChangeBeforeHeight(height int64) (int64, error) {
-	for i := len(ticket.ChangeHeights) - 1; i >= 0; i-- {
-		if ticket.ChangeHeights[i] <= height {
-			return ticket.ChangeHeights[i], nil
-		}
-	}
-
-	return 0, ErrTicketNotFound
-}
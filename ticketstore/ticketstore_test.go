@@ -0,0 +1,349 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// Keys of the owners used throughout the tests
+var (
+	aliceKey = mustKey("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	bobKey   = mustKey("8da4ef21b864d2cc526dbdb2a120bd2874c36c9d0a1fb7f8c63d7f7a8b41de8f")
+	carolKey = mustKey("c85ef7d79691fe79573b1a7064c19c1a9819ebdbd1faaab1a8ec92344438aaf4")
+)
+
+func mustKey(hexKey string) *ecdsa.PrivateKey {
+	key, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// address is the lower case address of key, as the store keeps owners
+func address(key *ecdsa.PrivateKey) string {
+	return strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+}
+
+// newTicket is a new ticket id owned by owner
+func newTicket(id uint64, owner *ecdsa.PrivateKey) TicketTx {
+	return TicketTx{Id: id, Nonce: 1, Details: fmt.Sprintf("Ticket %v", id), OwnerAddr: address(owner)}
+}
+
+// resell transfers prev to owner with the next nonce, signed by prevKey
+func resell(t testing.TB, prev TicketTx, prevKey *ecdsa.PrivateKey, owner string) TicketTx {
+	t.Helper()
+	proof, err := SignTicketTransfer(prev, prevKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TicketTx{Id: prev.Id, Nonce: prev.Nonce + 1, Details: prev.Details, OwnerAddr: owner, PrevOwnerProof: proof}
+}
+
+// encodeTx encodes a single ticket as an object and several as a bundle
+func encodeTx(t testing.TB, tickets ...TicketTx) []byte {
+	t.Helper()
+	var v interface{} = tickets
+	if len(tickets) == 1 {
+		v = tickets[0]
+	}
+	tx, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func deliver(t testing.TB, app *TicketStoreApplication, tickets ...TicketTx) types.ResponseDeliverTx {
+	t.Helper()
+	return app.DeliverTx(types.RequestDeliverTx{Tx: encodeTx(t, tickets...)})
+}
+
+func checkTx(t testing.TB, app *TicketStoreApplication, tickets ...TicketTx) types.ResponseCheckTx {
+	t.Helper()
+	return app.CheckTx(types.RequestCheckTx{Tx: encodeTx(t, tickets...)})
+}
+
+// commitBlock delivers each ticket as its own tx, failing the test if any is
+// rejected, and commits the block, returning the app hash
+func commitBlock(t testing.TB, app *TicketStoreApplication, tickets ...TicketTx) []byte {
+	t.Helper()
+	for _, ticket := range tickets {
+		if response := deliver(t, app, ticket); response.Code != codeTypeOK {
+			t.Fatalf("DeliverTx of ticket %v returned code %v: %v", ticket.Id, response.Code, response.Log)
+		}
+	}
+	return app.Commit().Data
+}
+
+func query(app *TicketStoreApplication, path string, data string, height int64) types.ResponseQuery {
+	return app.Query(types.RequestQuery{Path: path, Data: []byte(data), Height: height})
+}
+
+// queryJSON runs a query that must succeed and decodes its value into v
+func queryJSON(t testing.TB, app *TicketStoreApplication, path string, data string, height int64, v interface{}) types.ResponseQuery {
+	t.Helper()
+	response := query(app, path, data, height)
+	if response.Code != codeTypeOK {
+		t.Fatalf("%v query returned code %v: %v", path, response.Code, response.Log)
+	}
+	if err := json.Unmarshal(response.Value, v); err != nil {
+		t.Fatalf("%v query returned %s: %v", path, response.Value, err)
+	}
+	return response
+}
+
+// referenceRoot computes the root of the tree over tickets, ordered as given,
+// independently of the store: each level pairs neighbouring nodes and pairs
+// an odd last node with itself, down to a single root, which always takes at
+// least one level
+func referenceRoot(t testing.TB, hashStrategy func() hash.Hash, tickets ...TicketTx) []byte {
+	t.Helper()
+	if len(tickets) == 0 {
+		return nil
+	}
+	level := make([][]byte, len(tickets))
+	for i, ticket := range tickets {
+		leaf, err := ticket.CalculateHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		level[i] = leaf
+	}
+	for first := true; first || len(level) > 1; first = false {
+		var parents [][]byte
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			h := hashStrategy()
+			h.Write(level[i])
+			h.Write(right)
+			parents = append(parents, h.Sum(nil))
+		}
+		level = parents
+	}
+	return level[0]
+}
+
+func TestCommitReturnsMerkleRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		tickets []TicketTx
+	}{
+		{"one ticket", []TicketTx{newTicket(1, aliceKey)}},
+		{"two tickets", []TicketTx{newTicket(1, aliceKey), newTicket(2, bobKey)}},
+		{"odd number of tickets", []TicketTx{newTicket(1, aliceKey), newTicket(2, bobKey), newTicket(3, carolKey)}},
+		{"five tickets", []TicketTx{newTicket(1, aliceKey), newTicket(2, bobKey), newTicket(3, carolKey), newTicket(4, aliceKey), newTicket(5, bobKey)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			appHash := commitBlock(t, app, test.tickets...)
+
+			want := referenceRoot(t, sha256.New, test.tickets...)
+			if !bytes.Equal(appHash, want) {
+				t.Errorf("Commit returned %x, want root %x", appHash, want)
+			}
+			if !bytes.Equal(app.state.rootHash, want) {
+				t.Errorf("Stored root is %x, want %x", app.state.rootHash, want)
+			}
+		})
+	}
+}
+
+func TestCommitWithoutTxsKeepsRoot(t *testing.T) {
+	app := NewTicketStoreApplication()
+	appHash := commitBlock(t, app, newTicket(1, aliceKey))
+	if again := app.Commit().Data; !bytes.Equal(again, appHash) {
+		t.Errorf("Empty block changed the app hash from %x to %x", appHash, again)
+	}
+	if app.state.height != 2 {
+		t.Errorf("Height is %v, want 2", app.state.height)
+	}
+}
+
+func TestEmptyBlocksBeforeAnyTicket(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	tests := []struct {
+		name         string
+		hashStrategy func() hash.Hash
+		empty        []byte
+	}{
+		{"sha256", sha256.New, hexutil.MustDecode("0xe3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")},
+		{"keccak256", Keccak256, hexutil.MustDecode("0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(WithHashStrategy(test.hashStrategy))
+			if info := app.Info(types.RequestInfo{}); len(info.LastBlockAppHash) != 0 {
+				t.Errorf("Info before the first block returned app hash %x, want the empty genesis app hash", info.LastBlockAppHash)
+			}
+
+			// Every empty block, on any node, has the hash of no input
+			for height := int64(1); height <= 2; height++ {
+				if appHash := app.Commit().Data; !bytes.Equal(appHash, test.empty) {
+					t.Errorf("Empty block %v returned app hash %x, want %x", height, appHash, test.empty)
+				}
+			}
+			if info := app.Info(types.RequestInfo{}); !bytes.Equal(info.LastBlockAppHash, test.empty) || info.LastBlockHeight != 2 {
+				t.Errorf("Info returned app hash %x at height %v, want %x at 2", info.LastBlockAppHash, info.LastBlockHeight, test.empty)
+			}
+			if response := query(app, "ticket", "1", 0); response.Code != codeTypeNoTickets {
+				t.Errorf("Ticket query over the empty tree returned code %v, want %v", response.Code, codeTypeNoTickets)
+			}
+
+			root := commitBlock(t, app, issued)
+			if want := referenceRoot(t, test.hashStrategy, issued); !bytes.Equal(root, want) {
+				t.Errorf("First ticket's block returned app hash %x, want %x", root, want)
+			}
+
+			// Burning the last live ticket returns to the empty hash
+			if appHash := commitBlock(t, app, resell(t, issued, aliceKey, burnAddress)); !bytes.Equal(appHash, test.empty) {
+				t.Errorf("Block burning the last ticket returned app hash %x, want %x", appHash, test.empty)
+			}
+		})
+	}
+}
+
+func TestTreeCoversTicketsFromEarlierBlocks(t *testing.T) {
+	app := NewTicketStoreApplication()
+	first, second := newTicket(2, aliceKey), newTicket(1, bobKey)
+	commitBlock(t, app, first)
+	appHash := commitBlock(t, app, second)
+
+	// Leaves are ordered by id whichever block delivered them
+	if want := referenceRoot(t, sha256.New, second, first); !bytes.Equal(appHash, want) {
+		t.Fatalf("Commit returned %x, want root %x over both blocks", appHash, want)
+	}
+
+	var proof TicketResponse
+	queryJSON(t, app, "ticket", "2", 0, &proof)
+	if proof.Ticket.TicketTx != first {
+		t.Fatalf("Ticket query returned %+v, want %+v", proof.Ticket.TicketTx, first)
+	}
+	valid, err := proof.verify(appHash, sha256.New)
+	if err != nil || !valid {
+		t.Errorf("Proof of ticket from the first block does not verify against the new root: %v", err)
+	}
+}
+
+func TestTicketQueryProvesEveryTicket(t *testing.T) {
+	app := NewTicketStoreApplication()
+	var tickets []TicketTx
+	for id := uint64(1); id <= 7; id++ {
+		tickets = append(tickets, newTicket(id, aliceKey))
+	}
+	root := commitBlock(t, app, tickets...)
+
+	for _, ticket := range tickets {
+		var proof TicketResponse
+		queryJSON(t, app, "ticket", fmt.Sprint(ticket.Id), 0, &proof)
+		if valid, err := proof.verify(root, sha256.New); err != nil || !valid {
+			t.Errorf("Proof of ticket %v does not verify: %v", ticket.Id, err)
+		}
+		if proof.RootHash != hexutil.Encode(root) || proof.Height != 1 {
+			t.Errorf("Proof of ticket %v names root %v at height %v, want %x at 1", ticket.Id, proof.RootHash, proof.Height, root)
+		}
+	}
+}
+
+// TestConcurrentCheckDeliverCommit runs CheckTx and queries alongside
+// DeliverTx and Commit as Tendermint's connections do. Run it with -race
+func TestConcurrentCheckDeliverCommit(t *testing.T) {
+	app := NewTicketStoreApplication(WithCheckTxCache(16))
+	const blocks, perBlock = 20, 5
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				id := uint64(i%(blocks*perBlock) + 1)
+				checkTx(t, app, newTicket(id, aliceKey))
+				query(app, "ticket", fmt.Sprint(id), 0)
+				query(app, "owner", address(aliceKey), 0)
+				query(app, "stats", "", 0)
+				app.Info(types.RequestInfo{})
+			}
+		}(worker)
+	}
+
+	for block := 0; block < blocks; block++ {
+		app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: int64(block + 1)}})
+		for i := 1; i <= perBlock; i++ {
+			id := uint64(block*perBlock + i)
+			if response := deliver(t, app, newTicket(id, aliceKey)); response.Code != codeTypeOK {
+				t.Errorf("DeliverTx of ticket %v returned code %v: %v", id, response.Code, response.Log)
+			}
+		}
+		app.EndBlock(types.RequestEndBlock{Height: int64(block + 1)})
+		app.Commit()
+	}
+	close(done)
+	wg.Wait()
+
+	var owned []Ticket
+	queryJSON(t, app, "owner", address(aliceKey), 0, &owned)
+	if len(owned) != blocks*perBlock {
+		t.Errorf("Owner holds %v tickets, want %v", len(owned), blocks*perBlock)
+	}
+}
+
+func TestDeliverTxEvents(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	resale := resell(t, issued, aliceKey, address(bobKey))
+
+	tests := []struct {
+		name   string
+		ticket TicketTx
+		want   map[string]string
+	}{
+		{"issue", issued, map[string]string{"id": "1", "owner": address(aliceKey), "prevOwner": "", "nonce": "1"}},
+		{"resale", resale, map[string]string{"id": "1", "owner": address(bobKey), "prevOwner": address(aliceKey), "nonce": "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := deliver(t, app, test.ticket)
+			if response.Code != codeTypeOK {
+				t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+			}
+			app.Commit()
+			if len(response.Events) != 1 || response.Events[0].Type != "ticket" {
+				t.Fatalf("DeliverTx returned events %+v, want one ticket event", response.Events)
+			}
+			attributes := make(map[string]string)
+			for _, pair := range response.Events[0].Attributes {
+				attributes[string(pair.Key)] = string(pair.Value)
+			}
+			if !reflect.DeepEqual(attributes, test.want) {
+				t.Errorf("Event attributes are %v, want %v", attributes, test.want)
+			}
+		})
+	}
+
+	if response := deliver(t, app, issued); response.Code == codeTypeOK || len(response.Events) > 0 {
+		t.Errorf("Rejected tx returned code %v with events %+v", response.Code, response.Events)
+	}
+}
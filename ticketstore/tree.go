@@ -0,0 +1,292 @@
+package ticketstore
+
+import (
+	"hash"
+	"sort"
+)
+
+// merkleTree is the tree over the live tickets ordered by id, laid out as
+// hash.go describes. Nodes are never changed once built, so a tree updated
+// from another shares every node the two have in common and history can keep
+// the tree of each height cheaply
+type merkleTree struct {
+	root *treeNode
+	// size counts the leaves and depth the levels above them, of which there
+	// is always at least one
+	size  int
+	depth int
+}
+
+// treeNode is either a leaf holding a ticket or the parent of two nodes. A
+// node paired with itself is both children of its parent
+type treeNode struct {
+	hash   []byte
+	left   *treeNode
+	right  *treeNode
+	ticket TicketTx
+}
+
+// newMerkleTree builds the tree over tickets, which must be ordered by id, or
+// returns nil when there are none
+func newMerkleTree(tickets []TicketTx, hashStrategy func() hash.Hash) (*merkleTree, error) {
+	if len(tickets) == 0 {
+		return nil, nil
+	}
+
+	level := make([]*treeNode, len(tickets))
+	for i, ticket := range tickets {
+		leaf, err := newLeaf(ticket)
+		if err != nil {
+			return nil, err
+		}
+		level[i] = leaf
+	}
+
+	tree := &merkleTree{size: len(tickets)}
+	for tree.depth == 0 || len(level) > 1 {
+		parents := make([]*treeNode, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			parents = append(parents, newParent(level[i], right, hashStrategy))
+		}
+		level = parents
+		tree.depth++
+	}
+	tree.root = level[0]
+	return tree, nil
+}
+
+func newLeaf(ticket TicketTx) (*treeNode, error) {
+	hash, err := ticket.CalculateHash()
+	if err != nil {
+		return nil, err
+	}
+	return &treeNode{hash: hash, ticket: ticket}, nil
+}
+
+func newParent(left *treeNode, right *treeNode, hashStrategy func() hash.Hash) *treeNode {
+	h := hashStrategy()
+	h.Write(left.hash)
+	h.Write(right.hash)
+	return &treeNode{hash: h.Sum(nil), left: left, right: right}
+}
+
+// leaf returns the leaf at position, counting from zero
+func (tree *merkleTree) leaf(position int) *treeNode {
+	return tree.node(0, position)
+}
+
+// node returns the node at index, counting from zero, of level, counting up
+// from the leaves. Each bit of the index, from the most significant, picks
+// the right child when set
+func (tree *merkleTree) node(level int, index int) *treeNode {
+	node := tree.root
+	for l := tree.depth - 1; l >= level; l-- {
+		if index>>uint(l-level)&1 == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return node
+}
+
+// position returns the position of ticket id's leaf and whether it has one
+func (tree *merkleTree) position(id uint64) (int, bool) {
+	position := sort.Search(tree.size, func(i int) bool { return tree.leaf(i).ticket.Id >= id })
+	return position, position < tree.size && tree.leaf(position).ticket.Id == id
+}
+
+// proof returns the siblings on the path from ticket id's leaf up to the root
+// and, for each, 1 if it is the right hand sibling or 0 if the left
+func (tree *merkleTree) proof(id uint64) ([][]byte, []int64, error) {
+	position, found := tree.position(id)
+	if !found {
+		return nil, nil, ErrTicketNotFound
+	}
+
+	siblings := make([][]byte, tree.depth)
+	index := make([]int64, tree.depth)
+	node := tree.root
+	for level := tree.depth - 1; level >= 0; level-- {
+		if position>>uint(level)&1 == 0 {
+			siblings[level], index[level] = node.right.hash, 1
+			node = node.left
+		} else {
+			siblings[level], index[level] = node.left.hash, 0
+			node = node.right
+		}
+	}
+	return siblings, index, nil
+}
+
+// update returns the tree over tree's tickets as changed by changed, which
+// must be ordered by id: the leaf of each live ticket replaced or inserted
+// and that of each burned ticket removed. The leaves before the first one
+// inserted or removed keep their positions, so of the nodes over them only
+// those above a replaced leaf are new. Every node over the leaves after it,
+// which have moved, is rebuilt. The rest are shared with tree, giving the
+// same root as a full rebuild at a cost that depends on what changed and
+// where rather than on the size of the tree. A nil tree is empty and nil is
+// returned when no leaves are left
+func (tree *merkleTree) update(changed []Ticket, hashStrategy func() hash.Hash) (*merkleTree, error) {
+	if tree == nil {
+		tree = &merkleTree{}
+	}
+	positions := make([]int, len(changed))
+	shift := tree.size
+	for i, ticket := range changed {
+		position, found := tree.position(ticket.Id)
+		positions[i] = position
+		if found == ticket.isBurned() && position < shift {
+			shift = position
+		}
+	}
+
+	u := treeUpdate{old: tree, shift: shift, replaced: make(map[int]*treeNode), hashStrategy: hashStrategy}
+	var rest []Ticket
+	for i, ticket := range changed {
+		switch {
+		case positions[i] >= shift:
+			rest = append(rest, ticket)
+		case !ticket.isBurned():
+			leaf, err := newLeaf(ticket.TicketTx)
+			if err != nil {
+				return nil, err
+			}
+			u.replaced[positions[i]] = leaf
+			u.replacedPositions = append(u.replacedPositions, positions[i])
+		}
+	}
+
+	// Merge the leaves from shift on with the rest of the changes, both
+	// ordered by id
+	moved := tree.leaves(shift)
+	for len(moved) > 0 || len(rest) > 0 {
+		if len(rest) == 0 || (len(moved) > 0 && moved[0].ticket.Id < rest[0].Id) {
+			u.moved = append(u.moved, moved[0])
+			moved = moved[1:]
+			continue
+		}
+		ticket := rest[0]
+		rest = rest[1:]
+		if len(moved) > 0 && moved[0].ticket.Id == ticket.Id {
+			moved = moved[1:]
+		}
+		if ticket.isBurned() {
+			continue
+		}
+		leaf, err := newLeaf(ticket.TicketTx)
+		if err != nil {
+			return nil, err
+		}
+		u.moved = append(u.moved, leaf)
+	}
+
+	updated := &merkleTree{size: shift + len(u.moved)}
+	if updated.size == 0 {
+		return nil, nil
+	}
+	for updated.depth == 0 || levelSize(updated.size, updated.depth) > 1 {
+		updated.depth++
+	}
+	u.size = updated.size
+	updated.root = u.node(updated.depth, 0)
+	return updated, nil
+}
+
+// treeUpdate holds what update works out before building the new tree
+type treeUpdate struct {
+	old *merkleTree
+	// shift is the position of the first leaf inserted or removed, before
+	// which replaced holds the new leaves at their positions, also listed in
+	// order in replacedPositions. moved holds the leaves from shift on
+	shift             int
+	replaced          map[int]*treeNode
+	replacedPositions []int
+	moved             []*treeNode
+	size              int
+	hashStrategy      func() hash.Hash
+}
+
+// node returns the node at index of level in the new tree. It is the old
+// tree's node when both cover the same leaves and none of them changed
+func (u *treeUpdate) node(level int, index int) *treeNode {
+	start := index << uint(level)
+	end, oldEnd := start+1<<uint(level), start+1<<uint(level)
+	if end > u.size {
+		end = u.size
+	}
+	if oldEnd > u.old.size {
+		oldEnd = u.old.size
+	}
+	if level <= u.old.depth && end <= u.shift && end == oldEnd && !u.replacesBetween(start, end) {
+		return u.old.node(level, index)
+	}
+
+	if level == 0 {
+		if start >= u.shift {
+			return u.moved[start-u.shift]
+		}
+		return u.replaced[start]
+	}
+	left := u.node(level-1, 2*index)
+	right := left
+	if 2*index+1 < levelSize(u.size, level-1) {
+		right = u.node(level-1, 2*index+1)
+	}
+	return newParent(left, right, u.hashStrategy)
+}
+
+// replacesBetween reports whether a leaf from start up to end is replaced
+func (u *treeUpdate) replacesBetween(start int, end int) bool {
+	i := sort.SearchInts(u.replacedPositions, start)
+	return i < len(u.replacedPositions) && u.replacedPositions[i] < end
+}
+
+// levelSize is how many nodes level, counting up from the leaves, has in a
+// tree of size leaves
+func levelSize(size int, level int) int {
+	return (size + 1<<uint(level) - 1) >> uint(level)
+}
+
+// leaves returns the leaves from position from on, in order
+func (tree *merkleTree) leaves(from int) []*treeNode {
+	if from >= tree.size {
+		return nil
+	}
+	leaves := make([]*treeNode, 0, tree.size-from)
+	var collect func(node *treeNode, level int, index int)
+	collect = func(node *treeNode, level int, index int) {
+		if (index+1)<<uint(level) <= from || index<<uint(level) >= tree.size {
+			return
+		}
+		if level == 0 {
+			leaves = append(leaves, node)
+			return
+		}
+		collect(node.left, level-1, 2*index)
+		collect(node.right, level-1, 2*index+1)
+	}
+	collect(tree.root, tree.depth, 0)
+	return leaves
+}
+
+// levels returns the tree's nodes level by level from the leaves up to the
+// root, each ordered left to right
+func (tree *merkleTree) levels() [][]*treeNode {
+	levels := make([][]*treeNode, tree.depth+1)
+	levels[tree.depth] = []*treeNode{tree.root}
+	for level := tree.depth; level > 0; level-- {
+		for _, node := range levels[level] {
+			levels[level-1] = append(levels[level-1], node.left)
+			if node.right != node.left {
+				levels[level-1] = append(levels[level-1], node.right)
+			}
+		}
+	}
+	return levels
+}
@@ -0,0 +1,316 @@
+package ticketstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// foldProof rebuilds the root from leaf and its proof as an on-chain verifier
+// would
+func foldProof(hashStrategy func() hash.Hash, leaf []byte, siblings [][]byte, index []int64) []byte {
+	node := leaf
+	for i, sibling := range siblings {
+		h := hashStrategy()
+		if index[i] == 1 {
+			h.Write(node)
+			h.Write(sibling)
+		} else {
+			h.Write(sibling)
+			h.Write(node)
+		}
+		node = h.Sum(nil)
+	}
+	return node
+}
+
+func treeTickets(n int) []TicketTx {
+	tickets := make([]TicketTx, n)
+	for i := range tickets {
+		tickets[i] = newTicket(uint64(2*i+1), aliceKey)
+	}
+	return tickets
+}
+
+func TestMerkleTree(t *testing.T) {
+	strategies := map[string]func() hash.Hash{"sha256": sha256.New, "keccak256": Keccak256}
+	for name, hashStrategy := range strategies {
+		for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 9, 17} {
+			t.Run(fmt.Sprintf("%v %v leaves", name, n), func(t *testing.T) {
+				tickets := treeTickets(n)
+				tree, err := newMerkleTree(tickets, hashStrategy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				root := referenceRoot(t, hashStrategy, tickets...)
+				if !bytes.Equal(tree.root.hash, root) {
+					t.Fatalf("Root is %x, want %x", tree.root.hash, root)
+				}
+
+				for position, ticket := range tickets {
+					if found, ok := tree.position(ticket.Id); !ok || found != position {
+						t.Errorf("Ticket %v is at %v, %v, want %v", ticket.Id, found, ok, position)
+					}
+					siblings, index, err := tree.proof(ticket.Id)
+					if err != nil {
+						t.Fatal(err)
+					}
+					leaf, _ := ticket.CalculateHash()
+					if folded := foldProof(hashStrategy, leaf, siblings, index); !bytes.Equal(folded, root) {
+						t.Errorf("Proof of ticket %v folds to %x, want %x", ticket.Id, folded, root)
+					}
+				}
+				// Ids between and beyond the leaves have no proof
+				for _, id := range []uint64{0, 2, uint64(2*n + 1)} {
+					if _, _, err := tree.proof(id); err != ErrTicketNotFound {
+						t.Errorf("Proof of missing ticket %v returned %v", id, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// burned is ticket burned, as the store keeps it
+func burned(ticket TicketTx) Ticket {
+	ticket.Nonce++
+	ticket.OwnerAddr = burnAddress
+	return Ticket{TicketTx: ticket}
+}
+
+// resold is ticket at its next nonce
+func resold(ticket TicketTx) Ticket {
+	ticket.Nonce++
+	return Ticket{TicketTx: ticket}
+}
+
+// checkUpdate updates the tree over tickets with changed and checks the
+// result against a full rebuild, and that the original tree is unchanged
+func checkUpdate(t *testing.T, tickets []TicketTx, changed []Ticket) {
+	t.Helper()
+	tree, _ := newMerkleTree(tickets, Keccak256)
+	var before []byte
+	if tree != nil {
+		before = tree.root.hash
+	}
+
+	byId := make(map[uint64]Ticket)
+	for _, ticket := range tickets {
+		byId[ticket.Id] = Ticket{TicketTx: ticket}
+	}
+	for _, ticket := range changed {
+		byId[ticket.Id] = ticket
+	}
+	var live []TicketTx
+	for _, ticket := range sortTickets(byId) {
+		if !ticket.isBurned() {
+			live = append(live, ticket.TicketTx)
+		}
+	}
+
+	updated, err := tree.update(changed, Keccak256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := newMerkleTree(live, Keccak256)
+	if rebuilt == nil || updated == nil {
+		if rebuilt != updated {
+			t.Fatalf("Update gave %+v, want %+v", updated, rebuilt)
+		}
+		return
+	}
+	if !bytes.Equal(updated.root.hash, rebuilt.root.hash) || updated.size != rebuilt.size || updated.depth != rebuilt.depth {
+		t.Fatalf("Update gave root %x over %v leaves and %v levels, want %x over %v and %v",
+			updated.root.hash, updated.size, updated.depth, rebuilt.root.hash, rebuilt.size, rebuilt.depth)
+	}
+	if !reflect.DeepEqual(updated.levels(), rebuilt.levels()) {
+		t.Errorf("Update gave different nodes to a full rebuild")
+	}
+	for _, ticket := range live {
+		siblings, index, err := updated.proof(ticket.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, _ := ticket.CalculateHash()
+		if folded := foldProof(Keccak256, leaf, siblings, index); !bytes.Equal(folded, rebuilt.root.hash) {
+			t.Errorf("Proof of ticket %v folds to %x, want %x", ticket.Id, folded, rebuilt.root.hash)
+		}
+	}
+	if tree != nil && !bytes.Equal(tree.root.hash, before) {
+		t.Errorf("Update changed the original tree")
+	}
+}
+
+func TestMerkleTreeUpdate(t *testing.T) {
+	// treeTickets holds the odd ids, so even ones are inserted between them
+	tests := []struct {
+		name    string
+		size    int
+		changed []Ticket
+	}{
+		{"nothing", 5, nil},
+		{"replace the first", 5, []Ticket{resold(newTicket(1, aliceKey))}},
+		{"replace the last", 5, []Ticket{resold(newTicket(9, aliceKey))}},
+		{"replace several", 8, []Ticket{resold(newTicket(3, aliceKey)), resold(newTicket(11, aliceKey)), resold(newTicket(15, aliceKey))}},
+		{"insert first", 5, []Ticket{{TicketTx: newTicket(0, bobKey)}}},
+		{"insert between", 5, []Ticket{{TicketTx: newTicket(4, bobKey)}}},
+		{"insert last", 5, []Ticket{{TicketTx: newTicket(11, bobKey)}}},
+		{"insert past a power of two", 8, []Ticket{{TicketTx: newTicket(17, bobKey)}}},
+		{"remove the first", 5, []Ticket{burned(newTicket(1, aliceKey))}},
+		{"remove between", 5, []Ticket{burned(newTicket(5, aliceKey))}},
+		{"remove the last", 5, []Ticket{burned(newTicket(9, aliceKey))}},
+		{"remove back to a power of two", 9, []Ticket{burned(newTicket(17, aliceKey))}},
+		{"remove the only leaf", 1, []Ticket{burned(newTicket(1, aliceKey))}},
+		{"remove a ticket never in the tree", 3, []Ticket{burned(newTicket(2, aliceKey))}},
+		{"replace, insert and remove", 9, []Ticket{resold(newTicket(1, aliceKey)), {TicketTx: newTicket(6, bobKey)}, burned(newTicket(11, aliceKey)), resold(newTicket(15, aliceKey)), {TicketTx: newTicket(20, bobKey)}}},
+		{"insert into an empty tree", 0, []Ticket{{TicketTx: newTicket(1, bobKey)}, {TicketTx: newTicket(2, bobKey)}, {TicketTx: newTicket(3, bobKey)}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkUpdate(t, treeTickets(test.size), test.changed)
+		})
+	}
+}
+
+func TestMerkleTreeRandomUpdates(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		tickets := treeTickets(random.Intn(40))
+		var changed []Ticket
+		for id := uint64(0); id < 90; id++ {
+			if random.Intn(8) != 0 {
+				continue
+			}
+			ticket := newTicket(id, aliceKey)
+			switch {
+			case id%2 == 0 || int(id) >= 2*len(tickets):
+				changed = append(changed, Ticket{TicketTx: ticket})
+			case random.Intn(2) == 0:
+				changed = append(changed, resold(ticket))
+			default:
+				changed = append(changed, burned(ticket))
+			}
+		}
+		checkUpdate(t, tickets, changed)
+	}
+}
+
+func TestKeccakTicketProof(t *testing.T) {
+	app := NewTicketStoreApplication(WithHashStrategy(Keccak256))
+	tickets := treeTickets(5)
+	root := commitBlock(t, app, tickets...)
+
+	for _, ticket := range tickets {
+		var proof TicketResponse
+		queryJSON(t, app, "ticket", fmt.Sprint(ticket.Id), 0, &proof)
+		siblings := make([][]byte, len(proof.MerkleProof))
+		for i, sibling := range proof.MerkleProof {
+			siblings[i], _ = hexutil.Decode(sibling)
+		}
+		leaf, _ := proof.Ticket.TicketTx.CalculateHash()
+		if folded := foldProof(Keccak256, leaf, siblings, proof.Index); !bytes.Equal(folded, root) {
+			t.Errorf("Proof of ticket %v folds to %x, want the committed root %x", ticket.Id, folded, root)
+		}
+		if folded := foldProof(sha256.New, leaf, siblings, proof.Index); bytes.Equal(folded, root) {
+			t.Errorf("Proof of ticket %v also verifies with sha256", ticket.Id)
+		}
+	}
+}
+
+// referenceLevels hashes the levels of the tree over tickets as the tree
+// query reports them, independently of the store: every level but the root
+// has its last node repeated when it has an odd number of them
+func referenceLevels(t *testing.T, hashStrategy func() hash.Hash, tickets ...TicketTx) [][]string {
+	t.Helper()
+	var level [][]byte
+	for _, ticket := range tickets {
+		leaf, err := ticket.CalculateHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		level = append(level, leaf)
+	}
+	var levels [][]string
+	for first := true; first || len(level) > 1; first = false {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		var hashes []string
+		var parents [][]byte
+		for i := 0; i < len(level); i += 2 {
+			h := hashStrategy()
+			h.Write(level[i])
+			h.Write(level[i+1])
+			parents = append(parents, h.Sum(nil))
+		}
+		for _, node := range level {
+			hashes = append(hashes, hexutil.Encode(node))
+		}
+		levels = append(levels, hashes)
+		level = parents
+	}
+	return append(levels, []string{hexutil.Encode(level[0])})
+}
+
+func TestTreeQuery(t *testing.T) {
+	for _, size := range []int{1, 2, 3, 5, 8} {
+		t.Run(fmt.Sprintf("%v tickets", size), func(t *testing.T) {
+			app := NewTicketStoreApplication(WithDebugQueries())
+			tickets := treeTickets(size)
+			root := commitBlock(t, app, tickets...)
+
+			var tree treeResponse
+			queryJSON(t, app, "tree", "", 0, &tree)
+			want := referenceLevels(t, sha256.New, tickets...)
+			if !reflect.DeepEqual(tree.Levels, want) {
+				t.Errorf("tree query returned levels %v, want %v", tree.Levels, want)
+			}
+			if tree.RootHash != hexutil.Encode(root) || tree.Height != 1 {
+				t.Errorf("tree query returned root %v at height %v, want %x at 1", tree.RootHash, tree.Height, root)
+			}
+			if len(tree.Leaves) != len(want[0]) {
+				t.Fatalf("tree query returned %v leaves, want %v", len(tree.Leaves), len(want[0]))
+			}
+			for i, leaf := range tree.Leaves {
+				// The repeated last leaf is the last ticket again
+				ticket := tickets[len(tickets)-1]
+				if i < len(tickets) {
+					ticket = tickets[i]
+				}
+				if leaf.Id != ticket.Id || leaf.Hash != want[0][i] {
+					t.Errorf("Leaf %v is ticket %v with hash %v, want ticket %v with %v", i, leaf.Id, leaf.Hash, ticket.Id, want[0][i])
+				}
+			}
+		})
+	}
+}
+
+func TestTreeQueryHeightsAndGuard(t *testing.T) {
+	app := NewTicketStoreApplication(WithDebugQueries())
+	var tree treeResponse
+	queryJSON(t, app, "tree", "", 0, &tree)
+	if len(tree.Leaves) != 0 || len(tree.Levels) != 0 {
+		t.Errorf("tree query before any ticket returned %+v, want no leaves or levels", tree)
+	}
+
+	tickets := treeTickets(3)
+	commitBlock(t, app, tickets[:2]...)
+	commitBlock(t, app, tickets[2])
+	queryJSON(t, app, "tree", "", 1, &tree)
+	if want := referenceLevels(t, sha256.New, tickets[:2]...); !reflect.DeepEqual(tree.Levels, want) || tree.Height != 1 {
+		t.Errorf("tree query at height 1 returned %v at %v, want %v", tree.Levels, tree.Height, want)
+	}
+	if response := query(app, "tree", "", 5); response.Code != codeTypeHeightUnavailable {
+		t.Errorf("tree query at a future height returned code %v, want %v", response.Code, codeTypeHeightUnavailable)
+	}
+
+	if response := query(NewTicketStoreApplication(), "tree", "", 0); response.Code != codeTypeUnknownPath || len(response.Value) > 0 {
+		t.Errorf("tree query without debug queries returned code %v and %s, want %v", response.Code, response.Value, codeTypeUnknownPath)
+	}
+}
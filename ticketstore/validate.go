@@ -0,0 +1,52 @@
+package ticketstore
+
+import "strings"
+
+// ValidationOptions are the settings a node validates tickets with. They
+// should match the node's options for ValidateTicket to predict its decision
+type ValidationOptions struct {
+	// ChainId is the EIP-155 chain id set with WithChainId. Zero accepts only
+	// legacy signatures
+	ChainId uint64
+	// MaxDetailsBytes bounds Details as WithMaxDetailsBytes does. Zero
+	// disables the limit
+	MaxDetailsBytes int
+	// StrictNonces is set by WithStrictNonces
+	StrictNonces bool
+	// Issuers are the addresses set with WithIssuers
+	Issuers []string
+	// ChecksummedAddresses is set by WithChecksummedAddresses
+	ChecksummedAddresses bool
+	// NoSelfTransfers is set by WithoutSelfTransfers
+	NoSelfTransfers bool
+}
+
+// DefaultValidationOptions are the settings of a node built without any
+// validation options
+func DefaultValidationOptions() ValidationOptions {
+	return ValidationOptions{MaxDetailsBytes: defaultMaxDetailsBytes}
+}
+
+// ValidateTicket runs the checks a node makes before accepting ticket as the
+// next version of prevTicket, which is the zero Ticket for a new ticket. It
+// does not cover limits that depend on the rest of the node's state, such as
+// the supply cap or the per block transfer limit
+func ValidateTicket(ticket TicketTx, prevTicket Ticket, opts ValidationOptions) error {
+	return ticket.validate(prevTicket.TicketTx, opts.rules())
+}
+
+func (opts ValidationOptions) rules() validationRules {
+	rules := validationRules{
+		chainId:           opts.ChainId,
+		maxDetailsBytes:   opts.MaxDetailsBytes,
+		strictNonces:      opts.StrictNonces,
+		checksumAddresses: opts.ChecksummedAddresses,
+		noSelfTransfers:   opts.NoSelfTransfers}
+	if len(opts.Issuers) > 0 {
+		rules.issuers = make(map[string]bool, len(opts.Issuers))
+		for _, issuer := range opts.Issuers {
+			rules.issuers[strings.ToLower(issuer)] = true
+		}
+	}
+	return rules
+}
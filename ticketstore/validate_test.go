@@ -0,0 +1,340 @@
+package ticketstore
+
+import (
+	"crypto/ecdsa"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestDetailsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		details string
+		code    uint32
+	}{
+		{"empty", nil, "", codeTypeOK},
+		{"unicode", nil, "Row G, seat 12 – ✓", codeTypeOK},
+		{"at the default limit", nil, strings.Repeat("a", defaultMaxDetailsBytes), codeTypeOK},
+		{"over the default limit", nil, strings.Repeat("a", defaultMaxDetailsBytes+1), codeTypeDetailsError},
+		{"multibyte characters over the limit", []Option{WithMaxDetailsBytes(4)}, "ééé", codeTypeDetailsError},
+		{"under a configured limit", []Option{WithMaxDetailsBytes(4)}, "abcd", codeTypeOK},
+		{"limit disabled", []Option{WithMaxDetailsBytes(0)}, strings.Repeat("a", 4*defaultMaxDetailsBytes), codeTypeOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication(test.opts...)
+			ticket := newTicket(1, aliceKey)
+			ticket.Details = test.details
+
+			if response := checkTx(t, app, ticket); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if response := deliver(t, app, ticket); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			app.Commit()
+			if _, stored := app.state.tickets[1]; stored != (test.code == codeTypeOK) {
+				t.Errorf("Ticket stored is %v, want %v", stored, test.code == codeTypeOK)
+			}
+		})
+	}
+}
+
+// JSON decoding replaces invalid UTF-8, so only a ticket built in Go can
+// carry it to validate
+func TestDetailsMustBeUTF8(t *testing.T) {
+	ticket := newTicket(1, aliceKey)
+	ticket.Details = "Seat \xff"
+	if err := ticket.validate(TicketTx{}, validationRules{}); err != ErrBadDetails {
+		t.Errorf("validate returned %v, want %v", err, ErrBadDetails)
+	}
+}
+
+func TestNonceMustIncrease(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	issued.Nonce = 5
+	withNonce := func(nonce uint64) TicketTx {
+		resale := resell(t, issued, aliceKey, address(bobKey))
+		resale.Nonce = nonce
+		return resale
+	}
+
+	tests := []struct {
+		name  string
+		block []TicketTx
+		code  uint32
+	}{
+		{"next nonce", []TicketTx{withNonce(6)}, codeTypeOK},
+		{"nonce skipping ahead", []TicketTx{withNonce(100)}, codeTypeOK},
+		{"same nonce", []TicketTx{withNonce(5)}, codeTypeTicketError},
+		{"lower nonce", []TicketTx{withNonce(4)}, codeTypeTicketError},
+		{"zero nonce", []TicketTx{withNonce(0)}, codeTypeTicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			commitBlock(t, app, issued)
+			for _, ticket := range test.block {
+				if response := deliver(t, app, ticket); response.Code != test.code {
+					t.Fatalf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+				}
+			}
+			app.Commit()
+			want := issued.Nonce
+			if test.code == codeTypeOK {
+				want = test.block[len(test.block)-1].Nonce
+			}
+			if nonce := app.state.tickets[1].Nonce; nonce != want {
+				t.Errorf("Stored nonce is %v, want %v", nonce, want)
+			}
+		})
+	}
+}
+
+func TestNonceIncreasesAcrossTheBlock(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	commitBlock(t, app, issued)
+
+	resale := resell(t, issued, aliceKey, address(bobKey))
+	if response := deliver(t, app, resale); response.Code != codeTypeOK {
+		t.Fatalf("DeliverTx returned code %v: %v", response.Code, response.Log)
+	}
+	// A second resale with the same nonce in the same block is checked
+	// against the first, not the committed ticket
+	replay := resell(t, issued, aliceKey, address(carolKey))
+	if response := deliver(t, app, replay); response.Code != codeTypeTicketError {
+		t.Errorf("Second resale with nonce %v returned code %v (%v), want %v", replay.Nonce, response.Code, response.Log, codeTypeTicketError)
+	}
+	if response := deliver(t, app, resell(t, resale, bobKey, address(carolKey))); response.Code != codeTypeOK {
+		t.Errorf("Resale with the next nonce returned code %v: %v", response.Code, response.Log)
+	}
+}
+
+func TestNonceZeroCreation(t *testing.T) {
+	created := newTicket(1, aliceKey)
+	created.Nonce = 0
+	withNonce := func(nonce uint64) TicketTx {
+		resale := resell(t, created, aliceKey, address(bobKey))
+		resale.Nonce = nonce
+		return resale
+	}
+
+	// A ticket created with nonce 0 has a previous ticket whose nonce is 0,
+	// which a resale must still exceed
+	tests := []struct {
+		name   string
+		resale TicketTx
+		code   uint32
+		err    error
+	}{
+		{"resale to nonce 0", withNonce(0), codeTypeTicketError, ErrBadNonce},
+		{"resale to nonce 1", withNonce(1), codeTypeOK, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			if response := checkTx(t, app, created); response.Code != codeTypeOK {
+				t.Fatalf("CheckTx of the creation returned code %v: %v", response.Code, response.Log)
+			}
+			commitBlock(t, app, created)
+
+			if response := checkTx(t, app, test.resale); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if response := deliver(t, app, test.resale); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			app.Commit()
+			want := created.OwnerAddr
+			if test.code == codeTypeOK {
+				want = test.resale.OwnerAddr
+			}
+			if owner := app.state.tickets[1].OwnerAddr; owner != want {
+				t.Errorf("Ticket is owned by %v, want %v", owner, want)
+			}
+
+			if err := ValidateTicket(test.resale, Ticket{TicketTx: created}, DefaultValidationOptions()); err != test.err {
+				t.Errorf("ValidateTicket returned %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestStrictNonces(t *testing.T) {
+	created := func(nonce uint64) TicketTx {
+		ticket := newTicket(1, aliceKey)
+		ticket.Nonce = nonce
+		return ticket
+	}
+
+	tests := []struct {
+		name   string
+		ticket TicketTx
+		strict bool
+		code   uint32
+	}{
+		{"lenient nonce 0", created(0), false, codeTypeOK},
+		{"lenient nonce 1", created(1), false, codeTypeOK},
+		{"lenient nonce 7", created(7), false, codeTypeOK},
+		{"strict nonce 0", created(0), true, codeTypeTicketError},
+		{"strict nonce 1", created(1), true, codeTypeOK},
+		{"strict nonce 7", created(7), true, codeTypeTicketError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opts []Option
+			if test.strict {
+				opts = append(opts, WithStrictNonces())
+			}
+			app := NewTicketStoreApplication(opts...)
+			if response := app.CheckTx(types.RequestCheckTx{Tx: encodeTx(t, test.ticket)}); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if response := deliver(t, app, test.ticket); response.Code != test.code {
+				t.Errorf("DeliverTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			app.Commit()
+			if _, stored := app.state.tickets[1]; stored != (test.code == codeTypeOK) {
+				t.Errorf("Ticket stored is %v, want %v", stored, test.code == codeTypeOK)
+			}
+
+			validation := DefaultValidationOptions()
+			validation.StrictNonces = test.strict
+			want := error(nil)
+			if test.code != codeTypeOK {
+				want = ErrBadNonce
+			}
+			if err := ValidateTicket(test.ticket, Ticket{}, validation); err != want {
+				t.Errorf("ValidateTicket returned %v, want %v", err, want)
+			}
+		})
+	}
+}
+
+func TestTicketIds(t *testing.T) {
+	tests := []struct {
+		name    string
+		tickets []TicketTx
+		code    uint32
+		err     error
+	}{
+		{"id 0", []TicketTx{newTicket(0, aliceKey)}, codeTypeTicketError, ErrBadId},
+		{"id 1", []TicketTx{newTicket(1, aliceKey)}, codeTypeOK, nil},
+		{"largest id", []TicketTx{newTicket(math.MaxUint64, aliceKey)}, codeTypeOK, nil},
+		{"bundle with id 0", []TicketTx{newTicket(1, aliceKey), newTicket(0, aliceKey)}, codeTypeTicketError, ErrBadId},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			if response := checkTx(t, app, test.tickets...); response.Code != test.code {
+				t.Errorf("CheckTx returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			response := deliver(t, app, test.tickets...)
+			if response.Code != test.code || (test.err != nil && !strings.Contains(response.Log, test.err.Error())) {
+				t.Errorf("DeliverTx returned code %v (%v), want %v with %v", response.Code, response.Log, test.code, test.err)
+			}
+			app.Commit()
+			if stored := len(app.state.tickets); (stored > 0) != (test.code == codeTypeOK) {
+				t.Errorf("%v tickets stored", stored)
+			}
+			if err := ValidateTicket(test.tickets[len(test.tickets)-1], Ticket{}, DefaultValidationOptions()); err != test.err {
+				t.Errorf("ValidateTicket returned %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTicketZeroIsNeverFound(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(1, aliceKey))
+	if response := query(app, "ticket", "0", 0); response.Code != codeTypeNotFound {
+		t.Errorf("ticket query for id 0 returned code %v (%v), want %v", response.Code, response.Log, codeTypeNotFound)
+	}
+}
+
+func TestValidateTicketAgreesWithApp(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	signed := func(ticket TicketTx, sign func(TicketTx) (string, error)) TicketTx {
+		proof, err := sign(ticket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticket.PrevOwnerProof = proof
+		return ticket
+	}
+	onChain := func(prev TicketTx, key *ecdsa.PrivateKey, owner string) TicketTx {
+		ticket := TicketTx{Id: prev.Id, Nonce: prev.Nonce + 1, Details: prev.Details, OwnerAddr: owner}
+		return signed(ticket, func(TicketTx) (string, error) { return SignTicketTransferForChain(prev, key, 5) })
+	}
+	unsignedNew := newTicket(2, bobKey)
+	longDetails := newTicket(2, bobKey)
+	longDetails.Details = strings.Repeat("x", 9)
+	checksummed := newTicket(2, bobKey)
+	checksummed.OwnerAddr = crypto.PubkeyToAddress(bobKey.PublicKey).Hex()
+	badAddress := newTicket(2, bobKey)
+	badAddress.OwnerAddr = "0xnot-an-address"
+	laterNonce := newTicket(2, bobKey)
+	laterNonce.Nonce = 2
+	tickets := []struct {
+		name   string
+		ticket TicketTx
+	}{
+		{"new ticket", unsignedNew},
+		{"new ticket signed by an issuer", signed(unsignedNew, func(ticket TicketTx) (string, error) { return SignTicketIssue(ticket, carolKey) })},
+		{"new ticket with a later nonce", laterNonce},
+		{"new ticket with long details", longDetails},
+		{"new ticket to a checksummed address", checksummed},
+		{"new ticket to a malformed address", badAddress},
+		{"resale", resell(t, issued, aliceKey, address(bobKey))},
+		{"resale on chain 5", onChain(issued, aliceKey, address(bobKey))},
+		{"resale to the owner", resell(t, issued, aliceKey, address(aliceKey))},
+		{"resale signed by someone else", resell(t, issued, bobKey, address(bobKey))},
+		{"replayed ticket", issued},
+		{"burn", resell(t, issued, aliceKey, burnAddress)},
+	}
+	configs := []struct {
+		name    string
+		opts    ValidationOptions
+		appOpts []Option
+	}{
+		{"default", DefaultValidationOptions(), nil},
+		{"chain id", ValidationOptions{ChainId: 5, MaxDetailsBytes: defaultMaxDetailsBytes}, []Option{WithChainId(5)}},
+		{"max details", ValidationOptions{MaxDetailsBytes: 8}, []Option{WithMaxDetailsBytes(8)}},
+		{"strict nonces", ValidationOptions{StrictNonces: true, MaxDetailsBytes: defaultMaxDetailsBytes}, []Option{WithStrictNonces()}},
+		{"issuers", ValidationOptions{Issuers: []string{crypto.PubkeyToAddress(carolKey.PublicKey).Hex()}, MaxDetailsBytes: defaultMaxDetailsBytes},
+			[]Option{WithIssuers(crypto.PubkeyToAddress(carolKey.PublicKey).Hex())}},
+		{"checksummed addresses", ValidationOptions{ChecksummedAddresses: true, MaxDetailsBytes: defaultMaxDetailsBytes}, []Option{WithChecksummedAddresses()}},
+		{"no self transfers", ValidationOptions{NoSelfTransfers: true, MaxDetailsBytes: defaultMaxDetailsBytes}, []Option{WithoutSelfTransfers()}},
+	}
+	for _, config := range configs {
+		for _, test := range tickets {
+			t.Run(config.name+" "+test.name, func(t *testing.T) {
+				app := NewTicketStoreApplication(config.appOpts...)
+				app.InitChain(types.RequestInitChain{AppStateBytes: encodeTx(t, issued, newTicket(3, carolKey))})
+
+				// A client fetches the previous ticket with a query
+				var prev TicketResponse
+				if test.ticket.Id == issued.Id {
+					queryJSON(t, app, "ticket", "1", 0, &prev)
+				}
+				err := ValidateTicket(test.ticket, prev.Ticket, config.opts)
+				want := codeTypeOK
+				if err != nil {
+					want = validationCode(err)
+				}
+				if response := checkTx(t, app, test.ticket); response.Code != want {
+					t.Errorf("CheckTx returned code %v (%v) but ValidateTicket %v", response.Code, response.Log, err)
+				}
+				if response := deliver(t, app, test.ticket); response.Code != want {
+					t.Errorf("DeliverTx returned code %v (%v) but ValidateTicket %v", response.Code, response.Log, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package ticketstore
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// validatorHoldings turns ticket holdings into voting power. Each address in
+// pubKeys is a validator with one unit of power per live ticket it holds
+type validatorHoldings struct {
+	// pubKeys maps a lower case owner address to its ed25519 public key
+	pubKeys map[string][]byte
+	// maxPower caps a validator's power. Zero means no cap
+	maxPower int64
+}
+
+// WithValidatorHoldings has EndBlock give each address in validators voting
+// power equal to the number of live tickets it holds, capped at maxPower when
+// above zero. validators maps an owner address to its validator's ed25519
+// public key. The genesis validators must match the genesis holdings. An
+// address holding no tickets has no power, so operators must make sure enough
+// power remains for the chain to make progress
+func WithValidatorHoldings(validators map[string][]byte, maxPower int64) Option {
+	return func(app *TicketStoreApplication) {
+		holdings := &validatorHoldings{
+			pubKeys:  make(map[string][]byte, len(validators)),
+			maxPower: maxPower}
+		for addr, pubKey := range validators {
+			holdings.pubKeys[strings.ToLower(addr)] = pubKey
+		}
+		app.validators = holdings
+	}
+}
+
+// updates returns an update for every validator whose power in current
+// differs from its power in committed, the holdings as of the last Commit.
+// Both come from state, so every node returns the same updates, ordered by
+// address, even after a restart
+func (holdings *validatorHoldings) updates(committed ownerMap, current ownerIndex) []types.ValidatorUpdate {
+	addrs := make([]string, 0, len(holdings.pubKeys))
+	for addr := range holdings.pubKeys {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var updates []types.ValidatorUpdate
+	for _, addr := range addrs {
+		power := holdings.power(len(current[addr]))
+		if power == holdings.power(len(committed.get(addr))) {
+			continue
+		}
+		updates = append(updates, types.Ed25519ValidatorUpdate(holdings.pubKeys[addr], power))
+	}
+	return updates
+}
+
+// power is the voting power of a validator holding held tickets
+func (holdings *validatorHoldings) power(held int) int64 {
+	power := int64(held)
+	if holdings.maxPower > 0 && power > holdings.maxPower {
+		power = holdings.maxPower
+	}
+	return power
+}
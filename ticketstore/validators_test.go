@@ -0,0 +1,67 @@
+package ticketstore
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestValidatorHoldings(t *testing.T) {
+	alicePubKey, bobPubKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	// Validators may be configured by checksum address
+	validators := map[string][]byte{
+		crypto.PubkeyToAddress(aliceKey.PublicKey).Hex(): alicePubKey,
+		crypto.PubkeyToAddress(bobKey.PublicKey).Hex():   bobPubKey,
+	}
+	alice := func(power int64) types.ValidatorUpdate { return types.Ed25519ValidatorUpdate(alicePubKey, power) }
+	bob := func(power int64) types.ValidatorUpdate { return types.Ed25519ValidatorUpdate(bobPubKey, power) }
+
+	// Updates are ordered by address
+	var byAddress func(a, b types.ValidatorUpdate) []types.ValidatorUpdate
+	if address(aliceKey) < address(bobKey) {
+		byAddress = func(a, b types.ValidatorUpdate) []types.ValidatorUpdate { return []types.ValidatorUpdate{a, b} }
+	} else {
+		byAddress = func(a, b types.ValidatorUpdate) []types.ValidatorUpdate { return []types.ValidatorUpdate{b, a} }
+	}
+
+	issued := newTicket(1, aliceKey)
+	toBob := resell(t, issued, aliceKey, address(bobKey))
+	blocks := []struct {
+		name    string
+		tickets []TicketTx
+		want    []types.ValidatorUpdate
+		capped  []types.ValidatorUpdate
+	}{
+		{"alice and a non-validator get tickets", []TicketTx{issued, newTicket(2, aliceKey), newTicket(3, carolKey)},
+			[]types.ValidatorUpdate{alice(2)}, []types.ValidatorUpdate{alice(1)}},
+		{"alice resells to bob", []TicketTx{toBob}, byAddress(alice(1), bob(1)), []types.ValidatorUpdate{bob(1)}},
+		{"empty block", nil, nil, nil},
+		{"only the non-validator's holdings change", []TicketTx{newTicket(4, carolKey)}, nil, nil},
+		{"bob burns his ticket", []TicketTx{resell(t, toBob, bobKey, burnAddress)}, []types.ValidatorUpdate{bob(0)}, []types.ValidatorUpdate{bob(0)}},
+	}
+
+	for _, maxPower := range []int64{0, 1} {
+		app := NewTicketStoreApplication(WithValidatorHoldings(validators, maxPower))
+		for height, block := range blocks {
+			app.BeginBlock(types.RequestBeginBlock{Header: types.Header{Height: int64(height + 1)}})
+			for _, ticket := range block.tickets {
+				if response := deliver(t, app, ticket); response.Code != codeTypeOK {
+					t.Fatalf("DeliverTx of ticket %v returned code %v: %v", ticket.Id, response.Code, response.Log)
+				}
+			}
+			updates := app.EndBlock(types.RequestEndBlock{Height: int64(height + 1)}).ValidatorUpdates
+			app.Commit()
+
+			want := block.want
+			if maxPower > 0 {
+				want = block.capped
+			}
+			if !reflect.DeepEqual(updates, want) {
+				t.Errorf("EndBlock after %v with max power %v returned %v, want %v", block.name, maxPower, updates, want)
+			}
+		}
+	}
+}
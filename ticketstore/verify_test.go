@@ -0,0 +1,150 @@
+package ticketstore
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestVerifyQuery(t *testing.T) {
+	app := NewTicketStoreApplication()
+	commitBlock(t, app, newTicket(1, aliceKey), newTicket(2, bobKey), newTicket(3, carolKey))
+	var proof TicketResponse
+	queryJSON(t, app, "ticket", "2", 0, &proof)
+	commitBlock(t, app, newTicket(4, aliceKey))
+
+	tampered := proof
+	tampered.Ticket.Details = "Forged"
+	wrongSibling := proof
+	wrongSibling.MerkleProof = append([]string{"0x" + proof.MerkleProof[0][4:] + "00"}, proof.MerkleProof[1:]...)
+	latest := proof
+	latest.Height, latest.RootHash = 0, ""
+	future := proof
+	future.Height = 10
+	short := proof
+	short.Index = short.Index[1:]
+
+	tests := []struct {
+		name   string
+		proof  interface{}
+		code   uint32
+		valid  bool
+		height int64
+	}{
+		{"proof at its own height", proof, codeTypeOK, true, 1},
+		{"tampered ticket", tampered, codeTypeOK, false, 1},
+		{"tampered sibling", wrongSibling, codeTypeOK, false, 1},
+		{"stale proof against the latest root", latest, codeTypeOK, false, 2},
+		{"height that was never committed", future, codeTypeHeightUnavailable, false, 0},
+		{"fewer indexes than hashes", short, codeTypeEncodingError, false, 0},
+		{"not a proof", "ticket 2", codeTypeEncodingError, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, _ := json.Marshal(test.proof)
+			response := query(app, "verify", string(data), 0)
+			if response.Code != test.code {
+				t.Fatalf("verify query returned code %v (%v), want %v", response.Code, response.Log, test.code)
+			}
+			if test.code != codeTypeOK {
+				return
+			}
+			var verified verifyResponse
+			if err := json.Unmarshal(response.Value, &verified); err != nil {
+				t.Fatal(err)
+			}
+			if verified.Valid != test.valid || verified.Height != test.height {
+				t.Errorf("verify query returned %+v, want valid %v at height %v", verified, test.valid, test.height)
+			}
+		})
+	}
+}
+
+// TestVerifyQueryLatestRoot checks a proof without a height is checked
+// against the app hash Info reports, including at heights with no tickets
+func TestVerifyQueryLatestRoot(t *testing.T) {
+	issued := newTicket(1, aliceKey)
+	burn := resell(t, issued, aliceKey, burnAddress)
+
+	tests := []struct {
+		name   string
+		blocks [][]TicketTx
+		valid  bool
+	}{
+		{"before the first block", nil, false},
+		{"empty block before any ticket", [][]TicketTx{{}}, false},
+		{"ticket committed", [][]TicketTx{{issued}}, true},
+		{"every ticket burned", [][]TicketTx{{issued}, {burn}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := NewTicketStoreApplication()
+			for _, block := range test.blocks {
+				commitBlock(t, app, block...)
+			}
+			info := app.Info(types.RequestInfo{})
+
+			// Only the committed ticket has a proof, the others a bare leaf
+			proof := TicketResponse{Ticket: Ticket{TicketTx: issued}, MerkleProof: []string{}, Index: []int64{}}
+			if test.valid {
+				queryJSON(t, app, "ticket", "1", 0, &proof)
+				proof.Height, proof.RootHash = 0, ""
+			}
+			data, _ := json.Marshal(proof)
+			var verified verifyResponse
+			queryJSON(t, app, "verify", string(data), 0, &verified)
+			if verified.Valid != test.valid || verified.Height != info.LastBlockHeight || verified.RootHash != hexutil.Encode(info.LastBlockAppHash) {
+				t.Errorf("verify query returned %+v, want valid %v against %x at height %v", verified, test.valid, info.LastBlockAppHash, info.LastBlockHeight)
+			}
+		})
+	}
+}
+
+func TestProofBoundToHeight(t *testing.T) {
+	app := NewTicketStoreApplication()
+	issued := newTicket(1, aliceKey)
+	roots := map[int64][]byte{1: commitBlock(t, app, issued, newTicket(2, bobKey))}
+	var proof TicketResponse
+	queryJSON(t, app, "ticket", "1", 1, &proof)
+	var lastChange TicketResponse
+	queryJSON(t, app, "lastChange", "1", 0, &lastChange)
+	// The ticket changes at height 2, so its old leaf is not in that tree
+	roots[2] = commitBlock(t, app, resell(t, issued, aliceKey, address(bobKey)))
+	roots[3] = commitBlock(t, app, newTicket(3, carolKey))
+
+	rebound := func(proof TicketResponse, height int64, rootHash string) TicketResponse {
+		proof.Height, proof.RootHash = height, rootHash
+		return proof
+	}
+	tests := []struct {
+		name   string
+		proof  TicketResponse
+		root   int64
+		valid  bool
+		height int64
+	}{
+		{"ticket proof at its height", proof, 1, true, 1},
+		{"lastChange proof at its height", lastChange, 1, true, 1},
+		{"claiming the next height", rebound(proof, 2, hexutil.Encode(roots[2])), 2, false, 2},
+		{"claiming the next height without a root", rebound(proof, 2, ""), 2, false, 2},
+		{"claiming a later height", rebound(proof, 3, hexutil.Encode(roots[3])), 3, false, 3},
+		{"root of another height", rebound(proof, 1, hexutil.Encode(roots[2])), 1, false, 1},
+		{"no height against the latest root", rebound(proof, 0, ""), 3, false, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid, err := test.proof.verify(roots[test.root], sha256.New); valid != test.valid || err != nil {
+				t.Errorf("Proof against the root at height %v is valid %v (%v), want %v", test.root, valid, err, test.valid)
+			}
+			data, _ := json.Marshal(test.proof)
+			var verified verifyResponse
+			queryJSON(t, app, "verify", string(data), 0, &verified)
+			if verified.Valid != test.valid || verified.Height != test.height {
+				t.Errorf("verify query returned %+v, want valid %v at height %v", verified, test.valid, test.height)
+			}
+		})
+	}
+}
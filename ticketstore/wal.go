@@ -0,0 +1,144 @@
+package ticketstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const walFileName = "wal.jsonl"
+
+// walEntry records what one Commit changed so that the commits made since the
+// state file was last written can be replayed
+type walEntry struct {
+	Height  int64    `json:"height"`
+	Size    int64    `json:"size"`
+	Stats   txStats  `json:"stats"`
+	Tickets []Ticket `json:"tickets"`
+}
+
+// WithFlushInterval writes the state file every interval commits rather than
+// only on Close. Each commit in between is appended to a write-ahead log in
+// the data directory, synced before Commit returns, and replayed on open
+func WithFlushInterval(interval int64) Option {
+	return func(app *TicketStoreApplication) {
+		app.flushInterval = interval
+	}
+}
+
+// changedTickets returns the tickets changed in the current block, ordered by
+// id
+func (state state) changedTickets() []Ticket {
+	ids := make(map[uint64]bool, len(state.tempTreeContent))
+	for _, ticket := range state.tempTreeContent {
+		ids[ticket.Id] = true
+	}
+	changed := make([]Ticket, 0, len(ids))
+	for id := range ids {
+		changed = append(changed, state.tickets[id])
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Id < changed[j].Id })
+	return changed
+}
+
+// persistCommit makes the commit just made durable, writing the state file
+// every flushInterval commits and otherwise logging the tickets it changed.
+// The caller must hold the write lock
+func (app *TicketStoreApplication) persistCommit(changed []Ticket) error {
+	if app.state.height%app.flushInterval == 0 {
+		if err := app.flush(); err != nil {
+			return err
+		}
+		return app.truncateWAL()
+	}
+
+	data, err := json.Marshal(walEntry{
+		Height:  app.state.height,
+		Size:    app.state.size,
+		Stats:   app.state.committedStats,
+		Tickets: changed})
+	if err != nil {
+		return err
+	}
+	if app.wal == nil {
+		app.wal, err = os.OpenFile(filepath.Join(app.dataDir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := app.wal.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return app.wal.Sync()
+}
+
+// truncateWAL discards the log once the state file covers every entry in it
+func (app *TicketStoreApplication) truncateWAL() error {
+	if app.wal != nil {
+		if err := app.wal.Close(); err != nil {
+			return err
+		}
+		app.wal = nil
+	}
+	if err := os.Remove(filepath.Join(app.dataDir, walFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// replayWAL applies the commits logged in dataDir after the state's height
+// and rebuilds the tree at the last of them
+func (state *state) replayWAL(dataDir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, walFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	replayed := false
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry walEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A crash while appending can only leave the last entry partly
+			// written, and the Commit it belongs to never returned
+			if i == len(lines)-1 {
+				break
+			}
+			return err
+		}
+		// Entries already in the state file are left over from a crash
+		// between writing it and discarding the log
+		if entry.Height <= state.height {
+			continue
+		}
+		if entry.Height != state.height+1 {
+			return fmt.Errorf("Write-ahead log skips from height %v to %v", state.height, entry.Height)
+		}
+
+		for _, ticket := range entry.Tickets {
+			state.owners.move(ticket.Id, state.tickets[ticket.Id].OwnerAddr, ticket.OwnerAddr)
+			state.tickets[ticket.Id] = ticket
+		}
+		state.height = entry.Height
+		state.size = entry.Size
+		state.deliverStats = entry.Stats.copy()
+		state.committedStats = entry.Stats
+		replayed = true
+	}
+
+	if !replayed {
+		return nil
+	}
+	state.retainedFrom = state.height
+	return state.buildTree()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// tlsProxy accepts TLS connections on the public ABCI address and relays them
+// to the ABCI server over a unix socket private to this process. Tendermint's
+// ABCI servers open their own listener, so it cannot be wrapped directly
+type tlsProxy struct {
+	listener net.Listener
+	dir      string
+	socket   string
+}
+
+// newTLSProxy listens for TLS connections on address, which must be a tcp
+// address
+func newTLSProxy(address string, certFile string, keyFile string) (*tlsProxy, error) {
+	proto, addr := cmn.ProtocolAndAddress(address)
+	if proto != "tcp" {
+		return nil, fmt.Errorf("TLS requires a tcp address, got %v", address)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "tendermint-exp")
+	if err != nil {
+		return nil, err
+	}
+	listener, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &tlsProxy{listener: listener, dir: dir, socket: filepath.Join(dir, "abci.sock")}, nil
+}
+
+// backendAddress is the address the ABCI server should listen on
+func (proxy *tlsProxy) backendAddress() string {
+	return "unix://" + proxy.socket
+}
+
+// serve relays connections until the proxy is closed
+func (proxy *tlsProxy) serve(logger log.Logger) {
+	for {
+		conn, err := proxy.listener.Accept()
+		if err != nil {
+			logger.Info("TLS listener stopped", "err", err)
+			return
+		}
+		go proxy.relay(conn, logger)
+	}
+}
+
+// relay copies between conn and a new connection to the ABCI server until
+// either side closes
+func (proxy *tlsProxy) relay(conn net.Conn, logger log.Logger) {
+	defer conn.Close()
+	backend, err := net.Dial("unix", proxy.socket)
+	if err != nil {
+		logger.Error("Failed to reach the ABCI server", "err", err)
+		return
+	}
+	defer backend.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(backend, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, backend)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (proxy *tlsProxy) Close() error {
+	err := proxy.listener.Close()
+	os.RemoveAll(proxy.dir)
+	return err
+}
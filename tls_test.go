@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key to dir
+// and returns their paths along with a pool trusting the certificate
+func writeSelfSignedCert(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tendermint-exp test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestTLSProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, pool := writeSelfSignedCert(t, dir)
+
+	proxy, err := newTLSProxy("tcp://127.0.0.1:0", certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	// An echo server stands in for the ABCI server behind the proxy
+	backend, err := net.Listen("unix", proxy.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	go proxy.serve(log.NewNopLogger())
+
+	tests := []struct {
+		name   string
+		config *tls.Config
+		fails  bool
+	}{
+		{"trusted certificate", &tls.Config{RootCAs: pool}, false},
+		{"untrusted certificate", &tls.Config{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := tls.Dial("tcp", proxy.listener.Addr().String(), test.config)
+			if test.fails {
+				if err == nil {
+					conn.Close()
+					t.Fatal("Handshake succeeded, want failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			message := []byte("echo")
+			if _, err := conn.Write(message); err != nil {
+				t.Fatal(err)
+			}
+			reply := make([]byte, len(message))
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.ReadFull(conn, reply); err != nil || !bytes.Equal(reply, message) {
+				t.Errorf("Read %q, %v through the proxy, want %q", reply, err, message)
+			}
+		})
+	}
+
+	// Plain TCP clients cannot talk to the server
+	conn, err := net.Dial("tcp", proxy.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("plain\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if reply, _ := ioutil.ReadAll(conn); bytes.Contains(reply, []byte("plain")) {
+		t.Error("Proxy relayed a plain TCP connection")
+	}
+}
+
+func TestNewTLSProxyErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir)
+
+	tests := []struct {
+		name     string
+		address  string
+		certFile string
+		keyFile  string
+	}{
+		{"unix address", "unix://" + filepath.Join(dir, "abci.sock"), certFile, keyFile},
+		{"missing certificate", "tcp://127.0.0.1:0", filepath.Join(dir, "missing.pem"), keyFile},
+		{"certificate given as the key", "tcp://127.0.0.1:0", certFile, certFile},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if proxy, err := newTLSProxy(test.address, test.certFile, test.keyFile); err == nil {
+				proxy.Close()
+				t.Error("newTLSProxy succeeded, want an error")
+			}
+		})
+	}
+}